@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+type PrometheusRuleFile struct {
+	Groups []PrometheusRuleGroup `yaml:"groups"`
+}
+
+type PrometheusRuleGroup struct {
+	Name  string           `yaml:"name"`
+	Rules []PrometheusRule `yaml:"rules"`
+}
+
+type PrometheusRule struct {
+	Alert       string            `yaml:"alert"`
+	Expr        string            `yaml:"expr"`
+	For         string            `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type AlertRulesParams struct {
+	// warn when a trial expires within this many days
+	ExpiringDays int
+	// the time between scheduled runs, a run is missed after one and a half of it
+	RunInterval time.Duration
+	// label matchers added to every metric, e.g. job="jira-auto-trial"
+	Selector string
+}
+
+// AlertRules builds prometheus alerting rules for the metrics that serve exports on /metrics.
+func AlertRules(params AlertRulesParams) PrometheusRuleFile {
+	metric := func(name string) string {
+		if params.Selector == "" {
+			return name
+		}
+		return name + "{" + params.Selector + "}"
+	}
+	missedAfter := promDuration(params.RunInterval + params.RunInterval/2)
+	window := promDuration(params.RunInterval)
+
+	return PrometheusRuleFile{Groups: []PrometheusRuleGroup{{
+		Name: "jira-auto-trial",
+		Rules: []PrometheusRule{
+			{
+				Alert:  "JiraTrialExpiringSoon",
+				Expr:   fmt.Sprintf("%s < %d", metric("jira_trial_days_remaining"), params.ExpiringDays),
+				For:    "15m",
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary":     "Trial of {{ $labels.instance }} expires in {{ $value | humanize }} days",
+					"description": fmt.Sprintf("The trial license was not renewed although it expires in less than %d days, check the last runs of jira-auto-trial.", params.ExpiringDays),
+				},
+			},
+			{
+				Alert:  "JiraTrialInstanceFailed",
+				Expr:   fmt.Sprintf("increase(%s[%s]) > 0", metric("jira_trial_failures_total"), window),
+				Labels: map[string]string{"severity": "warning"},
+				Annotations: map[string]string{
+					"summary":     "jira-auto-trial failed to process {{ $labels.instance }}",
+					"description": "The instance failed in a run of the last " + window + ", the failure capture in data/failures shows where.",
+				},
+			},
+			{
+				Alert:  "JiraTrialRunFailed",
+				Expr:   fmt.Sprintf("increase(%s[%s]) > 0", metric("jira_trial_run_failures_total"), window),
+				Labels: map[string]string{"severity": "critical"},
+				Annotations: map[string]string{
+					"summary":     "A jira-auto-trial run stopped with an error",
+					"description": "A run of the last " + window + " stopped before all instances were processed.",
+				},
+			},
+			{
+				Alert:  "JiraTrialRunMissed",
+				Expr:   fmt.Sprintf("time() - %s > %d", metric("jira_trial_last_run_timestamp_seconds"), int64((params.RunInterval + params.RunInterval/2).Seconds())),
+				Labels: map[string]string{"severity": "critical"},
+				Annotations: map[string]string{
+					"summary":     "jira-auto-trial has not finished a run for " + missedAfter,
+					"description": "The last run finished {{ $value | humanizeDuration }} ago, check the schedule and the logs of serve.",
+				},
+			},
+			{
+				Alert:  "JiraTrialNoRun",
+				Expr:   fmt.Sprintf("absent(%s)", metric("jira_trial_last_run_timestamp_seconds")),
+				For:    missedAfter,
+				Labels: map[string]string{"severity": "critical"},
+				Annotations: map[string]string{
+					"summary":     "jira-auto-trial has not finished a run since it started",
+					"description": "serve is down, not scraped or has not finished a run for " + missedAfter + ".",
+				},
+			},
+		},
+	}}}
+}
+
+// promDuration formats a duration the way prometheus parses it, e.g. 36h or 1h30m.
+func promDuration(d time.Duration) string {
+	if d < time.Second {
+		return "0s"
+	}
+	var b strings.Builder
+	for _, unit := range []struct {
+		suffix string
+		size   time.Duration
+	}{{"h", time.Hour}, {"m", time.Minute}, {"s", time.Second}} {
+		if n := d / unit.size; n > 0 {
+			fmt.Fprintf(&b, "%d%s", n, unit.suffix)
+			d -= n * unit.size
+		}
+	}
+	return b.String()
+}
+
+func genAlertsCommand() *Command {
+	cmd := &Command{
+		Name:  "gen-alerts",
+		Usage: "jira-auto-trial gen-alerts [-expiring-days n] [-run-interval duration] [-selector matchers] [-output file]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		var params AlertRulesParams
+
+		fs := cmd.FlagSet()
+		fs.IntVar(&params.ExpiringDays, "expiring-days", 3, "alert when a trial expires within this many days")
+		fs.DurationVar(&params.RunInterval, "run-interval", 24*time.Hour, "time between scheduled runs, a run is missed after one and a half of it")
+		fs.StringVar(&params.Selector, "selector", "", `label matchers of the scrape job, e.g. job="jira-auto-trial"`)
+		output := fs.String("output", "-", "output file, - for stdout")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if params.ExpiringDays <= 0 {
+			return fmt.Errorf("-expiring-days must be positive")
+		}
+		if params.RunInterval < time.Minute {
+			return fmt.Errorf("-run-interval must be at least a minute")
+		}
+
+		return writeOutput(*output, func(w io.Writer) error {
+			encoder := yaml.NewEncoder(w)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(AlertRules(params)); err != nil {
+				return err
+			}
+			return encoder.Close()
+		})
+	}
+
+	return cmd
+}
@@ -1,20 +1,32 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"encoding/csv"
 	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/credentials"
+	"github.com/tarik02/jira-auto-trial/dates"
+	"github.com/tarik02/jira-auto-trial/otp"
+	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
 type AtlassianLoginHandler struct {
 	UsernameResolver func(ctx context.Context) (string, error)
-	PasswordResolver func(ctx context.Context) (string, error)
+	PasswordResolver func(ctx context.Context) (credentials.Secret, error)
 	OTPCodeResolver  func(ctx context.Context) (string, error)
 }
 
@@ -22,49 +34,50 @@ func (s *AtlassianLoginHandler) Run(ctx context.Context, page playwright.Page) e
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
-		return RunPageLocator(ctx, page.Locator(`//form[@data-testid="form-login"]//input[@data-testid="username"]`), func(ctx context.Context, locator playwright.Locator) error {
+		return RunPageLocator(ctx, "atlassianLogin", page.Locator(`//form[@data-testid="form-login"]//input[@data-testid="username"]`), func(ctx context.Context, locator playwright.Locator) error {
 			username, err := s.UsernameResolver(ctx)
 			if err != nil {
 				return err
 			}
 
-			if err := page.Locator(`//form[@data-testid="form-login"]//input[@data-testid="username"]`).Fill(username); err != nil {
+			if err := Fill(ctx, page.Locator(`//form[@data-testid="form-login"]//input[@data-testid="username"]`), username); err != nil {
 				return err
 			}
 
-			return page.Locator(`//form[@data-testid="form-login"]//*[@type="submit"]`).Click()
+			return Click(ctx, page.Locator(`//form[@data-testid="form-login"]//*[@type="submit"]`))
 		})
 	})
 
 	g.Go(func() error {
-		return RunPageLocator(ctx, page.Locator(`//form[@data-testid="form-login"]//input[@data-testid="password"]`), func(ctx context.Context, locator playwright.Locator) error {
+		return RunPageLocator(ctx, "atlassianLogin", page.Locator(`//form[@data-testid="form-login"]//input[@data-testid="password"]`), func(ctx context.Context, locator playwright.Locator) error {
 			password, err := s.PasswordResolver(ctx)
 			if err != nil {
 				return err
 			}
+			defer password.Wipe()
 
-			if err := page.Locator(`//form[@data-testid="form-login"]//input[@data-testid="password"]`).Fill(password); err != nil {
+			if err := Fill(ctx, page.Locator(`//form[@data-testid="form-login"]//input[@data-testid="password"]`), password.Reveal()); err != nil {
 				return err
 			}
 
-			return page.Locator(`//form[@data-testid="form-login"]//*[@type="submit"]`).Click()
+			return Click(ctx, page.Locator(`//form[@data-testid="form-login"]//*[@type="submit"]`))
 		})
 	})
 
 	g.Go(func() error {
-		return RunPageLocator(ctx, page.Locator(`//form//input[@id="two-step-verification-otp-code-input" and not(@disabled)]`), func(ctx context.Context, locator playwright.Locator) error {
+		return RunPageLocator(ctx, "otp", page.Locator(`//form//input[@id="two-step-verification-otp-code-input" and not(@disabled)]`), func(ctx context.Context, locator playwright.Locator) error {
 			otpCode, err := s.OTPCodeResolver(ctx)
 			if err != nil {
 				return err
 			}
 
-			return page.Locator(`//form//input[@id="two-step-verification-otp-code-input" and not(@disabled)]`).Fill(otpCode)
+			return Fill(ctx, page.Locator(`//form//input[@id="two-step-verification-otp-code-input" and not(@disabled)]`), otpCode)
 		})
 	})
 
 	g.Go(func() error {
-		return RunPageLocator(ctx, page.Locator(`//*[text()="Continue without two-step verification"]`), func(ctx context.Context, locator playwright.Locator) error {
-			return page.Locator(`//*[text()="Continue without two-step verification"]`).Click()
+		return RunPageLocator(ctx, "atlassianLogin", page.Locator(`//*[text()="Continue without two-step verification"]`), func(ctx context.Context, locator playwright.Locator) error {
+			return Click(ctx, page.Locator(`//*[text()="Continue without two-step verification"]`))
 		})
 	})
 
@@ -73,66 +86,258 @@ func (s *AtlassianLoginHandler) Run(ctx context.Context, page playwright.Page) e
 
 type GetLicenseKeyParams struct {
 	ServerID string
+	Label    string
+	Product  string
+	Edition  string
+	// how long each step of the evaluation form and the generated license are waited for
+	StepTimeout     time.Duration
+	GenerateTimeout time.Duration
+	// Log gets the warnings of the evaluation form, nil discards them
+	Log *zap.Logger
+}
+
+var ErrAtlassianUnavailable = errors.New("atlassian unavailable")
+
+// ErrEvaluationQuota is returned when my.atlassian.com refuses more evaluation licenses of a product.
+var ErrEvaluationQuota = errors.New("evaluation quota exhausted")
+
+// ErrEvaluationLimit is returned when my.atlassian.com refuses more evaluation licenses for the whole account.
+var ErrEvaluationLimit = errors.New("evaluation limit of the account reached")
+
+// evaluationQuotaPattern matches the messages shown instead of a license once evaluations are used up,
+// evaluationLimitPattern tells the ones about the whole account apart. It only matches when the limit is said to
+// belong to the account, e.g. "your account has reached" or "limit for your account", a message that merely mentions
+// an account, like "contact your organization admin", is a quota of the product.
+var (
+	evaluationQuotaPattern = regexp.MustCompile(`(?i)(limit|maximum|quota|too many).*(evaluation|trial)|(evaluation|trial).*(limit|maximum|quota|too many)`)
+	evaluationLimitPattern = regexp.MustCompile(`(?i)\b(your|this) (account|organi[sz]ation) (has )?(reached|exceeded|used up)\b|\b(limit|maximum|quota)\b[^.]*\b(for|per|on) (your |this |the |each |an? )?(account|organi[sz]ation)\b`)
+)
+
+// EvaluationRefused reports whether atlassian refused to generate evaluations, for the product or the account.
+func EvaluationRefused(err error) bool {
+	return errors.Is(err, ErrEvaluationQuota) || errors.Is(err, ErrEvaluationLimit)
+}
+
+// evaluationRefusal returns ErrEvaluationLimit or ErrEvaluationQuota when the evaluation form shows that no more
+// evaluations are generated, and nil otherwise.
+func evaluationRefusal(page playwright.Page, product string) error {
+	messages, err := page.Locator(`.aui-message-error, .aui-message-warning, [role="alert"]`).AllTextContents()
+	if err != nil {
+		return fmt.Errorf("could not read page messages: %w", err)
+	}
+	for _, message := range messages {
+		if err := evaluationMessageRefusal(message, product); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluationMessageRefusal classifies a single message of the evaluation form, see evaluationRefusal.
+func evaluationMessageRefusal(message, product string) error {
+	message = strings.Join(strings.Fields(message), " ")
+	if !evaluationQuotaPattern.MatchString(message) {
+		return nil
+	}
+	if evaluationLimitPattern.MatchString(message) {
+		return fmt.Errorf("%w: %s", ErrEvaluationLimit, message)
+	}
+	return fmt.Errorf("%w for %s: %s", ErrEvaluationQuota, product, message)
+}
+
+func isAtlassianUnavailableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// atlassianServiceResponse reports whether the response is a page or api call of my.atlassian.com or its login,
+// failing analytics, assets and third-party frames do not make atlassian unavailable.
+func atlassianServiceResponse(response playwright.Response) bool {
+	switch response.Request().ResourceType() {
+	case "document", "xhr", "fetch":
+	default:
+		return false
+	}
+	u, err := url.Parse(response.URL())
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == "my.atlassian.com" || host == "id.atlassian.com"
 }
 
 func GetLicenseKey(ctx context.Context, page playwright.Page, params GetLicenseKeyParams) (string, error) {
-	if _, err := page.Goto("https://my.atlassian.com/license/evaluation"); err != nil {
+	if params.Log == nil {
+		params.Log = zap.NewNop()
+	}
+
+	// the status of the last such response, a failure only counts until a later request succeeds
+	var unavailableStatus atomic.Int32
+	onResponse := func(response playwright.Response) {
+		if !atlassianServiceResponse(response) {
+			return
+		}
+		status := int32(0)
+		if isAtlassianUnavailableStatus(response.Status()) {
+			status = int32(response.Status())
+		}
+		unavailableStatus.Store(status)
+	}
+	page.OnResponse(onResponse)
+	defer page.RemoveListener("response", onResponse)
+
+	licenseKey, err := generateLicenseKey(ctx, page, params)
+	if err != nil {
+		// a refused evaluation can show up as a missing form field, the banner tells why
+		if !EvaluationRefused(err) && !page.IsClosed() {
+			if refusal := evaluationRefusal(page, cmp.Or(params.Product, "Jira")); EvaluationRefused(refusal) {
+				return "", refusal
+			}
+		}
+		if status := unavailableStatus.Load(); status != 0 {
+			return "", fmt.Errorf("%w (status %d): %w", ErrAtlassianUnavailable, status, err)
+		}
+		return "", err
+	}
+
+	return licenseKey, nil
+}
+
+// default waits of the evaluation form, see config.AtlassianTimeouts
+const (
+	defaultEvaluationStepTimeout     = 30 * time.Second
+	defaultEvaluationGenerateTimeout = 60 * time.Second
+)
+
+func generateLicenseKey(ctx context.Context, page playwright.Page, params GetLicenseKeyParams) (string, error) {
+	stepTimeout := playwright.Float(float64(cmp.Or(params.StepTimeout, defaultEvaluationStepTimeout).Milliseconds()))
+	generateTimeout := playwright.Float(float64(cmp.Or(params.GenerateTimeout, defaultEvaluationGenerateTimeout).Milliseconds()))
+	visible := func(locator playwright.Locator) error {
+		return WaitFor(ctx, locator, playwright.LocatorWaitForOptions{State: playwright.WaitForSelectorStateVisible, Timeout: stepTimeout})
+	}
+
+	if _, err := Goto(ctx, page, "https://my.atlassian.com/license/evaluation"); err != nil {
 		return "", fmt.Errorf("could not navigate: %w", err)
 	}
 
-	if err := page.Locator(`//select[@id="product-select"]`).Click(); err != nil {
+	product, edition := params.Product, params.Edition
+	if product == "" {
+		product, edition = "Jira", "jira-software.data-center"
+	}
+
+	productSelect := FallbackLocator(
+		page.Locator(`select#product-select`),
+		page.Locator(`select[name="product"]`),
+	)
+
+	if err := TrackSelector(ctx, "atlassian.evaluation.product-select", visible(productSelect)); err != nil {
 		return "", fmt.Errorf("could not select product: %w", err)
 	}
 
-	if _, err := page.Locator(`//select[@id="product-select"]`).SelectOption(playwright.SelectOptionValues{
-		Values: &[]string{"Jira"},
-	}, playwright.LocatorSelectOptionOptions{Force: playwright.Bool(true)}); err != nil {
+	selectTimeout := CallTimeout(ctx, stepTimeout)
+	if err := Await(ctx, func() error {
+		_, err := productSelect.SelectOption(playwright.SelectOptionValues{
+			Values: &[]string{product},
+		}, playwright.LocatorSelectOptionOptions{Force: playwright.Bool(true), Timeout: playwright.Float(2000)})
+		if err != nil {
+			_, err = productSelect.SelectOption(playwright.SelectOptionValues{
+				Labels: &[]string{product},
+			}, playwright.LocatorSelectOptionOptions{Force: playwright.Bool(true), Timeout: selectTimeout})
+		}
+		return err
+	}); err != nil {
 		return "", fmt.Errorf("could not select product: %w", err)
 	}
 
-	time.Sleep(1 * time.Second)
+	// the editions of the product are rendered once the option is selected
+	editionRow := page.Locator(fmt.Sprintf(`[data=%q]`, edition))
+	selectButton := FallbackLocator(
+		editionRow.GetByRole("button", playwright.LocatorGetByRoleOptions{Name: "Select"}),
+		editionRow.Locator(`.aui-button-primary`),
+		editionRow.Locator(`button, .aui-button`),
+	)
 
-	if err := page.Locator(`//*[@data="jira-software.data-center"]//*[text()="Select"]`).Click(); err != nil {
+	if err := TrackSelector(ctx, "atlassian.evaluation.select-dc", visible(selectButton)); err != nil {
 		return "", fmt.Errorf("could not select DC: %w", err)
 	}
-
-	time.Sleep(1 * time.Second)
-
-	if err := page.Locator(`//*[@data="jira-software.data-center"]//*[contains(concat(" ", text(), " "), " aui-button-primary ")]`).Click(playwright.LocatorClickOptions{
-		Timeout: playwright.Float(2),
-	}); err != nil && !errors.Is(err, playwright.ErrTimeout) {
+	if err := Click(ctx, selectButton, playwright.LocatorClickOptions{Timeout: stepTimeout}); err != nil {
 		return "", fmt.Errorf("could not select DC: %w", err)
 	}
 
-	time.Sleep(1 * time.Second)
+	// the form expands below the edition, some editions first ask to confirm the selection with another primary
+	// button in the same row, which is only clicked once it is there instead of the form
+	serverIDInput := FallbackLocator(
+		page.Locator(`input[name="sid"]`),
+		page.GetByLabel("Server ID"),
+	)
+	confirmButton := editionRow.Locator(`.aui-button-primary:visible`).Filter(playwright.LocatorFilterOptions{
+		HasNotText: "Select",
+	}).First()
 
-	if err := page.Locator(`//*[@data="jira-software.data-center"]//*[contains(concat(" ", text(), " "), " aui-button-primary ")]`).Click(playwright.LocatorClickOptions{
-		Timeout: playwright.Float(2),
-	}); err != nil && !errors.Is(err, playwright.ErrTimeout) {
-		return "", fmt.Errorf("could not select DC: %w", err)
+	if err := TrackSelector(ctx, "atlassian.evaluation.server-id", visible(serverIDInput.Or(confirmButton).First())); err != nil {
+		return "", fmt.Errorf("could not find server id field: %w", err)
+	}
+	if shown, err := serverIDInput.IsVisible(); err != nil {
+		return "", fmt.Errorf("could not find server id field: %w", err)
+	} else if !shown {
+		if err := Click(ctx, confirmButton, playwright.LocatorClickOptions{Timeout: stepTimeout}); err != nil {
+			return "", fmt.Errorf("could not confirm DC: %w", err)
+		}
+		if err := TrackSelector(ctx, "atlassian.evaluation.server-id", visible(serverIDInput)); err != nil {
+			return "", fmt.Errorf("could not find server id field: %w", err)
+		}
 	}
 
-	if err := page.Locator(`//input[@name="sid"]`).Fill(params.ServerID); err != nil {
+	if err := Fill(ctx, serverIDInput, params.ServerID, playwright.LocatorFillOptions{Timeout: stepTimeout}); err != nil {
 		return "", fmt.Errorf("could not type in server id: %w", err)
 	}
 
-	if err := page.Locator(`//input[@name="_action_evaluation"]`).Click(); err != nil {
+	// the organization field is part of the same form, it is there by now or not at all. It is found by its
+	// visible label like the server id, its name is not known.
+	if params.Label != "" {
+		labelInput := page.GetByLabel("Organization", playwright.PageGetByLabelOptions{Exact: playwright.Bool(true)})
+		if count, err := labelInput.Count(); err != nil {
+			return "", fmt.Errorf("could not type in label: %w", err)
+		} else if count > 0 {
+			if err := Fill(ctx, labelInput.First(), params.Label, playwright.LocatorFillOptions{Timeout: stepTimeout}); err != nil {
+				return "", fmt.Errorf("could not type in label: %w", err)
+			}
+		} else {
+			params.Log.Warn("no organization field on the evaluation form, generating the evaluation without a label", zap.String("label", params.Label))
+		}
+	}
+
+	if err := TrackSelector(ctx, "atlassian.evaluation.submit", Click(ctx, FallbackLocator(
+		page.Locator(`input[name="_action_evaluation"]`),
+		page.GetByRole("button", playwright.PageGetByRoleOptions{Name: "Generate license"}),
+	), playwright.LocatorClickOptions{Timeout: stepTimeout})); err != nil {
 		return "", fmt.Errorf("could generate license: %w", err)
 	}
 
-	if err := page.WaitForLoadState(playwright.PageWaitForLoadStateOptions{
-		State: playwright.LoadStateLoad,
+	if err := Await(ctx, func() error {
+		return page.WaitForLoadState(playwright.PageWaitForLoadStateOptions{
+			State:   playwright.LoadStateLoad,
+			Timeout: CallTimeout(ctx, generateTimeout),
+		})
 	}); err != nil {
 		return "", fmt.Errorf("could not wait for load state: %w", err)
 	}
 
+	if err := evaluationRefusal(page, product); err != nil {
+		return "", err
+	}
+
 	url, err := url.Parse(page.URL())
 	if err != nil {
 		return "", fmt.Errorf("could not parse page url: %w", err)
 	}
 
-	licenseKey, err := page.Locator(fmt.Sprintf(`//tr[@id="%s"]/following::tr[@class="evaluation"][1]//textarea`, url.Fragment)).InputValue()
-	if err != nil {
+	licenseKeyInput := page.Locator(fmt.Sprintf(`//tr[@id="%s"]/following::tr[@class="evaluation"][1]//textarea`, url.Fragment))
+	err = WaitFor(ctx, licenseKeyInput, playwright.LocatorWaitForOptions{State: playwright.WaitForSelectorStateAttached, Timeout: generateTimeout})
+	var licenseKey string
+	if err == nil {
+		licenseKey, err = licenseKeyInput.InputValue()
+	}
+	if err := TrackSelector(ctx, "atlassian.evaluation.license-key", err); err != nil {
 		return "", fmt.Errorf("could not find license key: %w", err)
 	}
 
@@ -140,3 +345,274 @@ func GetLicenseKey(ctx context.Context, page playwright.Page, params GetLicenseK
 
 	return licenseKey, nil
 }
+
+// FallbackLocator matches the first element found by any of the locators, in order of preference.
+func FallbackLocator(locators ...playwright.Locator) playwright.Locator {
+	locator := locators[0]
+	for _, other := range locators[1:] {
+		locator = locator.Or(other)
+	}
+	return locator.First()
+}
+
+func StartAtlassianPage(ctx context.Context, g *errgroup.Group, browserContext playwright.BrowserContext, cfg config.Atlassian) (playwright.Page, error) {
+	page, err := browserContext.NewPage()
+	if err != nil {
+		return nil, fmt.Errorf("could not create page: %w", err)
+	}
+
+	if err := SetAtlassianLocale(browserContext, page, cfg.Locale); err != nil {
+		_ = page.Close()
+		return nil, err
+	}
+
+	// a crashed page is closed, so it is opened again by the next caller
+	page.OnCrash(func(playwright.Page) {
+		_ = page.Close()
+	})
+
+	g.Go(func() error {
+		defer page.Close()
+		<-ctx.Done()
+		return nil
+	})
+
+	_ = g.TryGo(func() error {
+		err := (&AtlassianLoginHandler{
+			UsernameResolver: func(ctx context.Context) (string, error) {
+				creds, err := credentials.ResolveCredentials(ctx, cfg.Account)
+				if err != nil {
+					return "", err
+				}
+				return creds.Username, nil
+			},
+			PasswordResolver: func(ctx context.Context) (credentials.Secret, error) {
+				creds, err := credentials.ResolveCredentials(ctx, cfg.Account)
+				if err != nil {
+					return credentials.Secret{}, err
+				}
+				return creds.Password, nil
+			},
+			OTPCodeResolver: func(ctx context.Context) (string, error) {
+				chain := cfg.OTP
+				if cfg.TOTPSecret != "" {
+					chain = append(config.OTPChain{{TOTP: &config.OTPTOTP{Secret: cfg.TOTPSecret}}}, chain...)
+				}
+				return otp.ResolveOTP(ctx, chain)
+			},
+		}).Run(ctx, page)
+		// the page was replaced, the run goes on
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	})
+
+	return page, nil
+}
+
+func SetAtlassianLocale(browserContext playwright.BrowserContext, page playwright.Page, locale string) error {
+	if locale == "auto" {
+		return nil
+	}
+	if locale == "" {
+		locale = "en-US"
+	}
+
+	language, _, _ := strings.Cut(locale, "-")
+	if err := page.SetExtraHTTPHeaders(map[string]string{
+		"Accept-Language": fmt.Sprintf("%s,%s;q=0.9", locale, language),
+	}); err != nil {
+		return fmt.Errorf("could not set locale: %w", err)
+	}
+
+	if err := browserContext.AddCookies([]playwright.OptionalCookie{
+		{
+			Name:   "lang",
+			Value:  strings.ReplaceAll(locale, "-", "_"),
+			Domain: playwright.String(".atlassian.com"),
+			Path:   playwright.String("/"),
+		},
+	}); err != nil {
+		return fmt.Errorf("could not set locale cookie: %w", err)
+	}
+
+	return nil
+}
+
+func WaitForAtlassianLogin(ctx context.Context, page playwright.Page, timeout time.Duration) error {
+	if _, err := Goto(ctx, page, "https://my.atlassian.com/"); err != nil {
+		return fmt.Errorf("could not navigate: %w", err)
+	}
+
+	if err := page.WaitForURL("https://my.atlassian.com/**", playwright.PageWaitForURLOptions{
+		Timeout: playwright.Float(float64(timeout.Milliseconds())),
+	}); err != nil {
+		return fmt.Errorf("login did not complete: %w", err)
+	}
+
+	return nil
+}
+
+type AtlassianLicense struct {
+	Product    string     `json:"product"`
+	SEN        string     `json:"sen"`
+	ServerID   string     `json:"serverId"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	Evaluation bool       `json:"evaluation"`
+	// not exported by the licenses command
+	LicenseKey string `json:"-"`
+}
+
+func ListAtlassianLicenses(ctx context.Context, page playwright.Page) ([]AtlassianLicense, error) {
+	if _, err := Goto(ctx, page, "https://my.atlassian.com/products/index"); err != nil {
+		return nil, fmt.Errorf("could not navigate: %w", err)
+	}
+
+	if err := page.WaitForLoadState(playwright.PageWaitForLoadStateOptions{
+		State: playwright.LoadStateLoad,
+	}); err != nil {
+		return nil, fmt.Errorf("could not wait for load state: %w", err)
+	}
+
+	rows, err := page.Locator(`//tr[@id][following-sibling::tr[1]//textarea]`).All()
+	if err != nil {
+		return nil, fmt.Errorf("could not find licenses: %w", err)
+	}
+
+	licenses := make([]AtlassianLicense, 0, len(rows))
+
+	for _, row := range rows {
+		product, err := row.Locator(`td`).First().InnerText()
+		if err != nil {
+			return nil, fmt.Errorf("could not read product: %w", err)
+		}
+
+		license := AtlassianLicense{
+			Product: strings.TrimSpace(product),
+		}
+
+		details := row.Locator(`xpath=following-sibling::tr[1]`)
+
+		class, err := details.GetAttribute("class")
+		if err != nil {
+			return nil, fmt.Errorf("could not read license details: %w", err)
+		}
+		license.Evaluation = strings.Contains(class, "evaluation")
+
+		licenseKey, err := details.Locator(`textarea`).First().InputValue()
+		if err != nil {
+			return nil, fmt.Errorf("could not read license key: %w", err)
+		}
+		license.LicenseKey = strings.ReplaceAll(licenseKey, "\n", "")
+
+		fields, err := details.Locator(`dt`).All()
+		if err != nil {
+			return nil, fmt.Errorf("could not read license details: %w", err)
+		}
+
+		for _, field := range fields {
+			name, err := field.InnerText()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := field.Locator(`xpath=following-sibling::dd[1]`).InnerText()
+			if err != nil {
+				return nil, err
+			}
+			value = strings.TrimSpace(value)
+
+			switch strings.TrimSuffix(strings.TrimSpace(name), ":") {
+			case "SEN", "Support Entitlement Number":
+				license.SEN = value
+
+			case "Server ID":
+				license.ServerID = value
+
+			case "Expiry", "Expiry date", "License expiry":
+				if date, err := dates.Parse(value, time.Now()); err == nil {
+					license.ExpiresAt = &date
+				}
+			}
+		}
+
+		licenses = append(licenses, license)
+	}
+
+	return licenses, nil
+}
+
+// evaluationEditionNames are the product names my.atlassian.com lists the licenses of an edition under.
+var evaluationEditionNames = map[string][]string{
+	"jira-software.data-center":    {"Jira Software", "Jira"},
+	"jira-servicedesk.data-center": {"Jira Service Management", "Jira Service Desk"},
+	"jira-core.data-center":        {"Jira Core", "Jira Work Management"},
+	"confluence.data-center":       {"Confluence"},
+	"bitbucket.data-center":        {"Bitbucket"},
+}
+
+var licenseProductSuffixPattern = regexp.MustCompile(`(?i)\s*(\(?data center\)?|\(?server\)?)$`)
+
+func evaluationProductMatches(listed string, params GetLicenseKeyParams) bool {
+	names, ok := evaluationEditionNames[params.Edition]
+	if !ok {
+		names = []string{params.Product}
+	}
+	listed = strings.TrimSpace(licenseProductSuffixPattern.ReplaceAllString(strings.TrimSpace(listed), ""))
+	for _, name := range names {
+		if strings.EqualFold(listed, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindReusableEvaluation returns the evaluation of the account for the server id and product of params
+// that is valid until validUntil, the one valid the longest when there are several.
+func FindReusableEvaluation(licenses []AtlassianLicense, params GetLicenseKeyParams, validUntil time.Time) (AtlassianLicense, bool) {
+	var (
+		found AtlassianLicense
+		ok    bool
+	)
+	for _, license := range licenses {
+		if !license.Evaluation || license.LicenseKey == "" || license.ExpiresAt == nil || !license.ExpiresAt.After(validUntil) {
+			continue
+		}
+		if !strings.EqualFold(license.ServerID, params.ServerID) || !evaluationProductMatches(license.Product, params) {
+			continue
+		}
+		if !ok || license.ExpiresAt.After(*found.ExpiresAt) {
+			found, ok = license, true
+		}
+	}
+	return found, ok
+}
+
+func WriteAtlassianLicensesCSV(w io.Writer, licenses []AtlassianLicense) error {
+	cw := csv.NewWriter(w)
+
+	if err := cw.Write([]string{"product", "sen", "server id", "expires at", "evaluation"}); err != nil {
+		return err
+	}
+
+	for _, license := range licenses {
+		expiresAt := ""
+		if license.ExpiresAt != nil {
+			expiresAt = FormatDate(*license.ExpiresAt)
+		}
+
+		if err := cw.Write([]string{
+			license.Product,
+			license.SEN,
+			license.ServerID,
+			expiresAt,
+			strconv.FormatBool(license.Evaluation),
+		}); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvaluationMessageRefusal(t *testing.T) {
+	tests := []struct {
+		message string
+		want    error
+	}{
+		{"You have reached the maximum number of evaluation licenses for this product.", ErrEvaluationQuota},
+		{"You've reached the limit of trial licenses for Jira Software. Contact your organization admin to purchase a license.", ErrEvaluationQuota},
+		{"Too many evaluation licenses have been generated. Sign in with another account to continue.", ErrEvaluationQuota},
+		{"Evaluation limit reached. Manage your account at my.atlassian.com.", ErrEvaluationQuota},
+		{"Your account has reached the maximum number of evaluation licenses.", ErrEvaluationLimit},
+		{"Your organization has reached its evaluation license limit.", ErrEvaluationLimit},
+		{"You have reached the limit of evaluation licenses for your account.", ErrEvaluationLimit},
+		{"The   maximum of trial licenses\n per organisation has been reached.", ErrEvaluationLimit},
+		{"Your account has been created.", nil},
+		{"Enter a valid server ID.", nil},
+	}
+
+	for _, test := range tests {
+		err := evaluationMessageRefusal(test.message, "jira-software")
+		switch {
+		case test.want == nil && err != nil:
+			t.Errorf("evaluationMessageRefusal(%q): got %v, want nil", test.message, err)
+		case test.want != nil && !errors.Is(err, test.want):
+			t.Errorf("evaluationMessageRefusal(%q): got %v, want %v", test.message, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var ErrAuditRecordNotFound = errors.New("no license audit record found")
+
+// AuditRecord is an entry of the audit log of an instance.
+type AuditRecord struct {
+	ID     string
+	Action string
+	Time   time.Time
+}
+
+// FindLicenseAuditRecord looks for a license update in the audit log of the instance since the given time, in the
+// auditing api of data center 8.8+ first, then in the older audit records of jira.
+func FindLicenseAuditRecord(ctx context.Context, client *RESTClient, since time.Time) (*AuditRecord, error) {
+	var events struct {
+		Entities []struct {
+			ID        json.RawMessage `json:"id"`
+			Timestamp time.Time       `json:"timestamp"`
+			Type      struct {
+				Action        string `json:"action"`
+				ActionI18nKey string `json:"actionI18nKey"`
+			} `json:"type"`
+		} `json:"entities"`
+	}
+	query := url.Values{"from": {since.UTC().Format(time.RFC3339)}, "limit": {"200"}}
+	eventsErr := client.GetJSON(ctx, "/rest/auditing/1.0/events?"+query.Encode(), &events)
+	if eventsErr == nil {
+		for _, entity := range events.Entities {
+			if !isLicenseAuditAction(entity.Type.Action, entity.Type.ActionI18nKey) || entity.Timestamp.Before(since) {
+				continue
+			}
+			id := auditRecordID(entity.ID)
+			if id == "" {
+				id = entity.Timestamp.UTC().Format(time.RFC3339Nano)
+			}
+			return &AuditRecord{ID: id, Action: entity.Type.Action, Time: entity.Timestamp}, nil
+		}
+		return nil, ErrAuditRecordNotFound
+	}
+
+	var records struct {
+		Records []struct {
+			ID      json.RawMessage `json:"id"`
+			Summary string          `json:"summary"`
+			Created string          `json:"created"`
+		} `json:"records"`
+	}
+	query = url.Values{"filter": {"license"}, "from": {since.UTC().Format("2006-01-02T15:04:05.000-0700")}}
+	if err := client.GetJSON(ctx, "/rest/api/2/auditing/record?"+query.Encode(), &records); err != nil {
+		return nil, fmt.Errorf("could not read audit log: %w", errors.Join(eventsErr, err))
+	}
+	for _, record := range records.Records {
+		if !isLicenseAuditAction(record.Summary, "") {
+			continue
+		}
+		created, _ := time.Parse("2006-01-02T15:04:05.000-0700", record.Created)
+		return &AuditRecord{ID: auditRecordID(record.ID), Action: record.Summary, Time: created}, nil
+	}
+	return nil, ErrAuditRecordNotFound
+}
+
+// auditRecordID accepts numeric and string ids.
+func auditRecordID(raw json.RawMessage) string {
+	return strings.Trim(string(raw), `"`)
+}
+
+func isLicenseAuditAction(action, key string) bool {
+	return strings.Contains(strings.ToLower(action), "license") || strings.Contains(strings.ToLower(key), "license")
+}
+
+// WaitForLicenseAuditRecord retries FindLicenseAuditRecord, the record can be written after the update returned.
+func WaitForLicenseAuditRecord(ctx context.Context, log *zap.Logger, client *RESTClient, since time.Time, attempts int, interval time.Duration) (*AuditRecord, error) {
+	for attempt := 1; ; attempt++ {
+		record, err := FindLicenseAuditRecord(ctx, client, since)
+		if err == nil || attempt >= attempts || !errors.Is(err, ErrAuditRecordNotFound) {
+			return record, err
+		}
+		log.Debug("license audit record not found yet, retrying", zap.Int("attempt", attempt))
+		if err := sleepContext(ctx, interval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// AuditEntry is a line of the audit log of this tool, one per applied license.
+type AuditEntry struct {
+	Time              time.Time  `json:"time"`
+	RunID             string     `json:"runId,omitempty"`
+	Instance          string     `json:"instance"`
+	BaseURL           string     `json:"baseUrl"`
+	Application       string     `json:"application,omitempty"`
+	SEN               string     `json:"sen,omitempty"`
+	LicenseKeyHash    string     `json:"licenseKeyHash"`
+	PreviousExpiresAt *time.Time `json:"previousExpiresAt,omitempty"`
+	ExpiresAt         *time.Time `json:"expiresAt,omitempty"`
+	// the license update record in the audit log of the instance, with verifyAuditLog
+	InstanceAuditID string `json:"instanceAuditId,omitempty"`
+	AuditError      string `json:"auditError,omitempty"`
+}
+
+// AuditLogKey is the audit log in the storage backend, data/audit.ndjson by default.
+const AuditLogKey = "audit.ndjson"
+
+var auditLogMu sync.Mutex
+
+// AppendAuditEntry appends the entry to the audit log, instances renewed in parallel share the file.
+func AppendAuditEntry(entry AuditEntry) error {
+	auditLogMu.Lock()
+	defer auditLogMu.Unlock()
+
+	backend, err := DataStorage()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := backend.Append(AuditLogKey, append(data, '\n')); err != nil {
+		return fmt.Errorf("could not write audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+type Backoff struct {
+	Base time.Duration
+	Max  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	until    time.Time
+}
+
+func (b *Backoff) Wait(ctx context.Context) error {
+	b.mu.Lock()
+	delay := time.Until(b.until)
+	b.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (b *Backoff) Failure() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+
+	delay := b.Base
+	for i := 1; i < b.failures && delay < b.Max; i++ {
+		delay *= 2
+	}
+	delay = min(delay, b.Max)
+	delay += rand.N(delay/2 + 1)
+
+	b.until = time.Now().Add(delay)
+	return delay
+}
+
+func (b *Backoff) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.until = time.Time{}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+type LicenseBackup struct {
+	Instance       string     `json:"instance"`
+	BaseURL        string     `json:"baseURL"`
+	ApplicationKey string     `json:"applicationKey,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	LicenseKey     string     `json:"licenseKey,omitempty"`
+	SEN            string     `json:"sen,omitempty"`
+	LicenseType    string     `json:"licenseType,omitempty"`
+	TrialExpiresAt *time.Time `json:"trialExpiresAt,omitempty"`
+}
+
+func LicenseBackupDir(instance string) string {
+	return DataPath("backups", SafeFileName(instance))
+}
+
+// WriteLicenseBackup saves the license that is about to be replaced to data/backups/<instance>/<timestamp>.json.
+func WriteLicenseBackup(backup LicenseBackup) (string, error) {
+	dir := LicenseBackupDir(backup.Instance)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("error creating backup directory: %w", err)
+	}
+
+	name := backup.CreatedAt.UTC().Format("20060102T150405")
+	if backup.ApplicationKey != "" {
+		name += "-" + SafeFileName(backup.ApplicationKey)
+	}
+	path := filepath.Join(dir, name+".json")
+
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return "", fmt.Errorf("error writing backup: %w", err)
+	}
+	return path, nil
+}
+
+func ReadLicenseBackup(path string) (*LicenseBackup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup: %w", err)
+	}
+
+	var backup LicenseBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("error decoding backup: %w", err)
+	}
+	return &backup, nil
+}
+
+// ListLicenseBackups returns the backups of an instance, newest first.
+func ListLicenseBackups(instance string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(LicenseBackupDir(instance), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	slices.Reverse(paths)
+	return paths, nil
+}
@@ -0,0 +1,589 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+func LoadConfig(path string) (*config.Config, error) {
+	var cfg config.Config
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+	defer file.Close()
+
+	var document yaml.Node
+	if err := yaml.NewDecoder(file).Decode(&document); err != nil {
+		return nil, fmt.Errorf("error decoding config: %w", err)
+	}
+	if err := config.Interpolate(&document, os.LookupEnv); err != nil {
+		return nil, fmt.Errorf("error interpolating config: %w", err)
+	}
+	if err := document.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("error decoding config: %w", err)
+	}
+
+	if err := ConfigureDates(&cfg); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateConfig(&cfg); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+type Browser struct {
+	// shared by all instances, nil when sessions are isolated
+	Context playwright.BrowserContext
+
+	pw          *playwright.Playwright
+	browserType playwright.BrowserType
+	browser     playwright.Browser
+	// headless, channel and executable path of every launch
+	launchOptions playwright.BrowserTypeLaunchOptions
+	isolated      bool
+	// playwright.navigationTimeout and playwright.actionTimeout, applied to every context
+	navigationTimeout time.Duration
+	actionTimeout     time.Duration
+	// set once the browser or the shared context is gone, e.g. after a crash
+	disconnected atomic.Bool
+	// the shared context was created over cdp or a playwright server, it has no profile that keeps the atlassian login
+	ephemeral bool
+
+	// session keys that get their own context even when the others share one
+	mu                sync.Mutex
+	isolatedKeys      map[string]bool
+	atlassianRestored bool
+}
+
+func OpenBrowser(cfg *config.Config) (*Browser, error) {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating data directory: %w", err)
+	}
+
+	browserName := BrowserName(cfg.Playwright)
+	runOptions := &playwright.RunOptions{
+		DriverDirectory: DataPath("playwright"),
+		Browsers:        []string{browserName},
+	}
+	// a branded or custom browser is installed by other means
+	if cfg.Playwright.Channel != "" || cfg.Playwright.ExecutablePath != "" {
+		runOptions.SkipInstallBrowsers = true
+		runOptions.Browsers = []string{}
+	}
+
+	if err := EnsurePlaywright(runOptions, cfg.Playwright); err != nil {
+		return nil, err
+	}
+
+	pw, err := playwright.Run(runOptions)
+	if err != nil {
+		ForgetPlaywrightInstall()
+		return nil, fmt.Errorf("could not run playwright: %w", err)
+	}
+	// without a manifest the next start installs again, which is slower but not fatal
+	_ = RecordPlaywrightInstall(pw, runOptions)
+
+	b := &Browser{
+		pw:                pw,
+		browserType:       browserType(pw, browserName),
+		isolated:          cfg.Playwright.IsolateSessions,
+		navigationTimeout: cfg.Playwright.NavigationTimeout,
+		actionTimeout:     cfg.Playwright.ActionTimeout,
+		isolatedKeys:      map[string]bool{},
+		launchOptions: playwright.BrowserTypeLaunchOptions{
+			Headless: playwright.Bool(!cfg.Playwright.Headful),
+		},
+	}
+	if cfg.Playwright.Channel != "" {
+		b.launchOptions.Channel = playwright.String(cfg.Playwright.Channel)
+	}
+	if cfg.Playwright.ExecutablePath != "" {
+		b.launchOptions.ExecutablePath = playwright.String(cfg.Playwright.ExecutablePath)
+	}
+	if !b.isolated {
+		for _, collision := range SessionCollisions(cfg.Instances) {
+			for _, instance := range collision.Instances {
+				b.isolatedKeys[InstanceSessionKey(instance)] = true
+			}
+		}
+	}
+
+	if ep := cfg.Playwright.Endpoint; ep != "" {
+		// only chromium speaks cdp, firefox and webkit connect to a playwright server (playwright run-server)
+		if browserName == "chromium" {
+			b.browser, err = b.browserType.ConnectOverCDP(ep)
+		} else {
+			b.browser, err = b.browserType.Connect(ep)
+		}
+		if err != nil {
+			_ = b.Close()
+			return nil, fmt.Errorf("could not connect to browser: %w", err)
+		}
+
+		if !b.isolated {
+			b.Context, err = b.browser.NewContext()
+			if err != nil {
+				_ = b.Close()
+				return nil, fmt.Errorf("error creating browser context: %w", err)
+			}
+			b.ephemeral = true
+		}
+	} else if b.isolated {
+		// sessions live in data/contexts instead of a browser profile
+		b.browser, err = b.browserType.Launch(b.launchOptions)
+		if err != nil {
+			_ = b.Close()
+			ForgetPlaywrightInstall()
+			return nil, fmt.Errorf("could not launch browser: %w", err)
+		}
+	} else {
+		// profiles of one browser cannot be opened by another
+		profileDir := "browser"
+		if browserName != "chromium" {
+			profileDir = "browser-" + browserName
+		}
+		userDataDir := DataPath(profileDir)
+		if cfg.Profile != "" {
+			userDataDir = DataPath("profiles", cfg.Profile, profileDir)
+		}
+
+		stray, err := FindStrayBrowserProcesses(userDataDir)
+		if err != nil {
+			stray = nil
+		}
+		if len(stray) > 0 && cfg.Playwright.KillStrayProcesses {
+			if err := KillProcesses(stray); err != nil {
+				_ = b.Close()
+				return nil, fmt.Errorf("could not terminate stray browser processes %v: %w", stray, err)
+			}
+			_ = os.Remove(filepath.Join(userDataDir, "SingletonLock"))
+			stray = nil
+		}
+
+		b.Context, err = b.browserType.LaunchPersistentContext(userDataDir, playwright.BrowserTypeLaunchPersistentContextOptions{
+			Headless:       b.launchOptions.Headless,
+			Channel:        b.launchOptions.Channel,
+			ExecutablePath: b.launchOptions.ExecutablePath,
+		})
+		if err != nil {
+			_ = b.Close()
+			if len(stray) > 0 {
+				return nil, fmt.Errorf("could not launch browser, profile %s is used by stray processes %v (set playwright.killStrayProcesses to terminate them): %w", userDataDir, stray, err)
+			}
+			ForgetPlaywrightInstall()
+			return nil, fmt.Errorf("could not launch browser: %w", err)
+		}
+	}
+	if b.Context != nil {
+		b.applyTimeouts(b.Context)
+		b.Context.OnClose(func(playwright.BrowserContext) {
+			b.disconnected.Store(true)
+		})
+	}
+	if b.browser != nil {
+		b.watchDisconnect(b.browser)
+	}
+
+	return b, nil
+}
+
+func (b *Browser) watchDisconnect(browser playwright.Browser) {
+	browser.OnDisconnected(func(playwright.Browser) {
+		b.disconnected.Store(true)
+	})
+}
+
+// Connected reports whether the browser is still running, a closed page or context of an instance does not stop it.
+func (b *Browser) Connected() bool {
+	return !b.disconnected.Load()
+}
+
+// BrowserName returns playwright.browser, chromium when unset.
+func BrowserName(cfg config.Playwright) string {
+	if cfg.Browser == "" {
+		return "chromium"
+	}
+	return cfg.Browser
+}
+
+func browserType(pw *playwright.Playwright, name string) playwright.BrowserType {
+	switch name {
+	case "firefox":
+		return pw.Firefox
+	case "webkit":
+		return pw.WebKit
+	default:
+		return pw.Chromium
+	}
+}
+
+// applyTimeouts makes the configured timeouts the defaults of the calls that pass none, e.g. waits of locator handlers.
+func (b *Browser) applyTimeouts(browserContext playwright.BrowserContext) {
+	if b.navigationTimeout > 0 {
+		browserContext.SetDefaultNavigationTimeout(float64(b.navigationTimeout.Milliseconds()))
+	}
+	if b.actionTimeout > 0 {
+		browserContext.SetDefaultTimeout(float64(b.actionTimeout.Milliseconds()))
+	}
+}
+
+// SessionContext holds the cookies and storage of one instance or atlassian account.
+type SessionContext struct {
+	playwright.BrowserContext
+
+	// empty for the shared context
+	statePath string
+	// the atlassian session of an ephemeral shared context, saved as a session file
+	exportPath string
+}
+
+// SessionContext returns the context for a session key. With playwright.isolateSessions every key gets its own
+// context, restored from and saved to data/contexts; otherwise all keys share the browser profile, except
+// instances whose single sign-on domain collides with an instance of another account.
+func (b *Browser) SessionContext(key string) (*SessionContext, error) {
+	if !b.isolated && !b.isolatedKeys[key] {
+		return &SessionContext{BrowserContext: b.Context}, nil
+	}
+
+	// a persistent profile has no browser to create other contexts in
+	b.mu.Lock()
+	if b.browser == nil {
+		browser, err := b.browserType.Launch(b.launchOptions)
+		if err != nil {
+			b.mu.Unlock()
+			return nil, fmt.Errorf("could not launch browser for isolated sessions: %w", err)
+		}
+		b.browser = browser
+		b.watchDisconnect(browser)
+	}
+	b.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(key))
+	statePath := DataPath("contexts", hex.EncodeToString(sum[:8])+".json")
+
+	var options playwright.BrowserNewContextOptions
+	if _, err := os.Stat(statePath); err == nil {
+		options.StorageStatePath = playwright.String(statePath)
+	}
+
+	browserContext, err := b.browser.NewContext(options)
+	if err != nil {
+		return nil, fmt.Errorf("error creating browser context: %w", err)
+	}
+	b.applyTimeouts(browserContext)
+
+	return &SessionContext{BrowserContext: browserContext, statePath: statePath}, nil
+}
+
+// AtlassianSession returns the session of the atlassian account. A browser connected over cdp keeps no profile,
+// so its session is restored from data/atlassian-session.json and Save writes it back, which spares the login
+// and its two-step verification on the next run.
+func (b *Browser) AtlassianSession(account config.Account) (*SessionContext, error) {
+	session, err := b.SessionContext(AtlassianSessionKey(account))
+	if err != nil || session.statePath != "" || !b.ephemeral {
+		return session, err
+	}
+	session.exportPath = atlassianSessionFile()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.atlassianRestored {
+		return session, nil
+	}
+	b.atlassianRestored = true
+
+	state, err := ReadSessionFile(session.exportPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return session, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := ImportSession(session.BrowserContext, state); err != nil {
+		return nil, fmt.Errorf("could not restore atlassian session: %w", err)
+	}
+	return session, nil
+}
+
+// Save writes the cookies and storage of an isolated context or the atlassian session of an ephemeral one, so the
+// next run starts logged in.
+func (c *SessionContext) Save() error {
+	if c.exportPath != "" {
+		state, err := ExportSession(c.BrowserContext, atlassianSessionDomains)
+		if err != nil {
+			return err
+		}
+		return WriteSessionFile(c.exportPath, state)
+	}
+	if c.statePath == "" {
+		return nil
+	}
+
+	state, err := c.StorageState()
+	if err != nil {
+		return fmt.Errorf("could not read storage state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.statePath), 0700); err != nil {
+		return fmt.Errorf("error creating contexts directory: %w", err)
+	}
+	return WriteSessionFile(c.statePath, state)
+}
+
+// Close saves and closes an isolated context, the shared context stays open.
+func (c *SessionContext) Close() error {
+	if c.statePath == "" {
+		return nil
+	}
+
+	err := c.Save()
+	_ = c.BrowserContext.Close()
+	return err
+}
+
+// NewSessionPage opens a page in the session of key, closing it also saves the session.
+func (b *Browser) NewSessionPage(key string) (playwright.Page, func(), error) {
+	session, err := b.SessionContext(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page, err := session.NewPage()
+	if err != nil {
+		_ = session.Close()
+		return nil, nil, fmt.Errorf("could not create page: %w", err)
+	}
+
+	return page, func() {
+		_ = page.Close()
+		_ = session.Close()
+	}, nil
+}
+
+func (b *Browser) Close() error {
+	if b.Context != nil {
+		_ = b.Context.Close()
+	}
+	if b.browser != nil {
+		_ = b.browser.Close()
+	}
+	return b.pw.Stop()
+}
+
+func IsBrowserCrash(err error) bool {
+	return errors.Is(err, playwright.ErrTargetClosed)
+}
+
+func recycleReason(cfg config.Playwright, launchedAt time.Time, instancesSinceLaunch int) string {
+	if cfg.Endpoint != "" {
+		return ""
+	}
+
+	if n := cfg.Recycle.EveryInstances; n > 0 && instancesSinceLaunch >= n {
+		return fmt.Sprintf("processed %d instances", instancesSinceLaunch)
+	}
+
+	if every := cfg.Recycle.Every; every > 0 && time.Since(launchedAt) >= every {
+		return fmt.Sprintf("running for %s", time.Since(launchedAt).Round(time.Minute))
+	}
+
+	if limit := cfg.Recycle.MaxMemoryMB; limit > 0 {
+		if usage, err := BrowserMemoryUsage(); err == nil && usage/1024/1024 > limit {
+			return fmt.Sprintf("using %d MB of memory", usage/1024/1024)
+		}
+	}
+
+	return ""
+}
+
+// BrowserPool shares one browser between parallel instances, each instance works on its own page.
+type BrowserPool struct {
+	cfg *config.Config
+
+	mu         sync.Mutex
+	idle       *sync.Cond
+	browser    *Browser
+	generation int
+	active     int
+	// active leases waiting in Relaunch for the others to drain
+	relaunching          int
+	launchedAt           time.Time
+	instancesSinceLaunch int
+}
+
+type BrowserLease struct {
+	Browser    *Browser
+	Session    *SessionContext
+	Page       playwright.Page
+	generation int
+
+	key string
+	log *zap.Logger
+}
+
+func NewBrowserPool(cfg *config.Config) (*BrowserPool, error) {
+	p := &BrowserPool{cfg: cfg}
+	p.idle = sync.NewCond(&p.mu)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.launchLocked(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *BrowserPool) launchLocked() error {
+	if p.browser != nil {
+		_ = p.browser.Close()
+		p.browser = nil
+	}
+
+	b, err := OpenBrowser(p.cfg)
+	if err != nil {
+		return err
+	}
+
+	p.browser = b
+	p.generation++
+	p.launchedAt, p.instancesSinceLaunch = time.Now(), 0
+	return nil
+}
+
+// Acquire opens a page in the session of key, recycling the browser first when it is due and no instance is using it.
+func (p *BrowserPool) Acquire(log *zap.Logger, key string) (*BrowserLease, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if reason := recycleReason(p.cfg.Playwright, p.launchedAt, p.instancesSinceLaunch); reason != "" {
+		for p.active > 0 {
+			p.idle.Wait()
+		}
+		if reason := recycleReason(p.cfg.Playwright, p.launchedAt, p.instancesSinceLaunch); reason != "" {
+			log.Info("recycling browser", zap.String("reason", reason))
+			if err := p.launchLocked(); err != nil {
+				return nil, fmt.Errorf("recycling browser: %w", err)
+			}
+		}
+	}
+
+	lease := &BrowserLease{key: key, log: log}
+	if err := p.openLocked(lease); err != nil {
+		// a connected browser is still used by other instances, only a disconnected one is replaced
+		if p.browser.Connected() {
+			return nil, err
+		}
+		if err := p.relaunchLocked(p.generation); err != nil {
+			return nil, fmt.Errorf("relaunching browser: %w", err)
+		}
+		if err := p.openLocked(lease); err != nil {
+			return nil, err
+		}
+	}
+
+	p.active++
+	p.instancesSinceLaunch++
+	return lease, nil
+}
+
+func (p *BrowserPool) openLocked(lease *BrowserLease) error {
+	session, err := p.browser.SessionContext(lease.key)
+	if err != nil {
+		return err
+	}
+
+	page, err := session.NewPage()
+	if err != nil {
+		_ = session.Close()
+		return fmt.Errorf("could not create page: %w", err)
+	}
+
+	lease.Browser, lease.Session, lease.Page, lease.generation = p.browser, session, page, p.generation
+	return nil
+}
+
+func (p *BrowserPool) Release(lease *BrowserLease) {
+	_ = lease.Page.Close()
+	if err := lease.Session.Close(); err != nil {
+		lease.log.Warn("could not save browser session", zap.Error(err))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.active--
+	p.idle.Broadcast()
+}
+
+// Relaunch opens a new page for the lease after its page or browser crashed. The browser is only replaced when it
+// is disconnected, and only once the other instances using it are done or waiting here too; they reuse the browser
+// launched by the first of them.
+func (p *BrowserPool) Relaunch(lease *BrowserLease) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.generation == lease.generation && p.browser.Connected() {
+		// only the page of this instance is gone, the others keep the browser
+		_ = lease.Page.Close()
+		if err := lease.Session.Close(); err != nil {
+			lease.log.Warn("could not save browser session", zap.Error(err))
+		}
+		return p.openLocked(lease)
+	}
+
+	p.relaunching++
+	p.idle.Broadcast()
+	err := p.relaunchLocked(lease.generation)
+	p.relaunching--
+	if err != nil {
+		return err
+	}
+
+	return p.openLocked(lease)
+}
+
+// relaunchLocked replaces the browser of generation once every active lease is done or waiting in Relaunch, unless
+// another caller already did.
+func (p *BrowserPool) relaunchLocked(generation int) error {
+	for p.generation == generation && p.active > p.relaunching {
+		p.idle.Wait()
+	}
+	if p.generation != generation {
+		return nil
+	}
+
+	if err := p.launchLocked(); err != nil {
+		return err
+	}
+	p.idle.Broadcast()
+	return nil
+}
+
+func (p *BrowserPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.browser == nil {
+		return nil
+	}
+	err := p.browser.Close()
+	p.browser = nil
+	return err
+}
@@ -0,0 +1,1113 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/credentials"
+	"github.com/tarik02/jira-auto-trial/grpcapi"
+	"github.com/tarik02/jira-auto-trial/state"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/term"
+)
+
+type Command struct {
+	Name        string
+	Usage       string
+	Run         func(ctx context.Context, log *zap.Logger, args []string) error
+	Subcommands []*Command
+}
+
+func (c *Command) Execute(ctx context.Context, log *zap.Logger, args []string) error {
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		for _, sub := range c.Subcommands {
+			if sub.Name == args[0] {
+				return sub.Execute(ctx, log, args[1:])
+			}
+		}
+	}
+
+	if c.Run == nil {
+		c.PrintUsage()
+		if len(args) > 0 {
+			return fmt.Errorf("unknown command: %s", args[0])
+		}
+		return fmt.Errorf("no command specified")
+	}
+
+	return c.Run(ctx, log, args)
+}
+
+func (c *Command) PrintUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s\n", c.Usage)
+	if len(c.Subcommands) > 0 {
+		fmt.Fprintf(os.Stderr, "\nCommands:\n")
+		for _, sub := range c.Subcommands {
+			fmt.Fprintf(os.Stderr, "  %s\n", sub.Usage)
+		}
+	}
+}
+
+func (c *Command) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.Name, flag.ContinueOnError)
+	fs.Usage = func() {
+		c.PrintUsage()
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+type ConfigFlags struct {
+	Path     string
+	Profiles string
+}
+
+func RegisterConfigFlags(fs *flag.FlagSet) *ConfigFlags {
+	f := &ConfigFlags{Path: envOr("JIRA_AUTO_TRIAL_CONFIG", "./config.yml")}
+	fs.StringVar(&f.Path, "config", f.Path, "path to the config file (env JIRA_AUTO_TRIAL_CONFIG)")
+	RegisterDataDirFlag(fs)
+	fs.BoolVar(&skipPlaywrightInstall, "skip-install", skipPlaywrightInstall, "do not install the playwright driver and browsers (env JIRA_AUTO_TRIAL_SKIP_INSTALL)")
+	fs.StringVar(&f.Profiles, "profile", "", "config profiles to use, comma-separated")
+	return f
+}
+
+func (f *ConfigFlags) LoadAll() ([]*config.Config, error) {
+	cfg, err := LoadConfig(f.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Profiles == "" {
+		return []*config.Config{cfg}, nil
+	}
+
+	names := strings.Split(f.Profiles, ",")
+	cfgs := make([]*config.Config, 0, len(names))
+	for _, name := range names {
+		profileCfg, err := cfg.WithProfile(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		cfgs = append(cfgs, profileCfg)
+	}
+
+	return cfgs, nil
+}
+
+func (f *ConfigFlags) Load() (*config.Config, error) {
+	cfgs, err := f.LoadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfgs) != 1 {
+		return nil, fmt.Errorf("this command supports only one profile at a time")
+	}
+
+	return cfgs[0], nil
+}
+
+func rootCommand() *Command {
+	root := &Command{
+		Name:  "jira-auto-trial",
+		Usage: "jira-auto-trial [-profile names] [-verbose] [-force] [-no-persist-keys] [-dry-run] [-confirm] [-events ndjson] [command]",
+	}
+
+	// without a command the root runs all instances like run
+	runCmd := runCommand()
+	root.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			root.PrintUsage()
+			return fmt.Errorf("unknown command: %s", args[0])
+		}
+		return runCmd.Run(ctx, log, args)
+	}
+
+	root.Subcommands = []*Command{
+		runCmd,
+		checkCommand(),
+		renewCommand(),
+		listCommand(),
+		validateCommand(),
+		lintConfigCommand(),
+		{
+			Name:  "atlassian",
+			Usage: "jira-auto-trial atlassian <command>",
+			Subcommands: []*Command{
+				atlassianLicensesCommand(),
+				atlassianReconcileCommand(),
+			},
+		},
+		{
+			Name:  "login",
+			Usage: "jira-auto-trial login <command>",
+			Subcommands: []*Command{
+				loginAtlassianCommand(),
+			},
+		},
+		resolveCommand(),
+		applyCommand(),
+		restoreLicenseCommand(),
+		explainCommand(),
+		selectorHealthCommand(),
+		supportBundleCommand(),
+		operatorCommand(),
+		serveCommand(),
+		genAlertsCommand(),
+		{
+			Name:  "schedule",
+			Usage: "jira-auto-trial schedule <command>",
+			Subcommands: []*Command{
+				schedulePreviewCommand(),
+			},
+		},
+		cancelCommand(),
+		pauseCommand(),
+		resumeCommand(),
+		{
+			Name:  "instances",
+			Usage: "jira-auto-trial instances <command>",
+			Subcommands: []*Command{
+				instancesImportCommand(),
+			},
+		},
+		{
+			Name:  "credentials",
+			Usage: "jira-auto-trial credentials <command>",
+			Subcommands: []*Command{
+				credentialsSetCommand(),
+			},
+		},
+		{
+			Name:  "session",
+			Usage: "jira-auto-trial session <command>",
+			Subcommands: []*Command{
+				sessionExportCommand(),
+				sessionImportCommand(),
+			},
+		},
+	}
+
+	return root
+}
+
+func atlassianLicensesCommand() *Command {
+	cmd := &Command{
+		Name:  "licenses",
+		Usage: "jira-auto-trial atlassian licenses [-format json|csv] [-output file]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		format := fs.String("format", "json", "output format: json or csv")
+		output := fs.String("output", "-", "output file, - for stdout")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if *format != "json" && *format != "csv" {
+			return fmt.Errorf("unknown format: %s", *format)
+		}
+
+		cfg, err := configFlags.Load()
+		if err != nil {
+			return err
+		}
+
+		ctx = WithPlaywrightTimeouts(ctx, cfg.Playwright)
+		browser, err := OpenBrowser(cfg)
+		if err != nil {
+			return err
+		}
+		defer browser.Close()
+
+		licenses, err := fetchAtlassianLicenses(ctx, log, browser, cfg.Atlassian)
+		if err != nil {
+			return err
+		}
+
+		return writeOutput(*output, func(w io.Writer) error {
+			if *format == "csv" {
+				return WriteAtlassianLicensesCSV(w, licenses)
+			}
+			return WriteJSON(w, licenses)
+		})
+	}
+
+	return cmd
+}
+
+func atlassianReconcileCommand() *Command {
+	cmd := &Command{
+		Name:  "reconcile",
+		Usage: "jira-auto-trial atlassian reconcile [-format text|json] [-output file] [-refresh-server-ids]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		format := fs.String("format", "text", "output format: text or json")
+		output := fs.String("output", "-", "output file, - for stdout")
+		refreshServerIDs := fs.Bool("refresh-server-ids", false, "resolve the server ids again instead of using the cached ones")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if *format != "text" && *format != "json" {
+			return fmt.Errorf("unknown format: %s", *format)
+		}
+
+		cfg, err := configFlags.Load()
+		if err != nil {
+			return err
+		}
+
+		serverIDs, err := OpenServerIDCache()
+		if err != nil {
+			return err
+		}
+
+		ctx = WithPlaywrightTimeouts(ctx, cfg.Playwright)
+		browser, err := OpenBrowser(cfg)
+		if err != nil {
+			return err
+		}
+		defer browser.Close()
+
+		instances := make([]ReconciledInstance, 0, len(cfg.Instances))
+		for _, instance := range cfg.Instances {
+			instanceLog := log.With(zap.String("instance", instance.BaseURL))
+			if serverID, ok := serverIDs.Get(instance.BaseURL); ok && !*refreshServerIDs {
+				instanceLog.Info("server id from cache", zap.String("server id", serverID))
+				instances = append(instances, ReconciledInstance{BaseURL: instance.BaseURL, ServerID: serverID})
+				continue
+			}
+			instanceLog.Info("resolving server id")
+
+			instanceCtx, cancelInstance := context.WithCancel(ctx)
+			g, instanceCtx := errgroup.WithContext(instanceCtx)
+
+			reconciled := ReconciledInstance{BaseURL: instance.BaseURL}
+			var serverID string
+			jiraPage, closePage, err := browser.NewSessionPage(InstanceSessionKey(instance))
+			if err != nil {
+				cancelInstance()
+				return err
+			}
+			product, err := InstanceProduct(instance)
+			if err == nil {
+				product.StartHandlers(instanceCtx, g, jiraPage, instance.Account)
+				err = StartURLRewrite(instanceCtx, g, jiraPage, instance.URLRewrite)
+			}
+			if err == nil {
+				serverID, err = product.ResolveServerID(instanceCtx, jiraPage, ResolveServerIDParams{
+					BaseURL: NavigationBaseURL(instance),
+				})
+			}
+			if err != nil {
+				instanceLog.Error("resolving server id failed", zap.Error(err))
+				reconciled.Error = err.Error()
+			} else {
+				reconciled.ServerID = serverID
+				if err := serverIDs.Set(instance.BaseURL, serverID); err != nil {
+					instanceLog.Warn("could not cache server id", zap.Error(err))
+				}
+			}
+			instances = append(instances, reconciled)
+
+			cancelInstance()
+			_ = g.Wait()
+			closePage()
+		}
+
+		licenses, err := fetchAtlassianLicenses(ctx, log, browser, cfg.Atlassian)
+		if err != nil {
+			return err
+		}
+
+		report := Reconcile(instances, licenses)
+		log.Info(
+			"reconciliation done",
+			zap.Int("matched", len(report.Matched)),
+			zap.Int("orphans", len(report.Orphans)),
+			zap.Int("gaps", len(report.Gaps)),
+		)
+
+		return writeOutput(*output, func(w io.Writer) error {
+			if *format == "json" {
+				return WriteJSON(w, report)
+			}
+			return WriteReconciliationText(w, report)
+		})
+	}
+
+	return cmd
+}
+
+func loginAtlassianCommand() *Command {
+	cmd := &Command{
+		Name:  "atlassian",
+		Usage: "jira-auto-trial login atlassian [-headful] [-timeout duration] [-output file]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		headful := fs.Bool("headful", false, "show the browser window")
+		timeout := fs.Duration("timeout", 10*time.Minute, "how long to wait for the login, including device approval")
+		output := fs.String("output", "", "also export the atlassian session to this file")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		cfg, err := configFlags.Load()
+		if err != nil {
+			return err
+		}
+
+		if *headful {
+			cfg.Playwright.Headful = true
+		}
+		if *output == "" && cfg.Playwright.Endpoint != "" {
+			*output = atlassianSessionFile()
+		}
+
+		ctx = WithPlaywrightTimeouts(ctx, cfg.Playwright)
+		browser, err := OpenBrowser(cfg)
+		if err != nil {
+			return err
+		}
+		defer browser.Close()
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		g, ctx := errgroup.WithContext(ctx)
+
+		session, err := browser.AtlassianSession(cfg.Atlassian.Account)
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+
+		page, err := StartAtlassianPage(ctx, g, session.BrowserContext, cfg.Atlassian)
+		if err != nil {
+			return err
+		}
+
+		g.Go(func() error {
+			defer cancel()
+
+			log.Info("waiting for atlassian login", zap.Duration("timeout", *timeout))
+
+			if err := WaitForAtlassianLogin(ctx, page, *timeout); err != nil {
+				return err
+			}
+
+			log.Info("logged in to atlassian")
+
+			if *output == "" {
+				return nil
+			}
+
+			state, err := ExportSession(session.BrowserContext, atlassianSessionDomains)
+			if err != nil {
+				return err
+			}
+
+			if err := WriteSessionFile(*output, state); err != nil {
+				return err
+			}
+
+			log.Info("session exported", zap.String("file", *output))
+			return nil
+		})
+
+		if err := g.Wait(); err != nil && !errors.Is(err, context.Canceled) {
+			return err
+		}
+
+		return nil
+	}
+
+	return cmd
+}
+
+func operatorCommand() *Command {
+	cmd := &Command{
+		Name:  "operator",
+		Usage: "jira-auto-trial operator [-namespace ns] [-resync duration]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		var options OperatorOptions
+
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		fs.StringVar(&options.Namespace, "namespace", "", "namespace to watch, all namespaces if empty")
+		fs.DurationVar(&options.Resync, "resync", time.Minute, "how often to re-check all resources for due renewals")
+		fs.BoolVar(&options.Run.Verbose, "verbose", true, "show detailed logs")
+		fs.BoolVar(&options.Run.NoPersistKeys, "no-persist-keys", false, "never write license keys to logs or state, only their hashes")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		cfg, err := configFlags.Load()
+		if err != nil {
+			return err
+		}
+
+		return runOperator(ctx, log, cfg, options)
+	}
+
+	return cmd
+}
+
+func serveCommand() *Command {
+	cmd := &Command{
+		Name:  "serve",
+		Usage: "jira-auto-trial serve [-grpc addr] [-grpc-token token] [-http addr] [-schedule]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		options := RunOptions{Verbose: true}
+
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		grpcAddr := fs.String("grpc", "", "address to serve the grpc control api on, e.g. :9090, which binds to loopback without a token")
+		grpcTokenFlag := fs.String("grpc-token", grpcToken, "bearer token the grpc control api requires, defaults to JIRA_AUTO_TRIAL_GRPC_TOKEN")
+		httpAddr := fs.String("http", "", "address to serve /healthz and /metrics on, e.g. :8080")
+		fs.BoolVar(&options.NoPersistKeys, "no-persist-keys", false, "never write license keys to logs or state, only their hashes")
+		scheduled := fs.Bool("schedule", false, "start runs at the times of the schedule settings of the config")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *grpcAddr == "" && *httpAddr == "" && !*scheduled {
+			fs.Usage()
+			return fmt.Errorf("no listen address specified")
+		}
+
+		runner := NewRunner(log, func(profile string) (*config.Config, error) {
+			if profile == "" {
+				return configFlags.Load()
+			}
+			cfg, err := LoadConfig(configFlags.Path)
+			if err != nil {
+				return nil, err
+			}
+			return cfg.WithProfile(profile)
+		}, options)
+
+		g, ctx := errgroup.WithContext(ctx)
+
+		if *scheduled {
+			cfgs, err := configFlags.LoadAll()
+			if err != nil {
+				return err
+			}
+			entries := make([]ScheduleEntry, 0)
+			for _, cfg := range cfgs {
+				cfgEntries, err := ScheduleEntries(cfg)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, cfgEntries...)
+			}
+			if len(entries) == 0 {
+				log.Warn("nothing is scheduled, set schedule in the config")
+			}
+
+			g.Go(func() error {
+				return RunSchedules(ctx, log, runner, entries)
+			})
+		}
+
+		if *grpcAddr != "" {
+			addr, err := GRPCListenAddr(*grpcAddr, *grpcTokenFlag)
+			if err != nil {
+				return err
+			}
+			listener, err := net.Listen("tcp", addr)
+			if err != nil {
+				return fmt.Errorf("could not listen on %s: %w", addr, err)
+			}
+
+			server := NewGRPCServer(runner, *grpcTokenFlag)
+			g.Go(func() error {
+				<-ctx.Done()
+				server.Stop()
+				return nil
+			})
+			g.Go(func() error {
+				log.Info("serving grpc", zap.String("addr", listener.Addr().String()))
+				return server.Serve(listener)
+			})
+		}
+
+		if *httpAddr != "" {
+			listener, err := net.Listen("tcp", *httpAddr)
+			if err != nil {
+				return fmt.Errorf("could not listen on %s: %w", *httpAddr, err)
+			}
+
+			server := &http.Server{Handler: NewHTTPHandler(runner), ReadHeaderTimeout: 10 * time.Second}
+			g.Go(func() error {
+				<-ctx.Done()
+				return server.Close()
+			})
+			g.Go(func() error {
+				log.Info("serving http", zap.String("addr", listener.Addr().String()))
+				if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+					return err
+				}
+				return nil
+			})
+		}
+
+		return g.Wait()
+	}
+
+	return cmd
+}
+
+func schedulePreviewCommand() *Command {
+	cmd := &Command{
+		Name:  "preview",
+		Usage: "jira-auto-trial schedule preview [-profile names] [-count n] [-from time] [-format text|json]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		count := fs.Int("count", 5, "planned runs to show per schedule")
+		from := fs.String("from", "", "show runs after this time (RFC 3339), now if empty")
+		format := fs.String("format", "text", "output format: text or json")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		if *from != "" {
+			var err error
+			if start, err = time.Parse(time.RFC3339, *from); err != nil {
+				return fmt.Errorf("invalid -from: %w", err)
+			}
+		}
+
+		cfgs, err := configFlags.LoadAll()
+		if err != nil {
+			return err
+		}
+
+		runs := make([]PlannedRun, 0)
+		for _, cfg := range cfgs {
+			entries, err := ScheduleEntries(cfg)
+			if err != nil {
+				return err
+			}
+			runs = append(runs, PreviewSchedule(entries, start, *count)...)
+		}
+
+		if *format == "json" {
+			return WriteJSON(os.Stdout, runs)
+		}
+		if len(runs) == 0 {
+			fmt.Fprintln(os.Stderr, "nothing is scheduled, set schedule in the config")
+			return nil
+		}
+		return WritePlannedRunsText(os.Stdout, runs)
+	}
+
+	return cmd
+}
+
+func cancelCommand() *Command {
+	cmd := &Command{
+		Name:  "cancel",
+		Usage: "jira-auto-trial cancel -instance name [-run id] [-addr host:port]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		addr := fs.String("addr", "localhost:9090", "address of a running serve -grpc")
+		instance := fs.String("instance", "", "name of the instance to cancel")
+		runID := fs.String("run", "", "run id, latest run if empty")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *instance == "" {
+			fs.Usage()
+			return fmt.Errorf("no instance specified")
+		}
+
+		client, closeClient, err := DialControl(*addr)
+		if err != nil {
+			return err
+		}
+		defer closeClient()
+
+		if _, err := client.CancelInstance(ctx, &grpcapi.CancelInstanceRequest{
+			RunId:    *runID,
+			Instance: *instance,
+		}); err != nil {
+			return fmt.Errorf("could not cancel instance: %w", err)
+		}
+
+		log.Info("instance canceled", zap.String("instance", *instance))
+		return nil
+	}
+
+	return cmd
+}
+
+func pauseCommand() *Command {
+	cmd := &Command{
+		Name:  "pause",
+		Usage: "jira-auto-trial pause [-reason text]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		RegisterDataDirFlag(fs)
+		reason := fs.String("reason", "", "why runs are paused, shown when a run is skipped")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if err := os.MkdirAll(dataDir, 0700); err != nil {
+			return fmt.Errorf("could not create data directory: %w", err)
+		}
+
+		store, err := OpenState()
+		if err != nil {
+			return err
+		}
+
+		if err := store.SetPaused(&state.Pause{At: time.Now(), Reason: *reason}); err != nil {
+			return err
+		}
+
+		log.Info("runs paused")
+		return nil
+	}
+
+	return cmd
+}
+
+func resumeCommand() *Command {
+	cmd := &Command{
+		Name:  "resume",
+		Usage: "jira-auto-trial resume",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		RegisterDataDirFlag(fs)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		store, err := OpenState()
+		if err != nil {
+			return err
+		}
+
+		if store.Paused() == nil {
+			log.Info("runs are not paused")
+			return nil
+		}
+
+		if err := store.SetPaused(nil); err != nil {
+			return err
+		}
+
+		log.Info("runs resumed")
+		return nil
+	}
+
+	return cmd
+}
+
+func credentialsSetCommand() *Command {
+	cmd := &Command{
+		Name:  "set",
+		Usage: "jira-auto-trial credentials set -username name [-service name]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		username := fs.String("username", "", "account username, as in the keyring account config")
+		service := fs.String("service", credentials.DefaultKeyringService, "keyring service name")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *username == "" {
+			fs.Usage()
+			return fmt.Errorf("-username is required")
+		}
+
+		password, err := readPassword(fmt.Sprintf("Password for %s: ", *username))
+		if err != nil {
+			return err
+		}
+		defer password.Wipe()
+		if password.Empty() {
+			return fmt.Errorf("empty password")
+		}
+
+		if err := credentials.SetKeyringPassword(*service, *username, password); err != nil {
+			return err
+		}
+
+		log.Info("password stored in keyring", zap.String("service", *service), zap.String("username", *username))
+		return nil
+	}
+
+	return cmd
+}
+
+// readPassword reads without echo from a terminal, or a single line when stdin is piped.
+func readPassword(prompt string) (credentials.Secret, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return credentials.Secret{}, fmt.Errorf("could not read password: %w", err)
+		}
+		return credentials.NewSecret(string(password)), nil
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return credentials.Secret{}, fmt.Errorf("could not read password: %w", err)
+	}
+	return credentials.NewSecret(strings.TrimRight(line, "\r\n")), nil
+}
+
+func selectorHealthCommand() *Command {
+	cmd := &Command{
+		Name:  "selector-health",
+		Usage: "jira-auto-trial selector-health [-format text|json]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		RegisterDataDirFlag(fs)
+		format := fs.String("format", "text", "output format: text or json")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		store, err := OpenState()
+		if err != nil {
+			return err
+		}
+
+		report := SelectorHealthReport(store.Selectors())
+
+		if *format == "json" {
+			return WriteJSON(os.Stdout, report)
+		}
+		return WriteSelectorHealthText(os.Stdout, report)
+	}
+
+	return cmd
+}
+
+func supportBundleCommand() *Command {
+	cmd := &Command{
+		Name:  "support-bundle",
+		Usage: "jira-auto-trial support-bundle [-output file] [-since duration] [-include-html]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		params := SupportBundleParams{ConfigPath: envOr("JIRA_AUTO_TRIAL_CONFIG", "./config.yml")}
+
+		fs := cmd.FlagSet()
+		fs.StringVar(&params.ConfigPath, "config", params.ConfigPath, "path to the config file (env JIRA_AUTO_TRIAL_CONFIG)")
+		RegisterDataDirFlag(fs)
+		output := fs.String("output", "support-bundle-"+time.Now().Format("20060102-150405")+".zip", "zip file to write, - for stdout")
+		fs.DurationVar(&params.Since, "since", 24*time.Hour, "include failure captures and screenshots of this period")
+		fs.BoolVar(&params.IncludeHTML, "include-html", false, "include page html of failure captures, which contains license keys")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		var files []string
+		if err := writeOutput(*output, func(w io.Writer) (err error) {
+			files, err = WriteSupportBundle(w, params)
+			return err
+		}); err != nil {
+			return err
+		}
+
+		log.Info("support bundle written", zap.String("file", *output), zap.Int("files", len(files)))
+		return nil
+	}
+
+	return cmd
+}
+
+func sessionExportCommand() *Command {
+	cmd := &Command{
+		Name:  "export",
+		Usage: "jira-auto-trial session export -output file [-scope all|atlassian|jira]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		output := fs.String("output", "", "session file to write")
+		scope := fs.String("scope", "all", "sessions to export: all, atlassian or jira")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if *output == "" {
+			fs.Usage()
+			return fmt.Errorf("-output is required")
+		}
+
+		cfg, err := configFlags.Load()
+		if err != nil {
+			return err
+		}
+
+		domains, err := SessionDomains(cfg, *scope)
+		if err != nil {
+			return err
+		}
+		scopes, err := SessionScopes(cfg, *scope)
+		if err != nil {
+			return err
+		}
+
+		ctx = WithPlaywrightTimeouts(ctx, cfg.Playwright)
+		browser, err := OpenBrowser(cfg)
+		if err != nil {
+			return err
+		}
+		defer browser.Close()
+
+		var state *playwright.StorageState
+		if browser.Context != nil {
+			state, err = ExportSession(browser.Context, domains)
+		} else {
+			state, err = ExportSessions(browser, scopes)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := WriteSessionFile(*output, state); err != nil {
+			return err
+		}
+
+		log.Info(
+			"session exported",
+			zap.String("file", *output),
+			zap.Int("cookies", len(state.Cookies)),
+			zap.Int("origins", len(state.Origins)),
+		)
+
+		return nil
+	}
+
+	return cmd
+}
+
+func instancesImportCommand() *Command {
+	cmd := &Command{
+		Name:  "import",
+		Usage: "jira-auto-trial instances import -input file -mapping file [-format csv|json] [-output file]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		input := fs.String("input", "", "inventory export to read")
+		mappingPath := fs.String("mapping", "", "yaml file mapping inventory columns to instance fields")
+		format := fs.String("format", "", "inventory format: csv or json (default from the mapping or file extension)")
+		output := fs.String("output", "-", "output file, - for stdout")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *input == "" || *mappingPath == "" {
+			fs.Usage()
+			return fmt.Errorf("-input and -mapping are required")
+		}
+
+		mapping, err := ReadInventoryMapping(*mappingPath)
+		if err != nil {
+			return err
+		}
+
+		if *format == "" {
+			*format = mapping.Format
+		}
+		if *format == "" {
+			*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*input)), ".")
+		}
+
+		file, err := os.Open(*input)
+		if err != nil {
+			return fmt.Errorf("could not open inventory: %w", err)
+		}
+		defer file.Close()
+
+		rows, err := ReadInventoryRows(file, *format)
+		if err != nil {
+			return err
+		}
+
+		instances, err := ImportInventory(rows, mapping)
+		if err != nil {
+			return err
+		}
+
+		log.Info("instances imported", zap.Int("count", len(instances)))
+
+		return writeOutput(*output, func(w io.Writer) error {
+			return WriteImportedInstances(w, instances)
+		})
+	}
+
+	return cmd
+}
+
+func sessionImportCommand() *Command {
+	cmd := &Command{
+		Name:  "import",
+		Usage: "jira-auto-trial session import -input file",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		input := fs.String("input", "", "session file to read")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if *input == "" {
+			fs.Usage()
+			return fmt.Errorf("-input is required")
+		}
+
+		cfg, err := configFlags.Load()
+		if err != nil {
+			return err
+		}
+
+		state, err := ReadSessionFile(*input)
+		if err != nil {
+			return err
+		}
+
+		ctx = WithPlaywrightTimeouts(ctx, cfg.Playwright)
+		browser, err := OpenBrowser(cfg)
+		if err != nil {
+			return err
+		}
+		defer browser.Close()
+
+		if browser.Context != nil {
+			err = ImportSession(browser.Context, state)
+		} else {
+			var scopes []SessionScope
+			if scopes, err = SessionScopes(cfg, "all"); err == nil {
+				err = ImportSessions(browser, scopes, state)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		log.Info(
+			"session imported",
+			zap.String("file", *input),
+			zap.Int("cookies", len(state.Cookies)),
+			zap.Int("origins", len(state.Origins)),
+		)
+
+		return nil
+	}
+
+	return cmd
+}
+
+func fetchAtlassianLicenses(ctx context.Context, log *zap.Logger, browser *Browser, cfg config.Atlassian) ([]AtlassianLicense, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	session, err := browser.AtlassianSession(cfg.Account)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	page, err := StartAtlassianPage(ctx, g, session.BrowserContext, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var licenses []AtlassianLicense
+	g.Go(func() error {
+		defer cancel()
+
+		log.Info("listing atlassian licenses")
+
+		result, err := ListAtlassianLicenses(ctx, page)
+		if err != nil {
+			return fmt.Errorf("listing licenses: %w", err)
+		}
+
+		log.Info("licenses listed", zap.Int("count", len(result)))
+		licenses = result
+		if err := session.Save(); err != nil {
+			log.Warn("could not save atlassian session", zap.Error(err))
+		}
+		return nil
+	})
+
+	if err := g.Wait(); err != nil && (licenses == nil || !errors.Is(err, context.Canceled)) {
+		return nil, err
+	}
+
+	return licenses, nil
+}
+
+func writeOutput(path string, write func(w io.Writer) error) error {
+	if path == "-" {
+		return write(os.Stdout)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer file.Close()
+
+	if err := write(file); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
@@ -1,30 +1,255 @@
 package config
 
+import (
+	"fmt"
+	"time"
+)
+
 type AccountPlain struct {
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 }
 
+type AccountEnv struct {
+	UsernameVar string `yaml:"usernameVar"`
+	PasswordVar string `yaml:"passwordVar"`
+}
+
+type AccountCommand struct {
+	Command  []string      `yaml:"command"`
+	Username string        `yaml:"username"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+type VaultAppRole struct {
+	Mount       string `yaml:"mount"`
+	RoleID      string `yaml:"roleID"`
+	SecretIDVar string `yaml:"secretIDVar"`
+}
+
+type AccountVault struct {
+	Address     string        `yaml:"address"`
+	Namespace   string        `yaml:"namespace"`
+	Mount       string        `yaml:"mount"`
+	Path        string        `yaml:"path"`
+	UsernameKey string        `yaml:"usernameKey"`
+	PasswordKey string        `yaml:"passwordKey"`
+	AppRole     *VaultAppRole `yaml:"appRole"`
+	CacheTTL    time.Duration `yaml:"cacheTTL"`
+}
+
+type AccountKeyring struct {
+	Service  string `yaml:"service"`
+	Username string `yaml:"username"`
+}
+
+// AccountPAT is a personal access token of a data center instance, it works over REST only.
+type AccountPAT struct {
+	Token    string `yaml:"token"`
+	TokenVar string `yaml:"tokenVar"`
+}
+
 type Account struct {
-	Plain *AccountPlain `yaml:"plain"`
+	Plain   *AccountPlain   `yaml:"plain"`
+	Env     *AccountEnv     `yaml:"env"`
+	Command *AccountCommand `yaml:"command"`
+	Vault   *AccountVault   `yaml:"vault"`
+	Keyring *AccountKeyring `yaml:"keyring"`
+	PAT     *AccountPAT     `yaml:"pat"`
+}
+
+type URLRewrite struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+type ApplicationMapping struct {
+	EvaluationProduct string `yaml:"evaluationProduct"`
+	EvaluationEdition string `yaml:"evaluationEdition"`
+}
+
+// ServiceManagementPrompts answers the agent tier dialog jira service management can show after a license update.
+type ServiceManagementPrompts struct {
+	// label of the option to choose, "Keep" by default
+	AgentTier string `yaml:"agentTier"`
+	// label of the button that applies the choice, "Confirm" by default
+	Confirm string `yaml:"confirm"`
 }
 
 type JiraInstance struct {
-	BaseURL string  `yaml:"baseURL"`
-	Account Account `yaml:"account"`
+	Name       string       `yaml:"name"`
+	Tags       []string     `yaml:"tags"`
+	Product    string       `yaml:"product"`
+	BaseURL    string       `yaml:"baseURL"`
+	Account    Account      `yaml:"account"`
+	Disabled   bool         `yaml:"disabled"`
+	Policy     Policy       `yaml:"policy"`
+	URLRewrite []URLRewrite `yaml:"urlRewrite"`
+
+	Applications      map[string]ApplicationMapping `yaml:"applications"`
+	ServiceManagement ServiceManagementPrompts      `yaml:"serviceManagement"`
+
+	RenewThresholdDays *int `yaml:"renewThresholdDays"`
+	// overrides preferREST of the config
+	PreferREST *bool `yaml:"preferREST"`
+	// runs the instance on its own instead of with the schedule of the config
+	Schedule string `yaml:"schedule"`
+}
+
+type AtlassianBackoff struct {
+	Base time.Duration `yaml:"base"`
+	Max  time.Duration `yaml:"max"`
+}
+
+// AtlassianTimeouts bound the waits of the evaluation form, the page can render slowly when atlassian is under load.
+type AtlassianTimeouts struct {
+	// each step of the form, e.g. the editions to appear after the product is chosen, 30s by default
+	Step time.Duration `yaml:"step"`
+	// the generated license after submitting the form, 60s by default
+	Generate time.Duration `yaml:"generate"`
 }
 
 type Atlassian struct {
-	Account Account `yaml:"account"`
+	Account          Account `yaml:"account"`
+	LabelEvaluations bool    `yaml:"labelEvaluations"`
+	// reuse an unexpired evaluation of the account for the server id instead of generating one
+	ReuseEvaluations bool              `yaml:"reuseEvaluations"`
+	Backoff          AtlassianBackoff  `yaml:"backoff"`
+	Timeouts         AtlassianTimeouts `yaml:"timeouts"`
+	OTP              OTPChain          `yaml:"otp"`
+	TOTPSecret       string            `yaml:"totpSecret"`
+	Locale           string            `yaml:"locale"`
+}
+
+type Recycle struct {
+	EveryInstances int           `yaml:"everyInstances"`
+	Every          time.Duration `yaml:"every"`
+	MaxMemoryMB    uint64        `yaml:"maxMemoryMB"`
 }
 
 type Playwright struct {
-	Endpoint string `yaml:"endpoint"`
-	Headful  bool   `yaml:"headful"`
+	// chromium (default), firefox or webkit
+	Browser string `yaml:"browser"`
+	// an installed branded chromium such as chrome or msedge, or a browser executable, instead of the bundled one
+	Channel            string  `yaml:"channel"`
+	ExecutablePath     string  `yaml:"executablePath"`
+	Endpoint           string  `yaml:"endpoint"`
+	Headful            bool    `yaml:"headful"`
+	Recycle            Recycle `yaml:"recycle"`
+	KillStrayProcesses bool    `yaml:"killStrayProcesses"`
+	SkipInstall        bool    `yaml:"skipInstall"`
+	DownloadHost       string  `yaml:"downloadHost"`
+	IsolateSessions    bool    `yaml:"isolateSessions"`
+	// defaults of navigations and of actions such as clicks, fills and waits, 30s as in playwright when unset
+	NavigationTimeout time.Duration `yaml:"navigationTimeout"`
+	ActionTimeout     time.Duration `yaml:"actionTimeout"`
+	// bound each run of a page handler by name: login, websudo, expiredLicense, atlassianLogin and otp
+	HandlerTimeouts map[string]time.Duration `yaml:"handlerTimeouts"`
+}
+
+type Precheck struct {
+	Enabled  bool          `yaml:"enabled"`
+	Parallel int           `yaml:"parallel"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+type VerifyUpdate struct {
+	Attempts int           `yaml:"attempts"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+type Telemetry struct {
+	Enabled  bool          `yaml:"enabled"`
+	Endpoint string        `yaml:"endpoint"`
+	Timeout  time.Duration `yaml:"timeout"`
+}
+
+type Logs struct {
+	InstanceFiles bool `yaml:"instanceFiles"`
+}
+
+type Profile struct {
+	Instances []JiraInstance `yaml:"instances"`
+	Atlassian *Atlassian     `yaml:"atlassian"`
+	Policy    *Policy        `yaml:"policy"`
+	Schedule  string         `yaml:"schedule"`
 }
 
 type Config struct {
+	Profile string `yaml:"-"`
+
 	Instances  []JiraInstance `yaml:"instances"`
 	Atlassian  Atlassian      `yaml:"atlassian"`
 	Playwright Playwright     `yaml:"playwright"`
+	Policy     Policy         `yaml:"policy"`
+	Logs       Logs           `yaml:"logs"`
+	Precheck   Precheck       `yaml:"precheck"`
+	// how often the license details are read again until they show the applied license
+	VerifyUpdate VerifyUpdate `yaml:"verifyUpdate"`
+	// after a renewal, look up the license update in the audit log of the instance over REST
+	VerifyAuditLog bool `yaml:"verifyAuditLog"`
+
+	Notifications []Notification `yaml:"notifications"`
+	// when serve -schedule starts runs, a cron expression or e.g. "daily at 03:00"
+	Schedule string `yaml:"schedule"`
+	// anonymized selector failures, off unless enabled
+	Telemetry Telemetry `yaml:"telemetry"`
+
+	NoPersistKeys  bool `yaml:"noPersistKeys"`
+	DryRun         bool `yaml:"dryRun"`
+	MaxParallel    int  `yaml:"maxParallel"`
+	UpdateFallback bool `yaml:"updateFallback"`
+	PreferREST     bool `yaml:"preferREST"`
+
+	Retries      int           `yaml:"retries"`
+	RetryBackoff time.Duration `yaml:"retryBackoff"`
+
+	RenewThresholdDays *int `yaml:"renewThresholdDays"`
+
+	DateFormat string `yaml:"dateFormat"`
+	Timezone   string `yaml:"timezone"`
+
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// InstancePolicy merges the global and instance policies, renewThresholdDays overrides thresholdDays of the same level.
+func (c *Config) InstancePolicy(instance JiraInstance) Policy {
+	p := c.Policy
+	if c.RenewThresholdDays != nil {
+		p.ThresholdDays = c.RenewThresholdDays
+	}
+	p = p.Merge(instance.Policy)
+	if instance.RenewThresholdDays != nil {
+		p.ThresholdDays = instance.RenewThresholdDays
+	}
+	return p
+}
+
+func (c *Config) InstancePreferREST(instance JiraInstance) bool {
+	if instance.PreferREST != nil {
+		return *instance.PreferREST
+	}
+	return c.PreferREST
+}
+
+func (c *Config) WithProfile(name string) (*Config, error) {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile not found: %s", name)
+	}
+
+	cfg := *c
+	cfg.Profile = name
+	cfg.Instances = profile.Instances
+	if profile.Atlassian != nil {
+		cfg.Atlassian = *profile.Atlassian
+	}
+	if profile.Policy != nil {
+		cfg.Policy = cfg.Policy.Merge(*profile.Policy)
+	}
+	if profile.Schedule != "" {
+		cfg.Schedule = profile.Schedule
+	}
+
+	return &cfg, nil
 }
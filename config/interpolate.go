@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// interpolationPattern matches ${VAR} and ${VAR:-default}, $${ escapes a literal ${.
+var interpolationPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// Interpolate expands ${VAR} and ${VAR:-default} in the scalar values of a decoded yaml document.
+// Values are expanded after parsing, so a variable cannot inject yaml structure.
+func Interpolate(node *yaml.Node, lookup func(string) (string, bool)) error {
+	if node.Kind == yaml.ScalarNode {
+		if !strings.Contains(node.Value, "${") {
+			return nil
+		}
+		value, err := interpolateString(node.Value, lookup)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Value = value
+		// plain values are resolved again, so ${PORT} can fill an int and ${TIMEOUT} a duration
+		if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 && node.Tag == "!!str" {
+			node.Tag = ""
+		}
+		return nil
+	}
+
+	for _, child := range node.Content {
+		if err := Interpolate(child, lookup); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func interpolateString(value string, lookup func(string) (string, bool)) (string, error) {
+	var missing []string
+	value = interpolationPattern.ReplaceAllStringFunc(value, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		groups := interpolationPattern.FindStringSubmatch(match)
+		if resolved, ok := lookup(groups[1]); ok && (resolved != "" || groups[2] == "") {
+			return resolved
+		}
+		if groups[2] != "" {
+			return groups[3]
+		}
+		missing = append(missing, groups[1])
+		return ""
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s is not set", strings.Join(missing, ", "))
+	}
+	return value, nil
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var testEnv = map[string]string{
+	"USER":  "admin",
+	"HOST":  "jira.example.com",
+	"EMPTY": "",
+	"PORT":  "8443",
+	"WAIT":  "90s",
+	"YAML":  "a: b",
+}
+
+func lookupTestEnv(name string) (string, bool) {
+	value, ok := testEnv[name]
+	return value, ok
+}
+
+func TestInterpolateString(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		err   string
+	}{
+		{"plain", "plain", ""},
+		{"${USER}", "admin", ""},
+		{"https://${HOST}:${PORT}/", "https://jira.example.com:8443/", ""},
+		{"${USER}${USER}", "adminadmin", ""},
+		{"${MISSING:-fallback}", "fallback", ""},
+		{"${MISSING:-}", "", ""},
+		{"${MISSING:-a b/c:d}", "a b/c:d", ""},
+		{"${USER:-fallback}", "admin", ""},
+		{"${EMPTY:-fallback}", "fallback", ""},
+		{"${EMPTY}", "", ""},
+		{"$${USER}", "${USER}", ""},
+		{"$$${USER}", "$${USER}", ""},
+		{"$${USER:-x} ${USER}", "${USER:-x} admin", ""},
+		{"$USER", "$USER", ""},
+		{"${1ABC}", "${1ABC}", ""},
+		{"${USER", "${USER", ""},
+		{"${MISSING}", "", "MISSING is not set"},
+		{"${MISSING} ${OTHER} ${USER}", "", "MISSING, OTHER is not set"},
+	}
+
+	for _, test := range tests {
+		got, err := interpolateString(test.value, lookupTestEnv)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: got error %v, want %q", test.value, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%q: got %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	source := `
+url: https://${HOST}/
+port: ${PORT}
+quoted: "${PORT}"
+wait: ${WAIT}
+injected: ${YAML}
+list:
+  - ${USER}
+  - ${MISSING:-x}
+nested:
+  user: ${USER}
+  literal: $${USER}
+`
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte(source), &node); err != nil {
+		t.Fatal(err)
+	}
+	if err := Interpolate(&node, lookupTestEnv); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		URL      string        `yaml:"url"`
+		Port     int           `yaml:"port"`
+		Quoted   string        `yaml:"quoted"`
+		Wait     time.Duration `yaml:"wait"`
+		Injected string        `yaml:"injected"`
+		List     []string      `yaml:"list"`
+		Nested   struct {
+			User    string `yaml:"user"`
+			Literal string `yaml:"literal"`
+		} `yaml:"nested"`
+	}
+	if err := node.Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.URL != "https://jira.example.com/" {
+		t.Errorf("url: got %q", got.URL)
+	}
+	if got.Port != 8443 {
+		t.Errorf("port: got %d", got.Port)
+	}
+	if got.Quoted != "8443" {
+		t.Errorf("quoted: got %q", got.Quoted)
+	}
+	if got.Wait != 90*time.Second {
+		t.Errorf("wait: got %s", got.Wait)
+	}
+	if got.Injected != "a: b" {
+		t.Errorf("injected: got %q, a variable must not add yaml structure", got.Injected)
+	}
+	if len(got.List) != 2 || got.List[0] != "admin" || got.List[1] != "x" {
+		t.Errorf("list: got %q", got.List)
+	}
+	if got.Nested.User != "admin" || got.Nested.Literal != "${USER}" {
+		t.Errorf("nested: got %+v", got.Nested)
+	}
+}
+
+func TestInterpolateMissing(t *testing.T) {
+	var node yaml.Node
+	if err := yaml.Unmarshal([]byte("a: 1\nb: ${MISSING}\n"), &node); err != nil {
+		t.Fatal(err)
+	}
+	err := Interpolate(&node, lookupTestEnv)
+	if err == nil || err.Error() != "line 2: environment variable MISSING is not set" {
+		t.Errorf("got %v", err)
+	}
+}
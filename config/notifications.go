@@ -0,0 +1,21 @@
+package config
+
+import "time"
+
+type NotificationWebhook struct {
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+type Notification struct {
+	Slack   *NotificationWebhook `yaml:"slack"`
+	Discord *NotificationWebhook `yaml:"discord"`
+	Webhook *NotificationWebhook `yaml:"webhook"`
+	// skip runs in which nothing was renewed and nothing failed
+	OnlyChanges bool `yaml:"onlyChanges"`
+	// only send what changed since the previous run: renewals, new failures and recoveries
+	OnlyDeltas bool `yaml:"onlyDeltas"`
+	// send a failure that persists again after this long, with onlyDeltas, never by default
+	RenotifyAfter time.Duration `yaml:"renotifyAfter"`
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+type OTPStdin struct {
+	Prompt string `yaml:"prompt"`
+}
+
+type OTPWebhook struct {
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+type OTPTOTP struct {
+	Secret string `yaml:"secret"`
+}
+
+type OTPIMAP struct {
+	Address  string        `yaml:"address"`
+	StartTLS bool          `yaml:"startTLS"`
+	Account  Account       `yaml:"account"`
+	Folder   string        `yaml:"folder"`
+	From     string        `yaml:"from"`
+	Pattern  string        `yaml:"pattern"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+type OTP struct {
+	Stdin   *OTPStdin   `yaml:"stdin"`
+	Webhook *OTPWebhook `yaml:"webhook"`
+	TOTP    *OTPTOTP    `yaml:"totp"`
+	IMAP    *OTPIMAP    `yaml:"imap"`
+	None    bool        `yaml:"none"`
+}
+
+func (o *OTP) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		switch node.Value {
+		case "stdin":
+			*o = OTP{Stdin: &OTPStdin{}}
+		case "none":
+			*o = OTP{None: true}
+		default:
+			return fmt.Errorf("line %d: unknown otp source %q", node.Line, node.Value)
+		}
+		return nil
+	}
+
+	type plain OTP
+	return node.Decode((*plain)(o))
+}
+
+type OTPChain []OTP
+
+func (c *OTPChain) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		return node.Decode((*[]OTP)(c))
+	}
+
+	var source OTP
+	if err := node.Decode(&source); err != nil {
+		return err
+	}
+	*c = OTPChain{source}
+	return nil
+}
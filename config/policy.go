@@ -0,0 +1,36 @@
+package config
+
+import "time"
+
+type MaintenanceWindow struct {
+	Days  []string `yaml:"days"`
+	Start string   `yaml:"start"`
+	End   string   `yaml:"end"`
+}
+
+type Policy struct {
+	ThresholdDays       *int                `yaml:"thresholdDays"`
+	AllowedLicenseTypes []string            `yaml:"allowedLicenseTypes"`
+	Cooldown            *time.Duration      `yaml:"cooldown"`
+	MaintenanceWindows  []MaintenanceWindow `yaml:"maintenanceWindows"`
+	Force               *bool               `yaml:"force"`
+}
+
+func (p Policy) Merge(override Policy) Policy {
+	if override.ThresholdDays != nil {
+		p.ThresholdDays = override.ThresholdDays
+	}
+	if override.AllowedLicenseTypes != nil {
+		p.AllowedLicenseTypes = override.AllowedLicenseTypes
+	}
+	if override.Cooldown != nil {
+		p.Cooldown = override.Cooldown
+	}
+	if override.MaintenanceWindows != nil {
+		p.MaintenanceWindows = override.MaintenanceWindows
+	}
+	if override.Force != nil {
+		p.Force = override.Force
+	}
+	return p
+}
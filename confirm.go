@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Confirmer asks the operator before each renewal, one question at a time even when instances run in parallel.
+type Confirmer struct {
+	In  io.Reader
+	Out io.Writer
+	// no answer within this time declines the renewal
+	Timeout time.Duration
+
+	mu    sync.Mutex
+	start sync.Once
+	lines chan string
+}
+
+func (c *Confirmer) Confirm(ctx context.Context, question string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// a single reader outlives timed out questions, so their late answers do not get lost in a buffer
+	c.start.Do(func() {
+		c.lines = make(chan string)
+		go func() {
+			defer close(c.lines)
+			scanner := bufio.NewScanner(c.In)
+			for scanner.Scan() {
+				c.lines <- scanner.Text()
+			}
+		}()
+	})
+
+	// answers typed after a previous question timed out are not meant for this one
+	for drained := false; !drained; {
+		select {
+		case _, ok := <-c.lines:
+			drained = !ok
+		default:
+			drained = true
+		}
+	}
+
+	fmt.Fprintf(c.Out, "%s [y/N] ", question)
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(c.Out)
+			return false, ctx.Err()
+		case <-timer.C:
+			fmt.Fprintf(c.Out, "\nno answer within %s, not renewing\n", timeout)
+			return false, nil
+		case line, ok := <-c.lines:
+			if !ok {
+				fmt.Fprintln(c.Out)
+				return false, nil
+			}
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "y", "yes":
+				return true, nil
+			case "", "n", "no":
+				return false, nil
+			default:
+				fmt.Fprint(c.Out, "please answer y or n: ")
+			}
+		}
+	}
+}
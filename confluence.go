@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/credentials"
+	"github.com/tarik02/jira-auto-trial/dates"
+	"golang.org/x/sync/errgroup"
+)
+
+type ConfluenceLoginHandler struct {
+	CredentialsResolver func(ctx context.Context) (string, credentials.Secret, error)
+	RememberMe          bool
+}
+
+func (s *ConfluenceLoginHandler) Run(ctx context.Context, page playwright.Page) error {
+	return RunPageLocator(ctx, "login", page.Locator(`//form[@id="loginform" or contains(@action, "/dologin.action")]`), func(ctx context.Context, locator playwright.Locator) error {
+		username, password, err := s.CredentialsResolver(ctx)
+		if err != nil {
+			return err
+		}
+		defer password.Wipe()
+		if err := Fill(ctx, locator.Locator(`[name="os_username"]`), username); err != nil {
+			return err
+		}
+		if err := Fill(ctx, locator.Locator(`[name="os_password"]`), password.Reveal()); err != nil {
+			return err
+		}
+		if s.RememberMe {
+			if err := Check(ctx, locator.Locator(`[name="os_cookie"]`), playwright.LocatorCheckOptions{
+				Force: playwright.Bool(true),
+			}); err != nil {
+				return err
+			}
+		}
+		if err := Click(ctx, locator.Locator(`#loginButton, [name="login"]`).First()); err != nil {
+			return err
+		}
+
+		if err := WaitFor(ctx, locator, playwright.LocatorWaitForOptions{
+			State: playwright.WaitForSelectorStateHidden,
+		}); err != nil {
+			return err
+		}
+
+		loginErr, err := page.Locator(`//form[@id="loginform"]//div[contains(concat(' ', @class, ' '), ' aui-message-error ')]`).InnerText(playwright.LocatorInnerTextOptions{
+			Timeout: playwright.Float(1000),
+		})
+		if err != nil {
+			if errors.Is(err, playwright.ErrTimeout) {
+				return nil
+			}
+			return err
+		}
+
+		return fmt.Errorf("%w: %s", ErrLoginFailed, loginErr)
+	})
+}
+
+type ConfluenceSudoHandler struct {
+	PasswordResolver func(ctx context.Context) (credentials.Secret, error)
+}
+
+func (s *ConfluenceSudoHandler) Run(ctx context.Context, page playwright.Page) error {
+	return RunPageLocator(ctx, "websudo", page.Locator(`//form[contains(@action, "/doauthenticate.action")]`), func(ctx context.Context, locator playwright.Locator) error {
+		password, err := s.PasswordResolver(ctx)
+		if err != nil {
+			return err
+		}
+		defer password.Wipe()
+		if err := Fill(ctx, locator.Locator(`[name="password"]`), password.Reveal()); err != nil {
+			return err
+		}
+		if err := Click(ctx, locator.Locator(`#authenticateButton, [type="submit"]`).First()); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func StartConfluenceHandlers(ctx context.Context, g *errgroup.Group, page playwright.Page, account config.Account) {
+	_ = g.TryGo(func() error {
+		return (&ConfluenceLoginHandler{
+			CredentialsResolver: func(ctx context.Context) (string, credentials.Secret, error) {
+				creds, err := credentials.ResolveCredentials(ctx, account)
+				if err != nil {
+					return "", credentials.Secret{}, err
+				}
+				return creds.Username, creds.Password, nil
+			},
+			RememberMe: true,
+		}).Run(ctx, page)
+	})
+
+	_ = g.TryGo(func() error {
+		return (&ConfluenceSudoHandler{
+			PasswordResolver: func(ctx context.Context) (credentials.Secret, error) {
+				creds, err := credentials.ResolveCredentials(ctx, account)
+				if err != nil {
+					return credentials.Secret{}, err
+				}
+				return creds.Password, nil
+			},
+		}).Run(ctx, page)
+	})
+}
+
+func ResolveConfluenceServerID(ctx context.Context, page playwright.Page, params ResolveServerIDParams) (string, error) {
+	if _, err := Goto(ctx, page, fmt.Sprintf("%s/admin/license.action", params.BaseURL)); err != nil {
+		return "", fmt.Errorf("could not navigate to license: %w", err)
+	}
+
+	field := LicenseField(page, "Server ID")
+	if err := TrackSelector(ctx, "confluence.license.server-id", WaitFor(ctx, field)); err != nil {
+		return "", fmt.Errorf("error extracting server id from page: %w", err)
+	}
+
+	serverID, err := ExtractServerID(func() (string, error) {
+		return field.TextContent()
+	})
+	if err != nil {
+		return "", fmt.Errorf("error extracting server id from page: %w", err)
+	}
+
+	return serverID, nil
+}
+
+func ResolveConfluenceLicenseDetails(ctx context.Context, page playwright.Page, params ResolveLicenseDetailsParams) (*ResolveLicenseDetailsResult, error) {
+	if _, err := Goto(ctx, page, fmt.Sprintf("%s/admin/license.action", params.BaseURL)); err != nil {
+		return nil, fmt.Errorf("could not navigate to license: %w", err)
+	}
+
+	if err := TrackSelector(ctx, "confluence.license.details", WaitFor(ctx, LicenseField(page, "Server ID"))); err != nil {
+		return nil, err
+	}
+
+	read := func(label string) (string, error) {
+		field := LicenseField(page, label)
+		if count, err := field.Count(); err != nil || count == 0 {
+			return "", err
+		}
+		value, err := field.TextContent()
+		return strings.TrimSpace(value), err
+	}
+
+	var result ResolveLicenseDetailsResult
+	var err error
+
+	if result.SEN, err = read("Support Entitlement Number"); err != nil {
+		return nil, err
+	}
+	if result.LicenseType, err = read("License Type"); err != nil {
+		return nil, err
+	}
+	if result.OrganisationName, err = read("Licensed To"); err != nil {
+		return nil, err
+	}
+
+	expiry, err := read("License Expiry")
+	if err != nil {
+		return nil, err
+	}
+	if expiry != "" {
+		date, err := dates.Parse(expiry, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		result.TrialExpiresAt = &date
+	}
+
+	return &result, nil
+}
+
+func UpdateConfluenceLicenseKey(ctx context.Context, page playwright.Page, params UpdateLicenseKeyParams) error {
+	if _, err := Goto(ctx, page, fmt.Sprintf("%s/admin/license.action", params.BaseURL)); err != nil {
+		return fmt.Errorf("could not navigate to license: %w", err)
+	}
+
+	if err := TrackSelector(ctx, "confluence.license.update-textarea", Fill(ctx, page.Locator(`textarea[name="licenseString"]`), params.LicenseKey)); err != nil {
+		return err
+	}
+
+	if err := TrackSelector(ctx, "confluence.license.update-submit", Click(ctx, page.Locator(`//form[.//textarea[@name="licenseString"]]//*[@type="submit"]`).First())); err != nil {
+		return err
+	}
+
+	if err := page.WaitForLoadState(playwright.PageWaitForLoadStateOptions{
+		State: playwright.LoadStateLoad,
+	}); err != nil {
+		return fmt.Errorf("could not wait for load state: %w", err)
+	}
+
+	updateErr, err := page.Locator(`.aui-message-error, .errorBox`).First().InnerText(playwright.LocatorInnerTextOptions{
+		Timeout: playwright.Float(1000),
+	})
+	if err != nil {
+		if errors.Is(err, playwright.ErrTimeout) {
+			return nil
+		}
+		return err
+	}
+
+	return fmt.Errorf("license update error: %s", strings.TrimSpace(updateErr))
+}
@@ -0,0 +1,43 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/zalando/go-keyring"
+)
+
+const DefaultKeyringService = "jira-auto-trial"
+
+func resolveKeyring(account *config.AccountKeyring) (*Credentials, error) {
+	if account.Username == "" {
+		return nil, fmt.Errorf("keyring username is not set")
+	}
+
+	service := keyringService(account.Service)
+	password, err := keyring.Get(service, account.Username)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, fmt.Errorf("no password for %s in keyring service %s, store it with `jira-auto-trial credentials set`", account.Username, service)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read keyring: %w", err)
+	}
+
+	return &Credentials{Username: account.Username, Password: NewSecret(password)}, nil
+}
+
+// SetKeyringPassword stores the password in the OS keychain where the keyring account source reads it from.
+func SetKeyringPassword(service, username string, password Secret) error {
+	if err := keyring.Set(keyringService(service), username, password.Reveal()); err != nil {
+		return fmt.Errorf("could not write keyring: %w", err)
+	}
+	return nil
+}
+
+func keyringService(service string) string {
+	if service == "" {
+		return DefaultKeyringService
+	}
+	return service
+}
@@ -1,22 +1,132 @@
 package credentials
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
 
 	"github.com/tarik02/jira-auto-trial/config"
 )
 
 type Credentials struct {
-	Username, Password string
+	Username string
+	Password Secret
+	// personal access token, sent as a bearer token instead of the username and password
+	Token Secret
+}
+
+func (c *Credentials) Wipe() {
+	c.Password.Wipe()
+	c.Token.Wipe()
 }
 
 func ResolveCredentials(ctx context.Context, account config.Account) (*Credentials, error) {
 	switch true {
 	case account.Plain != nil:
-		return &Credentials{account.Plain.Username, account.Plain.Password}, nil
+		return &Credentials{Username: account.Plain.Username, Password: NewSecret(account.Plain.Password)}, nil
+
+	case account.Env != nil:
+		return resolveEnv(account.Env)
+
+	case account.Command != nil:
+		return resolveCommand(ctx, account.Command)
+
+	case account.Vault != nil:
+		return resolveVault(ctx, account.Vault)
+
+	case account.Keyring != nil:
+		return resolveKeyring(account.Keyring)
+
+	case account.PAT != nil:
+		return resolvePAT(account.PAT)
 
 	default:
 		return nil, fmt.Errorf("no credentials specified")
 	}
 }
+
+func resolveEnv(env *config.AccountEnv) (*Credentials, error) {
+	username, ok := os.LookupEnv(env.UsernameVar)
+	if env.UsernameVar == "" || !ok {
+		return nil, fmt.Errorf("username environment variable %q is not set", env.UsernameVar)
+	}
+
+	password, ok := os.LookupEnv(env.PasswordVar)
+	if env.PasswordVar == "" || !ok {
+		return nil, fmt.Errorf("password environment variable %q is not set", env.PasswordVar)
+	}
+
+	return &Credentials{Username: username, Password: NewSecret(password)}, nil
+}
+
+func resolvePAT(pat *config.AccountPAT) (*Credentials, error) {
+	token := pat.Token
+	if pat.TokenVar != "" {
+		value, ok := os.LookupEnv(pat.TokenVar)
+		if !ok {
+			return nil, fmt.Errorf("token environment variable %q is not set", pat.TokenVar)
+		}
+		token = value
+	}
+	if token == "" {
+		return nil, fmt.Errorf("personal access token is empty")
+	}
+
+	return &Credentials{Token: NewSecret(token)}, nil
+}
+
+// resolveCommand runs the command and reads its output in the pass format:
+// the password on the first line followed by optional "username: <value>" lines.
+func resolveCommand(ctx context.Context, command *config.AccountCommand) (*Credentials, error) {
+	if len(command.Command) == 0 {
+		return nil, fmt.Errorf("credentials command is empty")
+	}
+
+	timeout := command.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, command.Command[0], command.Command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("could not run credentials command %q: %w", command.Command[0], err)
+	}
+	defer clear(stdout.Bytes())
+
+	lines := strings.Split(strings.ReplaceAll(stdout.String(), "\r\n", "\n"), "\n")
+	password := lines[0]
+	if password == "" {
+		return nil, fmt.Errorf("credentials command %q printed no password", command.Command[0])
+	}
+
+	username := command.Username
+	for _, line := range lines[1:] {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "username", "user", "login":
+			if username == "" {
+				username = strings.TrimSpace(value)
+			}
+		}
+	}
+	if username == "" {
+		return nil, fmt.Errorf("credentials command %q printed no username and none is configured", command.Command[0])
+	}
+
+	return &Credentials{Username: username, Password: NewSecret(password)}, nil
+}
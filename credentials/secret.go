@@ -0,0 +1,35 @@
+package credentials
+
+const redacted = "[REDACTED]"
+
+type Secret struct {
+	value []byte
+}
+
+func NewSecret(value string) Secret {
+	return Secret{value: []byte(value)}
+}
+
+func (s Secret) Reveal() string {
+	return string(s.value)
+}
+
+func (s Secret) Empty() bool {
+	return len(s.value) == 0
+}
+
+func (s Secret) Wipe() {
+	clear(s.value)
+}
+
+func (s Secret) String() string {
+	return redacted
+}
+
+func (s Secret) GoString() string {
+	return redacted
+}
+
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
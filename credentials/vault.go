@@ -0,0 +1,323 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+)
+
+// vaultClients is shared by all accounts so a token is logged in and renewed once per address and role.
+var vaultClients = struct {
+	sync.Mutex
+	clients map[string]*vaultClient
+}{clients: map[string]*vaultClient{}}
+
+type vaultClient struct {
+	address   string
+	namespace string
+	appRole   *config.VaultAppRole
+	http      *http.Client
+
+	// mu guards the token and the cache, it is never held during a request
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	renewable bool
+	secrets   map[string]vaultCachedSecret
+}
+
+type vaultCachedSecret struct {
+	data      map[string]string
+	expiresAt time.Time
+}
+
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+func resolveVault(ctx context.Context, vault *config.AccountVault) (*Credentials, error) {
+	if vault.Path == "" {
+		return nil, fmt.Errorf("vault path is not set")
+	}
+
+	client, err := getVaultClient(vault)
+	if err != nil {
+		return nil, err
+	}
+
+	mount := vault.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	cacheTTL := vault.CacheTTL
+	if cacheTTL == 0 {
+		cacheTTL = 5 * time.Minute
+	}
+
+	data, err := client.readKV(ctx, mount, vault.Path, cacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("could not read vault secret %s/%s: %w", mount, vault.Path, err)
+	}
+
+	usernameKey, passwordKey := vault.UsernameKey, vault.PasswordKey
+	if usernameKey == "" {
+		usernameKey = "username"
+	}
+	if passwordKey == "" {
+		passwordKey = "password"
+	}
+
+	username, ok := data[usernameKey]
+	if !ok {
+		return nil, fmt.Errorf("vault secret %s/%s has no %q key", mount, vault.Path, usernameKey)
+	}
+	password, ok := data[passwordKey]
+	if !ok {
+		return nil, fmt.Errorf("vault secret %s/%s has no %q key", mount, vault.Path, passwordKey)
+	}
+
+	return &Credentials{Username: username, Password: NewSecret(password)}, nil
+}
+
+func getVaultClient(vault *config.AccountVault) (*vaultClient, error) {
+	address := vault.Address
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, fmt.Errorf("vault address is not set and VAULT_ADDR is empty")
+	}
+	address = strings.TrimSuffix(address, "/")
+
+	namespace := vault.Namespace
+	if namespace == "" {
+		namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+
+	key := address + "|" + namespace
+	if vault.AppRole != nil {
+		key += "|" + vault.AppRole.Mount + "|" + vault.AppRole.RoleID
+	}
+
+	vaultClients.Lock()
+	defer vaultClients.Unlock()
+
+	if client, ok := vaultClients.clients[key]; ok {
+		return client, nil
+	}
+
+	client := &vaultClient{
+		address:   address,
+		namespace: namespace,
+		appRole:   vault.AppRole,
+		http:      &http.Client{Timeout: 30 * time.Second},
+		secrets:   map[string]vaultCachedSecret{},
+	}
+	if vault.AppRole == nil {
+		client.token = os.Getenv("VAULT_TOKEN")
+		if client.token == "" {
+			return nil, fmt.Errorf("VAULT_TOKEN is not set and no appRole is configured")
+		}
+	}
+	vaultClients.clients[key] = client
+
+	return client, nil
+}
+
+func (c *vaultClient) readKV(ctx context.Context, mount, path string, cacheTTL time.Duration) (map[string]string, error) {
+	cacheKey := mount + "/" + path
+	c.mu.Lock()
+	cached, ok := c.secrets[cacheKey]
+	c.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.data, nil
+	}
+
+	token, err := c.ensureToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var res struct {
+		Data struct {
+			Data map[string]any `json:"data"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, token, http.MethodGet, fmt.Sprintf("/v1/%s/data/%s", url.PathEscape(mount), strings.TrimPrefix(path, "/")), nil, &res); err != nil {
+		return nil, err
+	}
+
+	data := make(map[string]string, len(res.Data.Data))
+	for k, v := range res.Data.Data {
+		if s, ok := v.(string); ok {
+			data[k] = s
+		}
+	}
+	c.mu.Lock()
+	c.secrets[cacheKey] = vaultCachedSecret{data: data, expiresAt: time.Now().Add(cacheTTL)}
+	c.mu.Unlock()
+
+	return data, nil
+}
+
+// ensureToken returns the token, it logs in with AppRole when there is none and renews the token when it is close
+// to expiry. The mutex is only held to read and set the token, concurrent callers may both renew it.
+func (c *vaultClient) ensureToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	token, expiresAt, renewable := c.token, c.expiresAt, c.renewable
+	c.mu.Unlock()
+
+	if token == "" {
+		return c.login(ctx)
+	}
+
+	if expiresAt.IsZero() {
+		auth, err := c.lookupSelf(ctx, token)
+		if err != nil {
+			return "", err
+		}
+		expiresAt, renewable = auth.expiresAt(), auth.Renewable
+	}
+	if expiresAt.IsZero() || time.Until(expiresAt) > time.Minute {
+		return token, nil
+	}
+
+	if renewable {
+		var res struct {
+			Auth vaultAuth `json:"auth"`
+		}
+		if err := c.do(ctx, token, http.MethodPost, "/v1/auth/token/renew-self", struct{}{}, &res); err == nil {
+			c.setAuth(res.Auth)
+			return res.Auth.ClientToken, nil
+		} else if c.appRole == nil {
+			return "", fmt.Errorf("could not renew vault token: %w", err)
+		}
+	}
+
+	if c.appRole == nil {
+		if time.Now().Before(expiresAt) {
+			return token, nil
+		}
+		return "", fmt.Errorf("vault token expired at %s and cannot be renewed", expiresAt.Format(time.DateTime))
+	}
+	return c.login(ctx)
+}
+
+func (c *vaultClient) login(ctx context.Context) (string, error) {
+	if c.appRole == nil {
+		return "", fmt.Errorf("no vault token")
+	}
+
+	mount := c.appRole.Mount
+	if mount == "" {
+		mount = "approle"
+	}
+	secretIDVar := c.appRole.SecretIDVar
+	if secretIDVar == "" {
+		secretIDVar = "VAULT_SECRET_ID"
+	}
+
+	body := map[string]string{"role_id": c.appRole.RoleID}
+	if secretID := os.Getenv(secretIDVar); secretID != "" {
+		body["secret_id"] = secretID
+	}
+
+	var res struct {
+		Auth vaultAuth `json:"auth"`
+	}
+	if err := c.do(ctx, "", http.MethodPost, fmt.Sprintf("/v1/auth/%s/login", url.PathEscape(mount)), body, &res); err != nil {
+		return "", fmt.Errorf("could not log in to vault with approle: %w", err)
+	}
+	c.setAuth(res.Auth)
+
+	return res.Auth.ClientToken, nil
+}
+
+func (c *vaultClient) lookupSelf(ctx context.Context, token string) (vaultAuth, error) {
+	var res struct {
+		Data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := c.do(ctx, token, http.MethodGet, "/v1/auth/token/lookup-self", nil, &res); err != nil {
+		return vaultAuth{}, fmt.Errorf("could not look up vault token: %w", err)
+	}
+	auth := vaultAuth{ClientToken: token, LeaseDuration: res.Data.TTL, Renewable: res.Data.Renewable}
+	c.setAuth(auth)
+
+	return auth, nil
+}
+
+func (a vaultAuth) expiresAt() time.Time {
+	if a.LeaseDuration <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(a.LeaseDuration) * time.Second)
+}
+
+func (c *vaultClient) setAuth(auth vaultAuth) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.token = auth.ClientToken
+	c.renewable = auth.Renewable
+	c.expiresAt = auth.expiresAt()
+}
+
+// do sends a request with the token, the login request has none.
+func (c *vaultClient) do(ctx context.Context, token, method, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.address+path, reader)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		var status struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(io.LimitReader(res.Body, 64*1024)).Decode(&status)
+		if len(status.Errors) > 0 {
+			return fmt.Errorf("vault returned %d: %s", res.StatusCode, strings.Join(status.Errors, "; "))
+		}
+		return fmt.Errorf("vault returned %d", res.StatusCode)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
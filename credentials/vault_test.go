@@ -0,0 +1,177 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+)
+
+// fakeVault answers approle login, token renewal and kv v2 reads, and counts the requests of each.
+type fakeVault struct {
+	t        *testing.T
+	token    string
+	logins   int
+	renewals int
+	reads    int
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reply := func(body any) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(body)
+	}
+	auth := func(token string) map[string]any {
+		return map[string]any{"auth": map[string]any{"client_token": token, "lease_duration": 3600, "renewable": true}}
+	}
+
+	switch r.Method + " " + r.URL.Path {
+	case "POST /v1/auth/approle/login":
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			v.t.Errorf("login: %v", err)
+		}
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			v.t.Errorf("login: got %v", body)
+		}
+		if token := r.Header.Get("X-Vault-Token"); token != "" {
+			v.t.Errorf("login: got token %q, want none", token)
+		}
+		v.logins++
+		v.token = fmt.Sprintf("login-%d", v.logins)
+		reply(auth(v.token))
+	case "POST /v1/auth/token/renew-self":
+		if r.Header.Get("X-Vault-Token") != v.token {
+			w.WriteHeader(http.StatusForbidden)
+			reply(map[string]any{"errors": []string{"permission denied"}})
+			return
+		}
+		v.renewals++
+		v.token = fmt.Sprintf("renewed-%d", v.renewals)
+		reply(auth(v.token))
+	case "GET /v1/secret/data/jira":
+		if r.Header.Get("X-Vault-Token") != v.token {
+			w.WriteHeader(http.StatusForbidden)
+			reply(map[string]any{"errors": []string{"permission denied"}})
+			return
+		}
+		if namespace := r.Header.Get("X-Vault-Namespace"); namespace != "team" {
+			v.t.Errorf("read: got namespace %q, want team", namespace)
+		}
+		v.reads++
+		reply(map[string]any{"data": map[string]any{"data": map[string]any{
+			"username": "admin",
+			"password": fmt.Sprintf("password-%d", v.reads),
+		}}})
+	default:
+		v.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newFakeVault(t *testing.T, token string) (*fakeVault, *httptest.Server) {
+	vault := &fakeVault{t: t, token: token}
+	server := httptest.NewServer(vault)
+	t.Cleanup(server.Close)
+	return vault, server
+}
+
+func TestVaultAppRoleLogin(t *testing.T) {
+	t.Setenv("VAULT_SECRET_ID", "secret")
+	vault, server := newFakeVault(t, "")
+
+	account := &config.AccountVault{
+		Address:   server.URL + "/",
+		Namespace: "team",
+		Path:      "jira",
+		AppRole:   &config.VaultAppRole{RoleID: "role"},
+	}
+	for i := 0; i < 2; i++ {
+		credentials, err := resolveVault(context.Background(), account)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if credentials.Username != "admin" || credentials.Password.Reveal() != "password-1" {
+			t.Errorf("got %s %s, want admin password-1", credentials.Username, credentials.Password.Reveal())
+		}
+	}
+	if vault.logins != 1 || vault.reads != 1 {
+		t.Errorf("got %d logins and %d reads, want 1 and 1 with the secret cached", vault.logins, vault.reads)
+	}
+}
+
+func TestVaultRenew(t *testing.T) {
+	vault, server := newFakeVault(t, "initial")
+	client := &vaultClient{
+		address:   server.URL,
+		namespace: "team",
+		http:      server.Client(),
+		token:     "initial",
+		expiresAt: time.Now().Add(30 * time.Second),
+		renewable: true,
+		secrets:   map[string]vaultCachedSecret{},
+	}
+
+	if _, err := client.readKV(context.Background(), "secret", "jira", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if vault.renewals != 1 || client.token != "renewed-1" {
+		t.Errorf("got %d renewals and token %q, want 1 and renewed-1", vault.renewals, client.token)
+	}
+	if time.Until(client.expiresAt) < time.Hour-time.Minute {
+		t.Errorf("token expires at %s, want in an hour", client.expiresAt)
+	}
+
+	// the renewed token lasts, reading again does not renew it
+	client.secrets = map[string]vaultCachedSecret{}
+	if _, err := client.readKV(context.Background(), "secret", "jira", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if vault.renewals != 1 {
+		t.Errorf("got %d renewals, want 1", vault.renewals)
+	}
+}
+
+func TestVaultCacheExpiry(t *testing.T) {
+	vault, server := newFakeVault(t, "token")
+	client := &vaultClient{
+		address:   server.URL,
+		namespace: "team",
+		http:      server.Client(),
+		token:     "token",
+		expiresAt: time.Now().Add(time.Hour),
+		secrets:   map[string]vaultCachedSecret{},
+	}
+
+	read := func() string {
+		t.Helper()
+		data, err := client.readKV(context.Background(), "secret", "jira", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data["password"]
+	}
+
+	if got := read(); got != "password-1" {
+		t.Errorf("got %s, want password-1", got)
+	}
+	if got := read(); got != "password-1" {
+		t.Errorf("got %s from the cache, want password-1", got)
+	}
+
+	cached := client.secrets["secret/jira"]
+	cached.expiresAt = time.Now().Add(-time.Second)
+	client.secrets["secret/jira"] = cached
+
+	if got := read(); got != "password-2" {
+		t.Errorf("got %s after the cache expired, want password-2", got)
+	}
+	if vault.reads != 2 {
+		t.Errorf("got %d reads, want 2", vault.reads)
+	}
+}
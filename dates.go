@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/policy"
+)
+
+var (
+	dateTimeLayout = time.DateTime
+	dateLocation   = time.Local
+)
+
+var dateLayouts = map[string]string{
+	"datetime": time.DateTime,
+	"rfc3339":  time.RFC3339,
+	"iso8601":  time.RFC3339,
+	"rfc1123":  time.RFC1123Z,
+}
+
+// ConfigureDates applies dateFormat and timezone from the config to all displayed dates.
+func ConfigureDates(cfg *config.Config) error {
+	layout := time.DateTime
+	if cfg.DateFormat != "" {
+		layout = cfg.DateFormat
+		if named, ok := dateLayouts[cfg.DateFormat]; ok {
+			layout = named
+		}
+	}
+
+	location := time.Local
+	if cfg.Timezone != "" {
+		var err error
+		location, err = time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %q: %w", cfg.Timezone, err)
+		}
+	}
+
+	dateTimeLayout, dateLocation = layout, location
+	return nil
+}
+
+func FormatDateTime(t time.Time) string {
+	return t.In(dateLocation).Format(dateTimeLayout)
+}
+
+func FormatDate(t time.Time) string {
+	return t.In(dateLocation).Format(time.DateOnly)
+}
+
+func formatDaysLeft(expiresAt *time.Time) string {
+	if expiresAt == nil {
+		return "-"
+	}
+	return strconv.Itoa(policy.DaysLeft(time.Now(), *expiresAt))
+}
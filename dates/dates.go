@@ -0,0 +1,140 @@
+package dates
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var Formats = []string{
+	"02/Jan/06",
+	"2/Jan/06",
+	"02/Jan/2006",
+	"2/Jan/2006",
+	"02 Jan 2006",
+	"2 Jan 2006",
+	"2 Jan 06",
+	"2. Jan 2006",
+	"Jan 2, 2006",
+	"Jan 2 2006",
+	"2006-01-02",
+	"2006/01/02",
+	"02.01.2006",
+	"02.01.06",
+}
+
+var months = [12][]string{
+	{"jan", "january", "januar", "janv", "janvier", "ene", "enero", "янв", "января", "январь"},
+	{"feb", "february", "februar", "févr", "fevr", "février", "fevrier", "febrero", "фев", "февр", "февраля", "февраль"},
+	{"mar", "march", "mär", "märz", "maerz", "mars", "marzo", "мар", "марта", "март"},
+	{"apr", "april", "avr", "avril", "abr", "abril", "апр", "апреля", "апрель"},
+	{"may", "mai", "mayo", "мая", "май"},
+	{"jun", "june", "juni", "juin", "junio", "июн", "июня", "июнь"},
+	{"jul", "july", "juli", "juil", "juillet", "julio", "июл", "июля", "июль"},
+	{"aug", "august", "août", "aout", "ago", "agosto", "авг", "августа", "август"},
+	{"sep", "sept", "september", "septembre", "septiembre", "сен", "сент", "сентября", "сентябрь"},
+	{"oct", "october", "okt", "oktober", "octobre", "octubre", "окт", "октября", "октябрь"},
+	{"nov", "november", "novembre", "noviembre", "ноя", "нояб", "ноября", "ноябрь"},
+	{"dec", "december", "dez", "dezember", "déc", "décembre", "decembre", "dic", "diciembre", "дек", "декабря", "декабрь"},
+}
+
+var monthLookup = func() map[string]string {
+	lookup := make(map[string]string)
+	for i, names := range months {
+		abbrev := time.Month(i + 1).String()[:3]
+		for _, name := range names {
+			lookup[name] = abbrev
+		}
+	}
+	return lookup
+}()
+
+var ignoredWords = map[string]bool{
+	"de": true,
+}
+
+var (
+	wordRe = regexp.MustCompile(`\p{L}+\.?`)
+
+	relativeInRe  = regexp.MustCompile(`^in (\d+) (day|days|week|weeks)$`)
+	relativeAgoRe = regexp.MustCompile(`^(\d+) (day|days|week|weeks) ago$`)
+	relativeRe    = regexp.MustCompile(`^(\d+) (day|days|week|weeks)$`)
+)
+
+func Parse(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+
+	if date, ok := parseRelative(strings.ToLower(value), now); ok {
+		return date, nil
+	}
+
+	normalized := Normalize(value)
+
+	errs := make([]error, 0, len(Formats))
+	for _, format := range Formats {
+		if date, err := time.ParseInLocation(format, normalized, now.Location()); err != nil {
+			errs = append(errs, err)
+		} else {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date %q: %w", value, errors.Join(errs...))
+}
+
+func Normalize(value string) string {
+	value = wordRe.ReplaceAllStringFunc(value, func(word string) string {
+		lower := strings.ToLower(strings.TrimSuffix(word, "."))
+		if ignoredWords[lower] {
+			return ""
+		}
+		if abbrev, ok := monthLookup[lower]; ok {
+			return abbrev
+		}
+		return word
+	})
+
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func parseRelative(value string, now time.Time) (time.Time, bool) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch value {
+	case "today":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	}
+
+	sign := 1
+	m := relativeInRe.FindStringSubmatch(value)
+	if m == nil {
+		m = relativeRe.FindStringSubmatch(value)
+	}
+	if m == nil {
+		m = relativeAgoRe.FindStringSubmatch(value)
+		sign = -1
+	}
+	if m == nil {
+		return time.Time{}, false
+	}
+
+	n, err := strconv.Atoi(m[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	if strings.HasPrefix(m[2], "week") {
+		n *= 7
+	}
+
+	return today.AddDate(0, 0, sign*n), true
+}
@@ -0,0 +1,118 @@
+package dates
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+var parseInputs = []string{
+	"02/Mar/24",
+	"2/Mar/24",
+	"15/Dec/99",
+	"01/Jan/70",
+	"31/Dec/68",
+	"02/Mar/2024",
+	"2 Mar 2024",
+	"02 Mar 2024",
+	"2 March 2024",
+	"Mar 2, 2024",
+	"March 2, 2024",
+	"2024-03-02",
+	"02.03.2024",
+	"02.03.24",
+	"  2 Mar 2024  ",
+	"02/мар/24",
+	"2 марта 2024",
+	"2. März 2024",
+	"2. Dez. 2024",
+	"2 mars 2024",
+	"2 févr. 2024",
+	"2 de marzo de 2024",
+	"2 dic 2024",
+	"today",
+	"Tomorrow",
+	"yesterday",
+	"in 5 days",
+	"in 1 day",
+	"in 2 weeks",
+	"5 days",
+	"3 days ago",
+	"",
+	"soon",
+	"32/Jan/24",
+	"2 Foo 2024",
+}
+
+func TestParseGolden(t *testing.T) {
+	now := time.Date(2024, time.March, 10, 15, 4, 5, 0, time.UTC)
+
+	var b strings.Builder
+	for _, input := range parseInputs {
+		date, err := Parse(input, now)
+		if err != nil {
+			fmt.Fprintf(&b, "%q\terror\n", input)
+		} else {
+			fmt.Fprintf(&b, "%q\t%s\n", input, date.Format(time.DateOnly))
+		}
+	}
+
+	golden := filepath.Join("testdata", "parse.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(b.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.String(); got != string(want) {
+		t.Errorf("parse results differ from %s:\n%s", golden, diffLines(string(want), got))
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"02/мар/24", "02/Mar/24"},
+		{"2 de marzo de 2024", "2 Mar 2024"},
+		{"2. Dez. 2024", "2. Dec 2024"},
+		{"2 Foo 2024", "2 Foo 2024"},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.input); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func diffLines(want, got string) string {
+	wantLines := strings.Split(want, "\n")
+	gotLines := strings.Split(got, "\n")
+
+	var b strings.Builder
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var w, g string
+		if i < len(wantLines) {
+			w = wantLines[i]
+		}
+		if i < len(gotLines) {
+			g = gotLines[i]
+		}
+		if w != g {
+			fmt.Fprintf(&b, "-%s\n+%s\n", w, g)
+		}
+	}
+	return b.String()
+}
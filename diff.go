@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+func (c FieldChange) String() string {
+	return fmt.Sprintf("%s: %s → %s", c.Field, c.Old, c.New)
+}
+
+func DiffLicenseDetails(before, after *ResolveLicenseDetailsResult, noPersistKeys bool) []FieldChange {
+	changes := make([]FieldChange, 0)
+
+	add := func(field, old, new string) {
+		if old == "" {
+			old = "-"
+		}
+		if new == "" {
+			new = "-"
+		}
+		if old != new {
+			changes = append(changes, FieldChange{Field: field, Old: old, New: new})
+		}
+	}
+
+	add("trial expires at", formatTime(before.TrialExpiresAt), formatTime(after.TrialExpiresAt))
+	add("sen", before.SEN, after.SEN)
+	add("license type", before.LicenseType, after.LicenseType)
+	add("organisation name", before.OrganisationName, after.OrganisationName)
+	add("license key", PersistableLicenseKey(before.LicenseKey, noPersistKeys), PersistableLicenseKey(after.LicenseKey, noPersistKeys))
+
+	return changes
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return FormatDateTime(*t)
+}
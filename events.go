@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventRunStarted       EventType = "run.started"
+	EventRunFinished      EventType = "run.finished"
+	EventInstanceStarted  EventType = "instance.started"
+	EventInstanceStep     EventType = "instance.step"
+	EventInstanceExpired  EventType = "instance.expired"
+	EventInstanceFinished EventType = "instance.finished"
+)
+
+type Event struct {
+	Time      time.Time     `json:"time"`
+	Type      EventType     `json:"type"`
+	RunID     string        `json:"runId,omitempty"`
+	Profile   string        `json:"profile,omitempty"`
+	Instance  string        `json:"instance,omitempty"`
+	Index     int           `json:"index,omitempty"`
+	Total     int           `json:"total,omitempty"`
+	Step      string        `json:"step,omitempty"`
+	Outcome   string        `json:"outcome,omitempty"`
+	Decision  string        `json:"decision,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	ExpiresAt *time.Time    `json:"expiresAt,omitempty"`
+	Changes   []FieldChange `json:"changes,omitempty"`
+
+	Applications []ApplicationEvent `json:"applications,omitempty"`
+}
+
+type ApplicationEvent struct {
+	Application       string     `json:"application"`
+	Outcome           string     `json:"outcome"`
+	Decision          string     `json:"decision,omitempty"`
+	Error             string     `json:"error,omitempty"`
+	PreviousExpiresAt *time.Time `json:"previousExpiresAt,omitempty"`
+	ExpiresAt         *time.Time `json:"expiresAt,omitempty"`
+}
+
+type EventSink func(event Event)
+
+func (s EventSink) Emit(event Event) {
+	if s == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	s(event)
+}
+
+func (s EventSink) With(base Event) EventSink {
+	if s == nil {
+		return nil
+	}
+	return func(event Event) {
+		if event.RunID == "" {
+			event.RunID = base.RunID
+		}
+		if event.Profile == "" {
+			event.Profile = base.Profile
+		}
+		if event.Instance == "" {
+			event.Instance = base.Instance
+		}
+		s(event)
+	}
+}
+
+func NDJSONEventSink(w io.Writer) EventSink {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(w)
+
+	return func(event Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = encoder.Encode(event)
+	}
+}
+
+func ResultEvent(result InstanceResult) Event {
+	event := Event{
+		Type:      EventInstanceFinished,
+		Instance:  result.Instance,
+		Outcome:   result.Status(),
+		Decision:  result.Decision,
+		ExpiresAt: result.ExpiresAt,
+		Changes:   result.Changes,
+	}
+	if result.Err != nil {
+		event.Error = result.Err.Error()
+	}
+	for _, application := range result.Applications {
+		applicationEvent := ApplicationEvent{
+			Application:       application.Application,
+			Outcome:           application.Status(),
+			Decision:          application.Decision,
+			PreviousExpiresAt: application.PreviousExpiresAt,
+			ExpiresAt:         application.ExpiresAt,
+		}
+		if application.Err != nil {
+			applicationEvent.Error = application.Err.Error()
+		}
+		event.Applications = append(event.Applications, applicationEvent)
+	}
+	return event
+}
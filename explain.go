@@ -0,0 +1,229 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/licenses"
+	"github.com/tarik02/jira-auto-trial/policy"
+	"github.com/tarik02/jira-auto-trial/state"
+)
+
+type ExplainStep struct {
+	Title  string   `json:"title"`
+	Detail []string `json:"detail"`
+}
+
+type Explanation struct {
+	Instance string        `json:"instance"`
+	Steps    []ExplainStep `json:"steps"`
+}
+
+func (e *Explanation) step(title string, detail ...string) {
+	e.Steps = append(e.Steps, ExplainStep{Title: title, Detail: detail})
+}
+
+func (e *Explanation) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", e.Instance)
+	for i, step := range e.Steps {
+		fmt.Fprintf(&b, "\n%d. %s\n", i+1, step.Title)
+		for _, line := range step.Detail {
+			fmt.Fprintf(&b, "   %s\n", line)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type ExplainParams struct {
+	Instance config.JiraInstance
+	Previous state.InstanceState
+	Force    bool
+	DryRun   bool
+	Now      time.Time
+}
+
+// Explain describes what a run would do for the instance and why, from the config and the state of the last run,
+// without opening the browser or contacting the instance.
+func Explain(cfg *config.Config, params ExplainParams) (*Explanation, error) {
+	instance := params.Instance
+	e := &Explanation{Instance: fmt.Sprintf("%s (%s)", InstanceName(instance), instance.BaseURL)}
+
+	product, err := InstanceProduct(instance)
+	if err != nil {
+		return nil, err
+	}
+
+	if instance.Disabled {
+		e.step("skip", "the instance is disabled, nothing else happens")
+		return e, nil
+	}
+
+	connection := []string{
+		"product: " + product.Name,
+		"account: " + DescribeAccount(instance.Account),
+	}
+	if NavigationBaseURL(instance) != instance.BaseURL {
+		connection = append(connection, "navigates to "+NavigationBaseURL(instance)+" (urlRewrite)")
+	}
+	switch {
+	case instance.Account.PAT != nil:
+		connection = append(connection, "everything goes over REST with the personal access token, the browser is not used for the instance")
+	case cfg.InstancePreferREST(instance):
+		connection = append(connection, "applications, license details and server id are read over REST first (preferREST), the browser is the fallback")
+	default:
+		connection = append(connection, "the admin pages are opened in the browser, logging in and confirming websudo with the account")
+	}
+	if cfg.Precheck.Enabled && !params.Force {
+		connection = append(connection, "the license is read over REST before the browser is started (precheck)")
+	}
+	e.step("connect", connection...)
+
+	merged := cfg.InstancePolicy(instance)
+	instancePolicy, err := policy.New(merged)
+	if err != nil {
+		e.step("fail", fmt.Sprintf("invalid policy: %s", err))
+		return e, nil
+	}
+	if params.Force {
+		instancePolicy.Force = true
+	}
+	e.step("policy", describePolicy(instancePolicy, merged.MaintenanceWindows)...)
+
+	previous := params.Previous
+	known := []string{"last run: never"}
+	if previous.LastRunAt != nil {
+		known = []string{fmt.Sprintf("last run: %s, %s", FormatDateTime(*previous.LastRunAt), previous.LastOutcome)}
+	}
+	if previous.LastRenewedAt != nil {
+		known = append(known, "last renewed: "+FormatDateTime(*previous.LastRenewedAt))
+	}
+	if previous.ExpiresAt != nil {
+		known = append(known, fmt.Sprintf("trial expiry seen at the last run: %s (%sd left)", FormatDateTime(*previous.ExpiresAt), formatDaysLeft(previous.ExpiresAt)))
+	}
+	e.step("state", known...)
+
+	// the license type is only known once the license is read, assume an allowed one
+	decision := instancePolicy.Decide(policy.Input{
+		Now:            params.Now,
+		TrialExpiresAt: previous.ExpiresAt,
+		LicenseClass:   licenses.ClassUnknown,
+		LastRenewedAt:  previous.LastRenewedAt,
+	})
+	decisionDetail := []string{decision.String()}
+	if previous.ExpiresAt == nil && !instancePolicy.Force {
+		decisionDetail = append(decisionDetail, "the trial expiry is read from the instance during the run, the decision may differ then")
+	} else {
+		decisionDetail = append(decisionDetail, "based on the trial expiry of the last run, the decision is made again with the current license")
+	}
+	e.step("decide", decisionDetail...)
+
+	applications := []string{fmt.Sprintf("%s: %s / %s", product.Name, product.EvaluationProduct, product.EvaluationEdition)}
+	if product.ListApplications != nil {
+		applications = []string{"each application of the licenses page is decided on its own:"}
+		for _, key := range sortedKeys(jiraApplicationEvaluations) {
+			application := MapApplications([]Application{jiraApplication(key)}, instance.Applications)[0]
+			applications = append(applications, fmt.Sprintf("%s: %s / %s", key, application.EvaluationProduct, application.EvaluationEdition))
+		}
+		for _, key := range sortedKeys(instance.Applications) {
+			if _, ok := jiraApplicationEvaluations[key]; ok {
+				continue
+			}
+			application := MapApplications([]Application{jiraApplication(key)}, instance.Applications)[0]
+			applications = append(applications, fmt.Sprintf("%s: %s / %s (applications)", key, application.EvaluationProduct, application.EvaluationEdition))
+		}
+		applications = append(applications, "other keys: Jira / <key>.data-center")
+	}
+	e.step("map evaluation products", applications...)
+
+	if !decision.Renew() {
+		e.step("skip", "nothing is generated or applied while the decision stays the same")
+		return e, nil
+	}
+
+	if params.DryRun || cfg.DryRun {
+		e.step("stop", "dry run: the server id is resolved, but no license key is generated or applied")
+		return e, nil
+	}
+
+	generate := []string{
+		"the server id is resolved",
+		"atlassian account: " + DescribeAccount(cfg.Atlassian.Account),
+	}
+	if cfg.Atlassian.ReuseEvaluations {
+		generate = append(generate, "an evaluation of the account for the server id that is valid for longer than the threshold is reused (reuseEvaluations)")
+	}
+	generate = append(generate, "a new evaluation license is generated on my.atlassian.com for the server id")
+	if cfg.Atlassian.LabelEvaluations {
+		generate = append(generate, "the evaluation is labelled with the instance name and run id")
+	}
+	e.step("generate", generate...)
+
+	update := []string{"the license key is entered on the licenses page"}
+	if instance.Account.PAT != nil {
+		update = []string{"the license key is sent over REST"}
+	} else if cfg.UpdateFallback && product.UpdateLicenseKeyRequest != nil {
+		update = append(update, "when the form fails twice, its request is sent directly (updateFallback)")
+	}
+	update = append(update, "the license details are read again and the changes are reported")
+	e.step("update", update...)
+
+	return e, nil
+}
+
+// DescribeAccount names where the credentials of an account come from, without resolving them.
+func DescribeAccount(account config.Account) string {
+	switch {
+	case account.Plain != nil:
+		return fmt.Sprintf("plain, username %s", account.Plain.Username)
+	case account.Env != nil:
+		return fmt.Sprintf("env, username from $%s, password from $%s", account.Env.UsernameVar, account.Env.PasswordVar)
+	case account.Command != nil:
+		return fmt.Sprintf("command %s", strings.Join(account.Command.Command, " "))
+	case account.Vault != nil:
+		return fmt.Sprintf("vault %s/%s at %s", account.Vault.Mount, account.Vault.Path, account.Vault.Address)
+	case account.Keyring != nil:
+		return fmt.Sprintf("keyring, username %s", account.Keyring.Username)
+	case account.PAT != nil:
+		if account.PAT.TokenVar != "" {
+			return fmt.Sprintf("personal access token from $%s", account.PAT.TokenVar)
+		}
+		return "personal access token"
+	default:
+		return "none"
+	}
+}
+
+func describePolicy(p *policy.Policy, windows []config.MaintenanceWindow) []string {
+	types := make([]string, 0, len(p.AllowedLicenseTypes))
+	for _, class := range p.AllowedLicenseTypes {
+		types = append(types, string(class))
+	}
+	if p.Force {
+		return []string{
+			"force: every instance is renewed",
+			"allowed license types: " + strings.Join(types, ", "),
+		}
+	}
+
+	lines := []string{
+		fmt.Sprintf("renew when the trial expires in less than %d days", p.ThresholdDays),
+		"allowed license types: " + strings.Join(types, ", "),
+	}
+	if p.Cooldown > 0 {
+		lines = append(lines, "cooldown after a renewal: "+policy.FormatDuration(p.Cooldown))
+	}
+	for _, window := range windows {
+		days := "every day"
+		if len(window.Days) > 0 {
+			days = strings.Join(window.Days, ", ")
+		}
+		lines = append(lines, fmt.Sprintf("maintenance window: %s %s-%s", days, cmp.Or(window.Start, "00:00"), cmp.Or(window.End, "24:00")))
+	}
+	return lines
+}
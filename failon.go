@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInstancesExpiring is returned by -fail-on expiring:<days> when a trial expires too soon after the run.
+var ErrInstancesExpiring = errors.New("instances expiring")
+
+// FailOn holds the conditions of -fail-on, which fail a run that otherwise succeeded.
+type FailOn struct {
+	// fail when a trial expires within this many days after the run, 0 when unset
+	ExpiringDays int
+}
+
+func RegisterFailOnFlag(fs *flag.FlagSet) *FailOn {
+	f := &FailOn{}
+	fs.Func("fail-on", "exit with code 3 when a condition holds after the run, comma-separated: expiring:<days>", func(value string) error {
+		for _, condition := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(condition), ":")
+			switch name {
+			case "expiring":
+				days, err := strconv.Atoi(arg)
+				if err != nil || days <= 0 {
+					return fmt.Errorf("expiring needs a positive number of days, e.g. expiring:14")
+				}
+				f.ExpiringDays = days
+			default:
+				return fmt.Errorf("unknown condition %q, use expiring:<days>", name)
+			}
+		}
+		return nil
+	})
+	return f
+}
+
+// Check returns ErrInstancesExpiring naming the instances whose trial, or the trial of one of their applications,
+// expires within ExpiringDays after now. Renewed instances are checked with their new expiry.
+func (f *FailOn) Check(results []InstanceResult, now time.Time) error {
+	if f.ExpiringDays == 0 {
+		return nil
+	}
+
+	deadline := now.AddDate(0, 0, f.ExpiringDays)
+	expiring := make([]string, 0)
+	for _, result := range results {
+		if result.Outcome == OutcomeSkippedCommercial || result.Outcome == OutcomeSkippedDisabled {
+			continue
+		}
+
+		// the applications of an instance may mix trials and commercial licenses
+		expiresAt := result.ExpiresAt
+		if len(result.Applications) > 0 {
+			expiresAt = nil
+		}
+		for _, application := range result.Applications {
+			if application.Outcome == OutcomeSkippedCommercial || application.ExpiresAt == nil {
+				continue
+			}
+			if expiresAt == nil || application.ExpiresAt.Before(*expiresAt) {
+				expiresAt = application.ExpiresAt
+			}
+		}
+		if expiresAt != nil && expiresAt.Before(deadline) {
+			expiring = append(expiring, fmt.Sprintf("%s (%s)", result.Instance, FormatDate(*expiresAt)))
+		}
+	}
+
+	if len(expiring) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w within %d days: %s", ErrInstancesExpiring, f.ExpiringDays, strings.Join(expiring, ", "))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+type CaptureFailureParams struct {
+	Instance string
+	// the page html includes license keys, only the screenshot is taken without it
+	HTML bool
+}
+
+// CaptureFailure saves a screenshot and the html of the page to data/failures/<instance>/<timestamp>/.
+func CaptureFailure(page playwright.Page, params CaptureFailureParams) (string, error) {
+	dir := DataPath("failures", SafeFileName(params.Instance), time.Now().Format("20060102-150405"))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("error creating failure directory: %w", err)
+	}
+
+	var errs []error
+
+	if _, err := page.Screenshot(playwright.PageScreenshotOptions{
+		Path:     playwright.String(filepath.Join(dir, "screenshot.png")),
+		FullPage: playwright.Bool(true),
+	}); err != nil {
+		errs = append(errs, fmt.Errorf("could not take screenshot: %w", err))
+	}
+
+	if params.HTML {
+		if html, err := page.Content(); err != nil {
+			errs = append(errs, fmt.Errorf("could not read page html: %w", err))
+		} else if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte(html), 0600); err != nil {
+			errs = append(errs, fmt.Errorf("could not write page html: %w", err))
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "url.txt"), []byte(page.URL()+"\n"), 0600); err != nil {
+		errs = append(errs, fmt.Errorf("could not write page url: %w", err))
+	}
+
+	return dir, errors.Join(errs...)
+}
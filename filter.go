@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/tarik02/jira-auto-trial/config"
+)
+
+// InstanceFilter narrows a run down to some of the configured instances.
+type InstanceFilter struct {
+	// names, hosts or base urls, each may be a glob
+	Only []string
+	Skip []string
+	// instances with any of the tags
+	Tags []string
+}
+
+func RegisterFilterFlags(fs *flag.FlagSet) *InstanceFilter {
+	f := &InstanceFilter{}
+	listFlag := func(values *[]string) func(string) error {
+		return func(value string) error {
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*values = append(*values, item)
+				}
+			}
+			return nil
+		}
+	}
+	fs.Func("only", "run only the instances with these names, hosts or base urls, comma-separated, globs allowed", listFlag(&f.Only))
+	fs.Func("skip", "do not run the instances with these names, hosts or base urls, comma-separated, globs allowed", listFlag(&f.Skip))
+	fs.Func("tag", "run only the instances with any of these tags, comma-separated", listFlag(&f.Tags))
+	return f
+}
+
+func (f *InstanceFilter) Empty() bool {
+	return len(f.Only) == 0 && len(f.Skip) == 0 && len(f.Tags) == 0
+}
+
+func (f *InstanceFilter) Match(instance config.JiraInstance) bool {
+	if len(f.Only) > 0 && !instanceMatchesAny(instance, f.Only) {
+		return false
+	}
+	if instanceMatchesAny(instance, f.Skip) {
+		return false
+	}
+	if len(f.Tags) > 0 && !slices.ContainsFunc(instance.Tags, func(tag string) bool {
+		return slices.Contains(f.Tags, tag)
+	}) {
+		return false
+	}
+	return true
+}
+
+// Apply keeps the matching instances of each config and drops the profiles left without any.
+func (f *InstanceFilter) Apply(cfgs []*config.Config) ([]*config.Config, error) {
+	if f.Empty() {
+		return cfgs, nil
+	}
+
+	filtered := make([]*config.Config, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		instances := make([]config.JiraInstance, 0, len(cfg.Instances))
+		for _, instance := range cfg.Instances {
+			if f.Match(instance) {
+				instances = append(instances, instance)
+			}
+		}
+		if len(instances) == 0 {
+			continue
+		}
+		filteredCfg := *cfg
+		filteredCfg.Instances = instances
+		filtered = append(filtered, &filteredCfg)
+	}
+
+	if len(filtered) == 0 {
+		return nil, errors.New("no instance matches -only, -skip and -tag")
+	}
+	return filtered, nil
+}
+
+func instanceMatchesAny(instance config.JiraInstance, patterns []string) bool {
+	candidates := []string{InstanceName(instance), InstanceHost(instance), strings.TrimSuffix(instance.BaseURL, "/")}
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(pattern, "/")
+		for _, candidate := range candidates {
+			if matched, err := path.Match(pattern, candidate); err == nil && matched {
+				return true
+			}
+		}
+	}
+	return false
+}
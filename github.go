@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func GitHubActionsEnabled() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+var (
+	workflowDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	workflowPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+	markdownCellEscaper     = strings.NewReplacer("|", "\\|", "\r", " ", "\n", " ")
+)
+
+func WriteGitHubAnnotations(w io.Writer, results []InstanceResult) {
+	for _, result := range results {
+		switch {
+		case result.Outcome == OutcomeFailed, result.Outcome == OutcomeBlockedByQuota:
+			message := result.Status()
+			if result.Err != nil {
+				message = result.Err.Error()
+			}
+			fmt.Fprintf(w, "::error title=%s::%s\n", workflowPropertyEscaper.Replace(result.Instance+": "+result.Status()), workflowDataEscaper.Replace(message))
+		case result.Expired:
+			fmt.Fprintf(w, "::warning title=%s::%s\n", workflowPropertyEscaper.Replace(result.Instance+": "+result.Status()), workflowDataEscaper.Replace(result.Decision))
+		case result.Outcome == OutcomeSkippedCommercial:
+			fmt.Fprintf(w, "::warning title=%s::%s\n", workflowPropertyEscaper.Replace(result.Instance+": "+result.Status()), workflowDataEscaper.Replace(result.Decision))
+		}
+	}
+}
+
+func WriteGitHubSummary(w io.Writer, title string, results []InstanceResult) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "### %s\n\n", title)
+	b.WriteString("| | Instance | Outcome | Trial expires | Days left | Details |\n")
+	b.WriteString("|---|---|---|---|---|---|\n")
+	for _, result := range results {
+		details := result.Decision
+		if result.Err != nil {
+			details = result.Err.Error()
+		}
+		if lines := ApplicationLines(result); len(lines) > 0 {
+			details += "<br>" + strings.Join(lines, "<br>")
+		}
+		if len(result.Changes) > 0 {
+			changes := make([]string, 0, len(result.Changes))
+			for _, change := range result.Changes {
+				changes = append(changes, change.String())
+			}
+			details += "<br>" + strings.Join(changes, "<br>")
+		}
+
+		fmt.Fprintf(
+			&b,
+			"| %s | %s | %s | %s | %s | %s |\n",
+			OutcomeIcon(result.Outcome),
+			markdownCellEscaper.Replace(result.Instance),
+			result.Status(),
+			formatDate(result.ExpiresAt),
+			formatDaysLeft(result.ExpiresAt),
+			markdownCellEscaper.Replace(details),
+		)
+	}
+	b.WriteString("\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func ReportGitHubActions(w io.Writer, title string, results []InstanceResult) error {
+	WriteGitHubAnnotations(w, results)
+
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("could not open job summary: %w", err)
+	}
+	defer f.Close()
+
+	return WriteGitHubSummary(f, title, results)
+}
@@ -2,16 +2,30 @@ module github.com/tarik02/jira-auto-trial
 
 go 1.22.3
 
-require github.com/playwright-community/playwright-go v0.4702.0
+require (
+	github.com/emersion/go-imap v1.2.1
+	github.com/playwright-community/playwright-go v0.4702.0
+	github.com/zalando/go-keyring v0.2.5
+	go.uber.org/zap v1.27.0
+	golang.org/x/net v0.28.0
+	golang.org/x/term v0.23.0
+	google.golang.org/grpc v1.67.1
+	google.golang.org/protobuf v1.34.2
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/Code-Hex/dd v1.1.0 // indirect
+	github.com/alessio/shellescape v1.4.1 // indirect
+	github.com/danieljoos/wincred v1.2.0 // indirect
+	github.com/emersion/go-sasl v0.0.0-20200509203442-7bfe0ed36a21 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.19 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
-	go.uber.org/zap v1.27.0 // indirect
-	golang.org/x/sys v0.17.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+	golang.org/x/text v0.17.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
 )
 
 require (
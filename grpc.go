@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/grpcapi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// grpcToken is the bearer token of the control api, both serve and its clients read it
+var grpcToken = os.Getenv("JIRA_AUTO_TRIAL_GRPC_TOKEN")
+
+type controlServer struct {
+	grpcapi.UnimplementedControlServer
+	runner *Runner
+}
+
+// NewGRPCServer requires "authorization: Bearer <token>" on every call unless the token is empty.
+func NewGRPCServer(runner *Runner, token string) *grpc.Server {
+	var options []grpc.ServerOption
+	if token != "" {
+		options = append(options,
+			grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if err := checkGRPCToken(ctx, token); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.ChainStreamInterceptor(func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := checkGRPCToken(stream.Context(), token); err != nil {
+					return err
+				}
+				return handler(srv, stream)
+			}),
+		)
+	}
+
+	server := grpc.NewServer(options...)
+	grpcapi.RegisterControlServer(server, &controlServer{runner: runner})
+	return server
+}
+
+func checkGRPCToken(ctx context.Context, token string) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(value), []byte("Bearer "+token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "missing or invalid token")
+}
+
+// GRPCListenAddr binds an address without a host, e.g. :9090, to loopback unless there is a token. The api can
+// start runs and cancel instances, so listening on other interfaces without a token is refused.
+func GRPCListenAddr(addr, token string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("invalid grpc address %q: %w", addr, err)
+	}
+	if token != "" {
+		return addr, nil
+	}
+	if host == "" {
+		return net.JoinHostPort("127.0.0.1", port), nil
+	}
+	if host == "localhost" {
+		return addr, nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return "", fmt.Errorf("serving the grpc api on %s needs a token, set -grpc-token or JIRA_AUTO_TRIAL_GRPC_TOKEN", addr)
+	}
+	return addr, nil
+}
+
+type grpcTokenCredentials string
+
+func (c grpcTokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(c)}, nil
+}
+
+// RequireTransportSecurity allows the token over plaintext, serve has no tls
+func (c grpcTokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+func DialControl(addr string) (grpcapi.ControlClient, func() error, error) {
+	options := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if grpcToken != "" {
+		options = append(options, grpc.WithPerRPCCredentials(grpcTokenCredentials(grpcToken)))
+	}
+
+	conn, err := grpc.NewClient(addr, options...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not connect to %s: %w", addr, err)
+	}
+	return grpcapi.NewControlClient(conn), conn.Close, nil
+}
+
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrRunInProgress), errors.Is(err, ErrPaused):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, ErrRunNotFound), errors.Is(err, ErrInstanceNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+func formatRFC3339(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func (s *controlServer) StartRun(ctx context.Context, req *grpcapi.StartRunRequest) (*grpcapi.StartRunResponse, error) {
+	runID, err := s.runner.Start(ctx, RunRequest{
+		Profile:   req.Profile,
+		Force:     req.Force,
+		Instances: req.Instances,
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &grpcapi.StartRunResponse{RunId: runID}, nil
+}
+
+func (s *controlServer) GetStatus(ctx context.Context, req *grpcapi.GetStatusRequest) (*grpcapi.RunStatus, error) {
+	runStatus, err := s.runner.Status(req.RunId)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	res := &grpcapi.RunStatus{
+		RunId:      runStatus.RunID,
+		Profile:    runStatus.Profile,
+		State:      string(runStatus.State),
+		StartedAt:  formatRFC3339(&runStatus.StartedAt),
+		FinishedAt: formatRFC3339(runStatus.FinishedAt),
+		Error:      runStatus.Error,
+	}
+	for _, instance := range runStatus.Instances {
+		res.Instances = append(res.Instances, &grpcapi.InstanceStatus{
+			Instance:  instance.Instance,
+			State:     string(instance.State),
+			Step:      instance.Step,
+			Outcome:   instance.Outcome,
+			Decision:  instance.Decision,
+			Error:     instance.Error,
+			ExpiresAt: formatRFC3339(instance.ExpiresAt),
+		})
+	}
+	return res, nil
+}
+
+func (s *controlServer) StreamEvents(req *grpcapi.StreamEventsRequest, stream grpc.ServerStreamingServer[grpcapi.Event]) error {
+	events, unsubscribe, err := s.runner.Subscribe(req.RunId)
+	if err != nil {
+		return grpcError(err)
+	}
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+
+			msg := &grpcapi.Event{
+				Time:      formatRFC3339(&event.Time),
+				Type:      string(event.Type),
+				RunId:     event.RunID,
+				Profile:   event.Profile,
+				Instance:  event.Instance,
+				Index:     int32(event.Index),
+				Total:     int32(event.Total),
+				Step:      event.Step,
+				Outcome:   event.Outcome,
+				Decision:  event.Decision,
+				Error:     event.Error,
+				ExpiresAt: formatRFC3339(event.ExpiresAt),
+			}
+			for _, change := range event.Changes {
+				msg.Changes = append(msg.Changes, &grpcapi.FieldChange{
+					Field: change.Field,
+					Old:   change.Old,
+					New:   change.New,
+				})
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *controlServer) CancelInstance(ctx context.Context, req *grpcapi.CancelInstanceRequest) (*grpcapi.CancelInstanceResponse, error) {
+	if err := s.runner.CancelInstance(req.RunId, req.Instance); err != nil {
+		return nil, grpcError(err)
+	}
+	return &grpcapi.CancelInstanceResponse{}, nil
+}
@@ -0,0 +1,4 @@
+// Package grpcapi holds the code generated from proto/control.proto.
+package grpcapi
+
+//go:generate protoc --proto_path=../proto --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative control.proto
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/state"
+)
+
+// SelectorProfileVersion is bumped whenever page selectors change, so alerts can tell which set a deployment runs.
+const SelectorProfileVersion = "2"
+
+var atlassianSessionCookies = []string{"cloud.session.token", "tenant.session.token"}
+
+type SessionHealth struct {
+	Valid       bool       `json:"valid"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	RefreshedAt *time.Time `json:"refreshedAt,omitempty"`
+	Error       string     `json:"error,omitempty"`
+}
+
+type Health struct {
+	Status           string        `json:"status"`
+	SelectorProfile  string        `json:"selectorProfile"`
+	AtlassianSession SessionHealth `json:"atlassianSession"`
+	Paused           *state.Pause  `json:"paused,omitempty"`
+	LastRun          *RunStatus    `json:"lastRun,omitempty"`
+}
+
+// AtlassianSessionHealth inspects the stored atlassian session without opening a browser.
+func AtlassianSessionHealth(now time.Time) SessionHealth {
+	var health SessionHealth
+
+	path := atlassianSessionFile()
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			health.Error = "no stored session"
+		} else {
+			health.Error = err.Error()
+		}
+		return health
+	}
+	refreshedAt := info.ModTime()
+	health.RefreshedAt = &refreshedAt
+
+	session, err := ReadSessionFile(path)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	for _, cookie := range session.Cookies {
+		if !matchSessionDomain(cookie.Domain, atlassianSessionDomains) || !slices.Contains(atlassianSessionCookies, cookie.Name) {
+			continue
+		}
+		if cookie.Expires < 0 {
+			// session cookie, valid as long as the stored state is used
+			health.Valid = true
+			continue
+		}
+
+		sec, frac := math.Modf(cookie.Expires)
+		expiresAt := time.Unix(int64(sec), int64(frac*1e9))
+		if expiresAt.After(now) {
+			health.Valid = true
+			if health.ExpiresAt == nil || expiresAt.Before(*health.ExpiresAt) {
+				health.ExpiresAt = &expiresAt
+			}
+		}
+	}
+	if !health.Valid {
+		health.Error = "session cookies are missing or expired"
+	}
+
+	return health
+}
+
+func (r *Runner) Health() Health {
+	health := Health{
+		Status:           "ok",
+		SelectorProfile:  SelectorProfileVersion,
+		AtlassianSession: AtlassianSessionHealth(time.Now()),
+	}
+
+	if store, err := OpenState(); err == nil {
+		health.Paused = store.Paused()
+	}
+	if status, err := r.Status(""); err == nil {
+		health.LastRun = &status
+	}
+
+	// without a stored session the browser profile is used, which cannot be checked cheaply
+	sessionStored := health.AtlassianSession.RefreshedAt != nil
+	if (sessionStored && !health.AtlassianSession.Valid) || (health.LastRun != nil && health.LastRun.State == RunStateFailed) {
+		health.Status = "degraded"
+	}
+
+	return health
+}
+
+// NewHTTPHandler serves /healthz, which always answers 200 unless ?strict is set, then degraded answers 503,
+// and prometheus metrics on /metrics.
+func NewHTTPHandler(runner *Runner) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, req *http.Request) {
+		health := runner.Health()
+
+		code := http.StatusOK
+		if req.URL.Query().Has("strict") && health.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(health)
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = runner.Metrics().WriteTo(w)
+	})
+	return mux
+}
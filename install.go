@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+)
+
+var skipPlaywrightInstall = os.Getenv("JIRA_AUTO_TRIAL_SKIP_INSTALL") != ""
+
+var playwrightInstall struct {
+	sync.Mutex
+	done bool
+	// record is set when the install happened in this process and the manifest still has to be written
+	record *playwrightInstallStamp
+}
+
+type playwrightInstallStamp struct {
+	Version  string                  `json:"version"`
+	Browsers []string                `json:"browsers"`
+	Files    []playwrightInstallFile `json:"files"`
+}
+
+type playwrightInstallFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	SHA256  string    `json:"sha256"`
+}
+
+func playwrightInstallStampPath() string {
+	return DataPath("playwright", "installed.json")
+}
+
+// EnsurePlaywright installs the driver and browsers once per process. When the manifest of a previous install
+// of the same driver version still matches the files on disk, nothing is downloaded or run, so startup works offline.
+func EnsurePlaywright(runOptions *playwright.RunOptions, cfg config.Playwright) error {
+	playwrightInstall.Lock()
+	defer playwrightInstall.Unlock()
+
+	if playwrightInstall.done {
+		return nil
+	}
+
+	driver, err := playwright.NewDriver(runOptions)
+	if err != nil {
+		return fmt.Errorf("could not get playwright driver: %w", err)
+	}
+
+	stamp := playwrightInstallStamp{Version: driver.Version, Browsers: runOptions.Browsers}
+	var verifyErr error
+	if installed, err := readPlaywrightInstallStamp(); err == nil && len(installed.Files) > 0 && installed.Version == stamp.Version && containsAll(installed.Browsers, stamp.Browsers) {
+		if verifyErr = installed.Verify(); verifyErr == nil {
+			playwrightInstall.done = true
+			return nil
+		}
+	}
+
+	if cfg.SkipInstall || skipPlaywrightInstall {
+		if verifyErr != nil {
+			return fmt.Errorf("playwright install is skipped but the installed files are not usable: %w", verifyErr)
+		}
+		// nothing recorded for this version, the driver was installed by other means
+		return nil
+	}
+
+	if cfg.DownloadHost != "" {
+		// read by both the driver download and the browser install of the playwright cli
+		if err := os.Setenv("PLAYWRIGHT_DOWNLOAD_HOST", strings.TrimSuffix(cfg.DownloadHost, "/")); err != nil {
+			return err
+		}
+	}
+
+	if err := driver.Install(); err != nil {
+		if verifyErr != nil {
+			return fmt.Errorf("playwright driver or browsers are missing (%v) and could not be installed, run once with network access or copy %s and the browsers cache from a working host: %w", verifyErr, DataPath("playwright"), err)
+		}
+		return fmt.Errorf("could not install playwright: %w", err)
+	}
+
+	playwrightInstall.done = true
+	playwrightInstall.record = &stamp
+
+	return nil
+}
+
+// RecordPlaywrightInstall writes the manifest of a fresh install once the browser executables are known.
+func RecordPlaywrightInstall(pw *playwright.Playwright, runOptions *playwright.RunOptions) error {
+	playwrightInstall.Lock()
+	defer playwrightInstall.Unlock()
+
+	stamp := playwrightInstall.record
+	if stamp == nil {
+		return nil
+	}
+	playwrightInstall.record = nil
+
+	driverDirectory := filepath.Join(runOptions.DriverDirectory, "ms-playwright-go", stamp.Version)
+	node := "node"
+	if runtime.GOOS == "windows" {
+		node = "node.exe"
+	}
+	paths := []string{
+		filepath.Join(driverDirectory, node),
+		filepath.Join(driverDirectory, "package", "cli.js"),
+	}
+	for _, name := range stamp.Browsers {
+		browserType := map[string]playwright.BrowserType{
+			"chromium": pw.Chromium,
+			"firefox":  pw.Firefox,
+			"webkit":   pw.WebKit,
+		}[name]
+		if browserType != nil {
+			paths = append(paths, browserType.ExecutablePath())
+		}
+	}
+
+	for _, path := range paths {
+		file, err := statPlaywrightInstallFile(path, true)
+		if err != nil {
+			return fmt.Errorf("could not record playwright install: %w", err)
+		}
+		stamp.Files = append(stamp.Files, *file)
+	}
+
+	return writePlaywrightInstallStamp(*stamp)
+}
+
+// ForgetPlaywrightInstall makes the next EnsurePlaywright verify the install again, e.g. after the browser failed to launch.
+func ForgetPlaywrightInstall() {
+	playwrightInstall.Lock()
+	defer playwrightInstall.Unlock()
+
+	playwrightInstall.done = false
+	playwrightInstall.record = nil
+}
+
+// Verify checks that every recorded file exists, hashing only files whose size or modification time changed.
+func (s *playwrightInstallStamp) Verify() error {
+	for _, want := range s.Files {
+		have, err := statPlaywrightInstallFile(want.Path, false)
+		if err != nil {
+			return err
+		}
+		if have.Size == want.Size && have.ModTime.Equal(want.ModTime) {
+			continue
+		}
+
+		if have.Size != want.Size {
+			return fmt.Errorf("%s was modified since install", want.Path)
+		}
+		if have, err = statPlaywrightInstallFile(want.Path, true); err != nil {
+			return err
+		}
+		if have.SHA256 != want.SHA256 {
+			return fmt.Errorf("%s was modified since install", want.Path)
+		}
+	}
+
+	return nil
+}
+
+func statPlaywrightInstallFile(path string, hash bool) (*playwrightInstallFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &playwrightInstallFile{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+	if !hash {
+		return file, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("could not hash %s: %w", path, err)
+	}
+	file.SHA256 = hex.EncodeToString(h.Sum(nil))
+
+	return file, nil
+}
+
+func readPlaywrightInstallStamp() (*playwrightInstallStamp, error) {
+	data, err := os.ReadFile(playwrightInstallStampPath())
+	if err != nil {
+		return nil, err
+	}
+
+	var stamp playwrightInstallStamp
+	if err := json.Unmarshal(data, &stamp); err != nil {
+		return nil, fmt.Errorf("could not decode playwright install manifest: %w", err)
+	}
+	if stamp.Version == "" {
+		return nil, errors.New("install manifest has no version")
+	}
+
+	return &stamp, nil
+}
+
+func writePlaywrightInstallStamp(stamp playwrightInstallStamp) error {
+	data, err := json.MarshalIndent(stamp, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(playwrightInstallStampPath(), data, 0600); err != nil {
+		return fmt.Errorf("could not write playwright install manifest: %w", err)
+	}
+	return nil
+}
+
+func containsAll(have, want []string) bool {
+	for _, item := range want {
+		if !slices.Contains(have, item) {
+			return false
+		}
+	}
+	return true
+}
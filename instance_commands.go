@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+func FindInstance(cfg *config.Config, name string) (config.JiraInstance, error) {
+	for _, instance := range cfg.Instances {
+		baseURL := strings.TrimSuffix(URLRewriter(instance.URLRewrite).Reverse(name), "/")
+		if strings.TrimSuffix(instance.BaseURL, "/") == baseURL || instance.Name == name || InstanceHost(instance) == name {
+			return instance, nil
+		}
+	}
+	return config.JiraInstance{}, fmt.Errorf("instance not found: %s", name)
+}
+
+func withInstancePage(ctx context.Context, cfg *config.Config, instance config.JiraInstance, fn func(ctx context.Context, page playwright.Page, product *Product) error) error {
+	product, err := InstanceProduct(instance)
+	if err != nil {
+		return err
+	}
+
+	ctx = WithPlaywrightTimeouts(ctx, cfg.Playwright)
+	browser, err := OpenBrowser(cfg)
+	if err != nil {
+		return err
+	}
+	defer browser.Close()
+
+	page, closePage, err := browser.NewSessionPage(InstanceSessionKey(instance))
+	if err != nil {
+		return err
+	}
+	defer closePage()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	g, ctx := errgroup.WithContext(ctx)
+	product.StartHandlers(ctx, g, page, instance.Account)
+	if err := StartURLRewrite(ctx, g, page, instance.URLRewrite); err != nil {
+		return err
+	}
+
+	err = fn(ctx, page, product)
+	cancel()
+	_ = g.Wait()
+
+	return err
+}
+
+type ResolveResult struct {
+	BaseURL          string     `json:"baseURL"`
+	ServerID         string     `json:"serverId"`
+	TrialExpiresAt   *time.Time `json:"trialExpiresAt"`
+	SEN              string     `json:"sen"`
+	LicenseType      string     `json:"licenseType"`
+	OrganisationName string     `json:"organisationName"`
+	LicenseKey       string     `json:"licenseKey"`
+}
+
+func resolveCommand() *Command {
+	cmd := &Command{
+		Name:  "resolve",
+		Usage: "jira-auto-trial resolve -instance name",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		name := fs.String("instance", "", "instance name, base url or host")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if *name == "" {
+			fs.Usage()
+			return fmt.Errorf("-instance is required")
+		}
+
+		cfg, err := configFlags.Load()
+		if err != nil {
+			return err
+		}
+
+		instance, err := FindInstance(cfg, *name)
+		if err != nil {
+			return err
+		}
+
+		result := ResolveResult{BaseURL: instance.BaseURL}
+
+		if err := withInstancePage(ctx, cfg, instance, func(ctx context.Context, page playwright.Page, product *Product) error {
+			log.Info("resolving license details", zap.String("instance", instance.BaseURL))
+
+			licenseDetails, err := product.ResolveLicenseDetails(ctx, page, ResolveLicenseDetailsParams{
+				BaseURL: NavigationBaseURL(instance),
+			})
+			if err != nil {
+				return fmt.Errorf("resolving license details: %w", err)
+			}
+
+			log.Info("resolving server id", zap.String("instance", instance.BaseURL))
+
+			serverID, err := product.ResolveServerID(ctx, page, ResolveServerIDParams{
+				BaseURL: NavigationBaseURL(instance),
+			})
+			if err != nil {
+				return fmt.Errorf("resolving server id: %w", err)
+			}
+
+			result.ServerID = serverID
+			result.TrialExpiresAt = licenseDetails.TrialExpiresAt
+			result.SEN = licenseDetails.SEN
+			result.LicenseType = licenseDetails.LicenseType
+			result.OrganisationName = licenseDetails.OrganisationName
+			result.LicenseKey = PersistableLicenseKey(licenseDetails.LicenseKey, cfg.NoPersistKeys)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		return WriteJSON(os.Stdout, result)
+	}
+
+	return cmd
+}
+
+func applyCommand() *Command {
+	cmd := &Command{
+		Name:  "apply",
+		Usage: "jira-auto-trial apply -instance name -key-file file",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		name := fs.String("instance", "", "instance name, base url or host")
+		keyFile := fs.String("key-file", "", "file containing the license key, - for stdin")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if *name == "" || *keyFile == "" {
+			fs.Usage()
+			return fmt.Errorf("-instance and -key-file are required")
+		}
+
+		cfg, err := configFlags.Load()
+		if err != nil {
+			return err
+		}
+
+		instance, err := FindInstance(cfg, *name)
+		if err != nil {
+			return err
+		}
+
+		licenseKey, err := ReadLicenseKeyFile(*keyFile)
+		if err != nil {
+			return err
+		}
+
+		return withInstancePage(ctx, cfg, instance, func(ctx context.Context, page playwright.Page, product *Product) error {
+			log.Info("updating license key", zap.String("instance", instance.BaseURL))
+
+			if err := product.UpdateLicenseKey(ctx, page, UpdateLicenseKeyParams{
+				BaseURL:    NavigationBaseURL(instance),
+				LicenseKey: licenseKey,
+			}); err != nil {
+				return fmt.Errorf("updating license key: %w", err)
+			}
+
+			log.Info("license key updated", zap.String("instance", instance.BaseURL))
+			return nil
+		})
+	}
+
+	return cmd
+}
+
+func restoreLicenseCommand() *Command {
+	cmd := &Command{
+		Name:  "restore-license",
+		Usage: "jira-auto-trial restore-license -instance name [-backup file] [-list]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		name := fs.String("instance", "", "instance name, base url or host")
+		backupPath := fs.String("backup", "", "backup file to restore, the latest backup of the instance if empty")
+		list := fs.Bool("list", false, "list the backups of the instance instead of restoring")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if *name == "" {
+			fs.Usage()
+			return fmt.Errorf("-instance is required")
+		}
+
+		cfg, err := configFlags.Load()
+		if err != nil {
+			return err
+		}
+
+		instance, err := FindInstance(cfg, *name)
+		if err != nil {
+			return err
+		}
+
+		if *list || *backupPath == "" {
+			paths, err := ListLicenseBackups(InstanceName(instance))
+			if err != nil {
+				return err
+			}
+			if *list {
+				for _, path := range paths {
+					fmt.Println(path)
+				}
+				return nil
+			}
+			if len(paths) == 0 {
+				return fmt.Errorf("no backups of %s in %s", InstanceName(instance), LicenseBackupDir(InstanceName(instance)))
+			}
+			*backupPath = paths[0]
+		}
+
+		backup, err := ReadLicenseBackup(*backupPath)
+		if err != nil {
+			return err
+		}
+		if backup.LicenseKey == "" || strings.HasPrefix(backup.LicenseKey, "sha256:") {
+			return fmt.Errorf("backup %s has no license key, it was written with noPersistKeys or the key was not readable", *backupPath)
+		}
+
+		return withInstancePage(ctx, cfg, instance, func(ctx context.Context, page playwright.Page, product *Product) error {
+			log.Info(
+				"restoring license key",
+				zap.String("instance", instance.BaseURL),
+				zap.String("backup", *backupPath),
+				zap.String("application", backup.ApplicationKey),
+				zap.String("trial expires at", formatDate(backup.TrialExpiresAt)),
+			)
+
+			if err := product.UpdateLicenseKey(ctx, page, UpdateLicenseKeyParams{
+				BaseURL:        NavigationBaseURL(instance),
+				ApplicationKey: backup.ApplicationKey,
+				LicenseKey:     backup.LicenseKey,
+				Account:        instance.Account,
+
+				ServiceManagement: instance.ServiceManagement,
+			}); err != nil {
+				return fmt.Errorf("restoring license key: %w", err)
+			}
+
+			log.Info("license key restored", zap.String("instance", instance.BaseURL))
+			return nil
+		})
+	}
+
+	return cmd
+}
+
+func ReadLicenseKeyFile(path string) (string, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading license key: %w", err)
+	}
+
+	licenseKey := strings.Join(strings.Fields(string(data)), "")
+	if licenseKey == "" {
+		return "", fmt.Errorf("license key file is empty")
+	}
+
+	return licenseKey, nil
+}
+
+func explainCommand() *Command {
+	cmd := &Command{
+		Name:  "explain",
+		Usage: "jira-auto-trial explain -instance name [-force] [-dry-run] [-format text|json]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		name := fs.String("instance", "", "instance name, base url or host")
+		force := fs.Bool("force", false, "explain a run with -force")
+		dryRun := fs.Bool("dry-run", false, "explain a run with -dry-run")
+		format := fs.String("format", "text", "output format: text or json")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if *name == "" {
+			fs.Usage()
+			return fmt.Errorf("-instance is required")
+		}
+
+		cfg, err := configFlags.Load()
+		if err != nil {
+			return err
+		}
+
+		instance, err := FindInstance(cfg, *name)
+		if err != nil {
+			return err
+		}
+
+		store, err := OpenState()
+		if err != nil {
+			return err
+		}
+
+		explanation, err := Explain(cfg, ExplainParams{
+			Instance: instance,
+			Previous: store.Instance(instance.BaseURL),
+			Force:    *force,
+			DryRun:   *dryRun,
+			Now:      time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		if *format == "json" {
+			return WriteJSON(os.Stdout, explanation)
+		}
+		return explanation.WriteText(os.Stdout)
+	}
+
+	return cmd
+}
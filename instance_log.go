@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var unsafeFileNameRe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func SafeFileName(name string) string {
+	return unsafeFileNameRe.ReplaceAllString(name, "_")
+}
+
+func RunDir(runID string) string {
+	return DataPath("runs", runID)
+}
+
+func OpenInstanceLog(log *zap.Logger, runID string, name string) (*zap.Logger, func() error, error) {
+	dir := filepath.Join(RunDir(runID), "instances")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("error creating instance log directory: %w", err)
+	}
+
+	path := filepath.Join(dir, SafeFileName(name)+".log")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating instance log: %w", err)
+	}
+
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	fileCore := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.AddSync(file), zap.DebugLevel)
+
+	instanceLog := log.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(core, fileCore)
+	}))
+
+	return instanceLog, func() error {
+		_ = instanceLog.Sync()
+		return file.Close()
+	}, nil
+}
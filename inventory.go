@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InventoryMapping maps columns of a CMDB export to instance fields, account is a template with {{column}} placeholders.
+type InventoryMapping struct {
+	Format  string `yaml:"format"`
+	Columns struct {
+		Name     string `yaml:"name"`
+		BaseURL  string `yaml:"baseURL"`
+		Product  string `yaml:"product"`
+		Disabled string `yaml:"disabled"`
+	} `yaml:"columns"`
+	Account yaml.Node `yaml:"account"`
+}
+
+type ImportedInstance struct {
+	Name     string     `yaml:"name,omitempty"`
+	Product  string     `yaml:"product,omitempty"`
+	BaseURL  string     `yaml:"baseURL"`
+	Disabled bool       `yaml:"disabled,omitempty"`
+	Account  *yaml.Node `yaml:"account,omitempty"`
+}
+
+var (
+	inventoryPlaceholderPattern = regexp.MustCompile(`\{\{\s*([^}|]+?)\s*(?:\|\s*(\w+)\s*)?\}\}`)
+	inventorySlugPattern        = regexp.MustCompile(`[^A-Za-z0-9]+`)
+)
+
+func ReadInventoryMapping(path string) (*InventoryMapping, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read mapping: %w", err)
+	}
+
+	var mapping InventoryMapping
+	if err := yaml.Unmarshal(data, &mapping); err != nil {
+		return nil, fmt.Errorf("could not decode mapping: %w", err)
+	}
+	if mapping.Columns.BaseURL == "" {
+		return nil, fmt.Errorf("mapping has no baseURL column")
+	}
+
+	return &mapping, nil
+}
+
+// ReadInventoryRows reads a csv with a header row, or a json array of objects (optionally under "records" or "result").
+func ReadInventoryRows(r io.Reader, format string) ([]map[string]string, error) {
+	switch format {
+	case "csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("could not read csv: %w", err)
+		}
+		if len(records) == 0 {
+			return nil, nil
+		}
+
+		header := records[0]
+		rows := make([]map[string]string, 0, len(records)-1)
+		for _, record := range records[1:] {
+			row := make(map[string]string, len(header))
+			for i, column := range header {
+				if i < len(record) {
+					row[strings.TrimSpace(column)] = strings.TrimSpace(record[i])
+				}
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+
+	case "json":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+
+		var items []map[string]any
+		if err := json.Unmarshal(data, &items); err != nil {
+			var wrapped struct {
+				Records []map[string]any `json:"records"`
+				Result  []map[string]any `json:"result"`
+			}
+			if err := json.Unmarshal(data, &wrapped); err != nil {
+				return nil, fmt.Errorf("could not decode json: %w", err)
+			}
+			items = append(wrapped.Records, wrapped.Result...)
+		}
+
+		rows := make([]map[string]string, 0, len(items))
+		for _, item := range items {
+			row := make(map[string]string, len(item))
+			for key, value := range item {
+				switch value := value.(type) {
+				case nil:
+				case string:
+					row[key] = strings.TrimSpace(value)
+				default:
+					row[key] = fmt.Sprint(value)
+				}
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+
+	default:
+		return nil, fmt.Errorf("unknown inventory format: %s", format)
+	}
+}
+
+func ImportInventory(rows []map[string]string, mapping *InventoryMapping) ([]ImportedInstance, error) {
+	instances := make([]ImportedInstance, 0, len(rows))
+	for i, row := range rows {
+		instance := ImportedInstance{
+			Name:    row[mapping.Columns.Name],
+			Product: strings.ToLower(row[mapping.Columns.Product]),
+			BaseURL: strings.TrimSuffix(row[mapping.Columns.BaseURL], "/"),
+		}
+		if instance.BaseURL == "" {
+			return nil, fmt.Errorf("row %d: column %q is empty", i+1, mapping.Columns.BaseURL)
+		}
+		if _, ok := products[instance.Product]; instance.Product != "" && !ok {
+			return nil, fmt.Errorf("row %d: unknown product %q", i+1, instance.Product)
+		}
+		if mapping.Columns.Disabled != "" {
+			if value := row[mapping.Columns.Disabled]; value != "" {
+				disabled, err := strconv.ParseBool(strings.ToLower(value))
+				if err != nil {
+					disabled = strings.EqualFold(value, "yes") || strings.EqualFold(value, "y")
+				}
+				instance.Disabled = disabled
+			}
+		}
+
+		if !mapping.Account.IsZero() {
+			account, err := expandInventoryTemplate(&mapping.Account, row)
+			if err != nil {
+				return nil, fmt.Errorf("row %d: %w", i+1, err)
+			}
+			instance.Account = account
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+func expandInventoryTemplate(node *yaml.Node, row map[string]string) (*yaml.Node, error) {
+	result := *node
+	if node.Kind == yaml.ScalarNode {
+		var err error
+		result.Value = inventoryPlaceholderPattern.ReplaceAllStringFunc(node.Value, func(match string) string {
+			groups := inventoryPlaceholderPattern.FindStringSubmatch(match)
+			value, ok := row[groups[1]]
+			if !ok {
+				err = fmt.Errorf("unknown column %q in account template", groups[1])
+			}
+			switch groups[2] {
+			case "":
+			case "upper":
+				value = strings.ToUpper(value)
+			case "lower":
+				value = strings.ToLower(value)
+			case "env":
+				value = strings.Trim(strings.ToUpper(inventorySlugPattern.ReplaceAllString(value, "_")), "_")
+			default:
+				err = fmt.Errorf("unknown filter %q in account template", groups[2])
+			}
+			return value
+		})
+		return &result, err
+	}
+
+	result.Content = make([]*yaml.Node, 0, len(node.Content))
+	for _, child := range node.Content {
+		expanded, err := expandInventoryTemplate(child, row)
+		if err != nil {
+			return nil, err
+		}
+		result.Content = append(result.Content, expanded)
+	}
+	return &result, nil
+}
+
+func WriteImportedInstances(w io.Writer, instances []ImportedInstance) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(map[string]any{"instances": instances}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
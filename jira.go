@@ -4,31 +4,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/credentials"
+	"github.com/tarik02/jira-auto-trial/dates"
+	"github.com/tarik02/jira-auto-trial/licenses"
 	"golang.org/x/sync/errgroup"
 )
 
 type JiraLoginHandler struct {
-	CredentialsResolver func(ctx context.Context) (string, string, error)
+	CredentialsResolver func(ctx context.Context) (string, credentials.Secret, error)
 	RememberMe          bool
 }
 
-func TimeParseAny(formats []string, value string) (time.Time, error) {
-	errs := make([]error, 0)
-	for _, format := range formats {
-		if date, err := time.Parse(format, value); err != nil {
-			errs = append(errs, err)
-		} else {
-			return date, nil
-		}
-	}
-
-	return time.Time{}, errors.Join(errs...)
-}
-
-func RunPageLocator(ctx context.Context, locator playwright.Locator, cb func(ctx context.Context, locator playwright.Locator) error, options ...playwright.PageAddLocatorHandlerOptions) error {
+// RunPageLocator calls cb whenever the locator shows up on the page, until ctx is done or cb fails. Each call is
+// bounded by the timeout of the handler name in playwright.handlerTimeouts.
+func RunPageLocator(ctx context.Context, name string, locator playwright.Locator, cb func(ctx context.Context, locator playwright.Locator) error, options ...playwright.PageAddLocatorHandlerOptions) error {
 	page, err := locator.Page()
 	if err != nil {
 		return err
@@ -36,7 +30,9 @@ func RunPageLocator(ctx context.Context, locator playwright.Locator, cb func(ctx
 
 	ctx, cancel := context.WithCancelCause(ctx)
 	if err := page.AddLocatorHandler(locator, func(l playwright.Locator) {
-		if err := cb(ctx, l); err != nil {
+		handlerCtx, cancelHandler := handlerContext(ctx, name)
+		defer cancelHandler()
+		if err := cb(handlerCtx, l); err != nil {
 			cancel(err)
 		}
 	}, options...); err != nil {
@@ -53,29 +49,30 @@ func (s *JiraLoginHandler) Run(ctx context.Context, page playwright.Page) error
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
-		return RunPageLocator(ctx, page.Locator(`//form[contains(@action, "/login.jsp")]`), func(ctx context.Context, locator playwright.Locator) error {
+		return RunPageLocator(ctx, "login", page.Locator(`//form[contains(@action, "/login.jsp")]`), func(ctx context.Context, locator playwright.Locator) error {
 			username, password, err := s.CredentialsResolver(ctx)
 			if err != nil {
 				return err
 			}
-			if err := locator.Locator(`[name="os_password"]`).Fill(password); err != nil {
+			defer password.Wipe()
+			if err := Fill(ctx, locator.Locator(`[name="os_password"]`), password.Reveal()); err != nil {
 				return err
 			}
-			if err := locator.Locator(`[name="os_username"]`).First().Fill(username); err != nil {
+			if err := Fill(ctx, locator.Locator(`[name="os_username"]`).First(), username); err != nil {
 				return err
 			}
 			if s.RememberMe {
-				if err := locator.Locator(`[for="login-form-remember-me"]`).Check(playwright.LocatorCheckOptions{
+				if err := Check(ctx, locator.Locator(`[for="login-form-remember-me"]`), playwright.LocatorCheckOptions{
 					Force: playwright.Bool(true),
 				}); err != nil {
 					return err
 				}
 			}
-			if err := locator.Locator(`[name="login"]`).Click(); err != nil {
+			if err := Click(ctx, locator.Locator(`[name="login"]`)); err != nil {
 				return err
 			}
 
-			if err := locator.WaitFor(playwright.LocatorWaitForOptions{
+			if err := WaitFor(ctx, locator, playwright.LocatorWaitForOptions{
 				State: playwright.WaitForSelectorStateHidden,
 			}); err != nil {
 				return err
@@ -91,27 +88,162 @@ func (s *JiraLoginHandler) Run(ctx context.Context, page playwright.Page) error
 				return err
 			}
 
-			return fmt.Errorf("login error: %s", loginErr)
+			return fmt.Errorf("%w: %s", ErrLoginFailed, loginErr)
 		})
 	})
 
 	return g.Wait()
 }
 
+func StartJiraHandlers(ctx context.Context, g *errgroup.Group, page playwright.Page, account config.Account) {
+	_ = g.TryGo(func() error {
+		return (&JiraLoginHandler{
+			CredentialsResolver: func(ctx context.Context) (string, credentials.Secret, error) {
+				creds, err := credentials.ResolveCredentials(ctx, account)
+				if err != nil {
+					return "", credentials.Secret{}, err
+				}
+				return creds.Username, creds.Password, nil
+			},
+			RememberMe: true,
+		}).Run(ctx, page)
+	})
+
+	// stopped once the licenses page shows that websudo is disabled
+	webSudo := webSudoFrom(ctx)
+	_ = g.TryGo(func() error {
+		return webSudo.run(ctx, func(ctx context.Context) error {
+			return (&JiraSudoHandler{
+				PasswordResolver: func(ctx context.Context) (credentials.Secret, error) {
+					webSudo.markPrompted()
+					creds, err := credentials.ResolveCredentials(ctx, account)
+					if err != nil {
+						return credentials.Secret{}, err
+					}
+					return creds.Password, nil
+				},
+			}).Run(ctx, page)
+		})
+	})
+
+	_ = g.TryGo(func() error {
+		return (&JiraExpiredLicenseHandler{}).Run(ctx, page)
+	})
+}
+
+// WebSudo tracks the websudo prompt of a jira instance. The licenses page is guarded by websudo, so when it loads
+// without a prompt and without the banner of an active websudo session, websudo is disabled on the instance
+// (jira.websudo.is.disabled) and the sudo handler is stopped instead of waiting for a form that never shows up.
+type WebSudo struct {
+	mu       sync.Mutex
+	prompted bool
+	disabled bool
+	cancel   context.CancelFunc
+}
+
+type webSudoKey struct{}
+
+func WithWebSudo(ctx context.Context) (context.Context, *WebSudo) {
+	w := &WebSudo{}
+	return context.WithValue(ctx, webSudoKey{}, w), w
+}
+
+func webSudoFrom(ctx context.Context) *WebSudo {
+	w, _ := ctx.Value(webSudoKey{}).(*WebSudo)
+	return w
+}
+
+func (w *WebSudo) Disabled() bool {
+	if w == nil {
+		return false
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.disabled
+}
+
+func (w *WebSudo) markPrompted() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.prompted = true
+}
+
+// run runs the sudo handler until ctx is done, stopping it without an error once websudo turns out to be disabled.
+func (w *WebSudo) run(ctx context.Context, handler func(ctx context.Context) error) error {
+	if w == nil {
+		return handler(ctx)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w.mu.Lock()
+	w.cancel = cancel
+	disabled := w.disabled
+	w.mu.Unlock()
+	if disabled {
+		return nil
+	}
+
+	err := handler(ctx)
+	if w.Disabled() {
+		return nil
+	}
+	return err
+}
+
+// check is called once the licenses page has loaded, websudo is kept when the banner cannot be looked up.
+func (w *WebSudo) check(page playwright.Page) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	prompted := w.prompted
+	w.mu.Unlock()
+	if prompted {
+		return
+	}
+
+	if banners, err := page.Locator(`#websudo-banner`).Count(); err != nil || banners > 0 {
+		return
+	}
+
+	w.mu.Lock()
+	w.disabled = true
+	cancel := w.cancel
+	w.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// JiraExpiredLicenseHandler dismisses the dialogs and flags an expired license puts over admin pages.
+type JiraExpiredLicenseHandler struct{}
+
+func (s *JiraExpiredLicenseHandler) Run(ctx context.Context, page playwright.Page) error {
+	locator := page.Locator(`//*[(@role="dialog" or contains(concat(" ", @class, " "), " aui-flag ")) and contains(., "expired") and contains(., "licen")]//button[contains(concat(" ", @class, " "), " aui-close-button ") or contains(concat(" ", @class, " "), " icon-close ") or normalize-space()="Close" or normalize-space()="Remind me later"]`)
+	return RunPageLocator(ctx, "expiredLicense", locator, func(ctx context.Context, locator playwright.Locator) error {
+		return Click(ctx, locator.First())
+	})
+}
+
 type JiraSudoHandler struct {
-	PasswordResolver func(ctx context.Context) (string, error)
+	PasswordResolver func(ctx context.Context) (credentials.Secret, error)
 }
 
 func (s *JiraSudoHandler) Run(ctx context.Context, page playwright.Page) error {
-	return RunPageLocator(ctx, page.Locator(`//form[contains(@action, "/WebSudoAuthenticate.jspa")]`), func(ctx context.Context, locator playwright.Locator) error {
+	return RunPageLocator(ctx, "websudo", page.Locator(`//form[contains(@action, "/WebSudoAuthenticate.jspa")]`), func(ctx context.Context, locator playwright.Locator) error {
 		password, err := s.PasswordResolver(ctx)
 		if err != nil {
 			return err
 		}
-		if err := locator.Locator(`[name="webSudoPassword"]`).Fill(password); err != nil {
+		defer password.Wipe()
+		if err := Fill(ctx, locator.Locator(`[name="webSudoPassword"]`), password.Reveal()); err != nil {
 			return err
 		}
-		if err := locator.Locator(`[type="submit"]`).Click(); err != nil {
+		if err := Click(ctx, locator.Locator(`[type="submit"]`)); err != nil {
 			return err
 		}
 
@@ -124,16 +256,67 @@ type ResolveServerIDParams struct {
 }
 
 func ResolveServerID(ctx context.Context, page playwright.Page, params ResolveServerIDParams) (string, error) {
-	if _, err := page.Goto(fmt.Sprintf("%s/secure/admin/ViewSystemInfo.jspa", params.BaseURL)); err != nil {
+	if serverID, err := resolveServerIDREST(page, params.BaseURL); err == nil {
+		return serverID, nil
+	}
+
+	return resolveServerIDSystemInfo(ctx, page, params)
+}
+
+func fetchJiraJSON(page playwright.Page, url string, v any) error {
+	res, err := page.Request().Get(url, playwright.APIRequestContextGetOptions{
+		Headers:          map[string]string{"Accept": "application/json"},
+		MaxRedirects:     playwright.Int(0),
+		FailOnStatusCode: playwright.Bool(false),
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Dispose()
+
+	if !res.Ok() {
+		return fmt.Errorf("%s: %d %s", url, res.Status(), res.StatusText())
+	}
+	return res.JSON(v)
+}
+
+// resolveServerIDREST reads the server id with the page session, it fails when the session is not logged in yet.
+func resolveServerIDREST(page playwright.Page, baseURL string) (string, error) {
+	var serverInfo struct {
+		ServerID string `json:"serverId"`
+	}
+	if err := fetchJiraJSON(page, baseURL+"/rest/api/2/serverInfo", &serverInfo); err == nil && serverInfo.ServerID != "" {
+		return ValidateServerID(serverInfo.ServerID)
+	}
+
+	var property struct {
+		Value string `json:"value"`
+	}
+	if err := fetchJiraJSON(page, baseURL+"/rest/api/2/application-properties?key=jira.sid.key", &property); err != nil {
+		return "", fmt.Errorf("could not read server id property: %w", err)
+	}
+	return ValidateServerID(property.Value)
+}
+
+func resolveServerIDSystemInfo(ctx context.Context, page playwright.Page, params ResolveServerIDParams) (string, error) {
+	if _, err := Goto(ctx, page, fmt.Sprintf("%s/secure/admin/ViewSystemInfo.jspa", params.BaseURL)); err != nil {
 		return "", fmt.Errorf("could not navigate to system info: %w", err)
 	}
 
+	if gate, err := jiraLicenseGateVisible(page); err != nil {
+		return "", err
+	} else if gate {
+		return resolveJiraGateServerID(ctx, page)
+	}
+
 	cellLocator := page.Locator(`//tr[td[@class='cell-type-key']/strong[text()='Server ID']]/td[@class='cell-type-value']`)
-	if err := cellLocator.Click(); err != nil {
+	if err := TrackSelector(ctx, "jira.system-info.server-id", Click(ctx, cellLocator)); err != nil {
 		return "", err
 	}
 
-	res, err := cellLocator.TextContent()
+	res, err := ExtractServerID(func() (string, error) {
+		return cellLocator.TextContent()
+	})
 	if err != nil {
 		return "", fmt.Errorf("error extracting server id from page: %w", err)
 	}
@@ -141,6 +324,147 @@ func ResolveServerID(ctx context.Context, page playwright.Page, params ResolveSe
 	return res, nil
 }
 
+var jiraApplicationEvaluations = map[string]Application{
+	"jira-software":    {EvaluationProduct: "Jira", EvaluationEdition: "jira-software.data-center"},
+	"jira-servicedesk": {EvaluationProduct: "Jira Service Management", EvaluationEdition: "jira-servicedesk.data-center"},
+	"jira-core":        {EvaluationProduct: "Jira", EvaluationEdition: "jira-core.data-center"},
+}
+
+func jiraApplication(key string) Application {
+	application, ok := jiraApplicationEvaluations[key]
+	if !ok {
+		application = Application{EvaluationProduct: "Jira", EvaluationEdition: key + ".data-center"}
+	}
+	application.Key = key
+	return application
+}
+
+// jiraLicensesLayout holds the locators of one layout of the versions-licenses page, %s is the application key.
+type jiraLicensesLayout struct {
+	Name           string
+	SelectorPrefix string
+
+	Applications string
+	Application  string
+	DetailField  string
+	// attribute of a detail field holding a language independent key, empty when the layout has none
+	DetailKey   string
+	DetailName  string
+	DetailValue string
+	// the raw license key, filled in last when the details arrive over xhr
+	LicenseKeyValue string
+	UpdateLink      string
+	// empty when the update form opens inline in the application section
+	UpdateDialog string
+	UpdateInput  string
+	UpdateSubmit string
+}
+
+var jiraLicensesLayouts = []jiraLicensesLayout{
+	{
+		Name:            "classic",
+		SelectorPrefix:  "jira.licenses",
+		Applications:    `//div[@data-application-key]`,
+		Application:     `//div[@data-application-key="%s"]`,
+		DetailField:     `.license-detail-field`,
+		DetailKey:       `data-field-id`,
+		DetailName:      `dt`,
+		DetailValue:     `.license-string-raw, dd`,
+		LicenseKeyValue: `.license-string-raw`,
+		UpdateLink:      `//*[@class="update-license-key"]`,
+		UpdateInput:     `textarea.license-update-textarea`,
+		UpdateSubmit:    `.license-update-submit`,
+	},
+	{
+		// restyled admin ui of jira 9.12+ and 10.x, behind a dark feature on older versions
+		Name:            "atlaskit",
+		SelectorPrefix:  "jira.atlaskit-licenses",
+		Applications:    `//*[@data-testid="application-license"][@data-application-key]`,
+		Application:     `//*[@data-testid="application-license"][@data-application-key="%s"]`,
+		DetailField:     `[data-testid="license-detail-field"]`,
+		DetailKey:       `data-field-key`,
+		DetailName:      `dt, [data-testid="license-detail-field.label"]`,
+		DetailValue:     `[data-testid="license-detail-field.raw"], dd, [data-testid="license-detail-field.value"]`,
+		LicenseKeyValue: `[data-testid="license-detail-field.raw"]`,
+		UpdateLink:      `[data-testid="update-license-key"]`,
+		UpdateDialog:    `[role="dialog"]`,
+		UpdateInput:     `textarea[name="licenseKey"]`,
+		UpdateSubmit:    `[data-testid="update-license-key.submit"]`,
+	},
+}
+
+func (l *jiraLicensesLayout) SelectorID(name string) string {
+	return l.SelectorPrefix + "." + name
+}
+
+// openJiraLicensesPage navigates to the licenses page and detects which of the known layouts it uses.
+func openJiraLicensesPage(ctx context.Context, page playwright.Page, baseURL string) (*jiraLicensesLayout, error) {
+	if _, err := Goto(ctx, page, fmt.Sprintf("%s/plugins/servlet/applications/versions-licenses", baseURL)); err != nil {
+		return nil, fmt.Errorf("could not navigate to licenses: %w", err)
+	}
+
+	anyLayout := page.Locator(jiraLicenseGate)
+	for _, layout := range jiraLicensesLayouts {
+		anyLayout = anyLayout.Or(page.Locator(layout.Applications))
+	}
+	if err := TrackSelector(ctx, "jira.licenses.layout", WaitFor(ctx, anyLayout.First())); err != nil {
+		if errors.Is(err, playwright.ErrTimeout) {
+			return nil, UnsupportedAdminUI(page, "jira licenses page")
+		}
+		return nil, err
+	}
+
+	if gate, err := jiraLicenseGateVisible(page); err != nil {
+		return nil, err
+	} else if gate {
+		return nil, ErrJiraLicenseGate
+	}
+
+	for i := range jiraLicensesLayouts {
+		layout := &jiraLicensesLayouts[i]
+		count, err := page.Locator(layout.Applications).Count()
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return layout, nil
+		}
+	}
+
+	return nil, UnsupportedAdminUI(page, "jira licenses page")
+}
+
+func ListJiraApplications(ctx context.Context, page playwright.Page, baseURL string) ([]Application, error) {
+	layout, err := openJiraLicensesPage(ctx, page, baseURL)
+	if errors.Is(err, ErrJiraLicenseGate) {
+		// the gate takes a single license, renewing jira software unlocks the instance
+		application := jiraApplicationEvaluations["jira-software"]
+		application.Key = "jira-software"
+		return []Application{application}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	webSudoFrom(ctx).check(page)
+
+	items, err := page.Locator(layout.Applications).All()
+	if err != nil {
+		return nil, err
+	}
+
+	applications := make([]Application, 0, len(items))
+	for _, item := range items {
+		key, err := item.GetAttribute("data-application-key")
+		if err != nil {
+			return nil, err
+		}
+
+		applications = append(applications, jiraApplication(key))
+	}
+
+	return applications, nil
+}
+
 type ResolveLicenseDetailsParams struct {
 	BaseURL        string
 	ApplicationKey string
@@ -152,6 +476,8 @@ type ResolveLicenseDetailsResult struct {
 	LicenseType      string
 	OrganisationName string
 	LicenseKey       string
+	// the instance is locked behind the expired license page, no details could be read
+	Expired bool
 }
 
 func ResolveLicenseDetails(ctx context.Context, page playwright.Page, params ResolveLicenseDetailsParams) (*ResolveLicenseDetailsResult, error) {
@@ -160,16 +486,28 @@ func ResolveLicenseDetails(ctx context.Context, page playwright.Page, params Res
 		applicationKey = "jira-software"
 	}
 
-	if _, err := page.Goto(fmt.Sprintf("%s/plugins/servlet/applications/versions-licenses", params.BaseURL)); err != nil {
-		return nil, fmt.Errorf("could not navigate to licenses: %w", err)
+	layout, err := openJiraLicensesPage(ctx, page, params.BaseURL)
+	if errors.Is(err, ErrJiraLicenseGate) {
+		return &ResolveLicenseDetailsResult{Expired: true}, nil
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	appLocator := page.Locator(fmt.Sprintf(`//div[@data-application-key="%s"]`, applicationKey))
-	if err := appLocator.Click(); err != nil {
+	appLocator := page.Locator(fmt.Sprintf(layout.Application, applicationKey))
+	if err := TrackSelector(ctx, layout.SelectorID("application"), Click(ctx, appLocator)); err != nil {
 		return nil, err
 	}
 
-	detailFields, err := appLocator.Locator(`.license-detail-field`).All()
+	widget := WaitForWidgetParams{Ready: layout.DetailField, Values: layout.LicenseKeyValue}
+	if layout.DetailKey != "" {
+		widget.Attributes = []string{layout.DetailKey}
+	}
+	if err := TrackSelector(ctx, layout.SelectorID("details"), WaitForWidget(ctx, appLocator, widget)); err != nil {
+		return nil, err
+	}
+
+	detailFields, err := appLocator.Locator(layout.DetailField).All()
 	if err != nil {
 		return nil, err
 	}
@@ -177,34 +515,51 @@ func ResolveLicenseDetails(ctx context.Context, page playwright.Page, params Res
 	var result ResolveLicenseDetailsResult
 
 	for _, item := range detailFields {
-		name, err := item.Locator("dt").InnerText()
-		if err != nil {
-			return nil, err
+		// the stable key of the field is preferred, labels depend on the language of the admin ui
+		var (
+			field licenseDetailField
+			ok    bool
+		)
+		if layout.DetailKey != "" {
+			key, err := item.GetAttribute(layout.DetailKey)
+			if err != nil {
+				return nil, err
+			}
+			field, ok = licenseDetailFieldByKey(key)
+		}
+		if !ok {
+			name, err := item.Locator(layout.DetailName).First().InnerText()
+			if err != nil {
+				return nil, err
+			}
+			if field, ok = licenseDetailFieldByLabel(name); !ok {
+				continue
+			}
 		}
 
-		value, err := item.Locator(`.license-string-raw, dd`).First().TextContent()
+		value, err := item.Locator(layout.DetailValue).First().TextContent()
 		if err != nil {
 			return nil, err
 		}
 
-		switch name {
-		case "Trial expires":
-			if date, err := TimeParseAny([]string{"02/Jan/06", "2 Jan 2006"}, value); err != nil {
+		switch field {
+		case licenseFieldTrialExpires:
+			if date, err := dates.Parse(value, time.Now()); err != nil {
 				return nil, err
 			} else {
 				result.TrialExpiresAt = &date
 			}
 
-		case "Support entitlement number (SEN)":
+		case licenseFieldSEN:
 			result.SEN = value
 
-		case "License type":
+		case licenseFieldLicenseType:
 			result.LicenseType = value
 
-		case "Organisation name":
+		case licenseFieldOrganisation:
 			result.OrganisationName = value
 
-		case "License key":
+		case licenseFieldLicenseKey:
 			result.LicenseKey = value
 		}
 	}
@@ -212,47 +567,195 @@ func ResolveLicenseDetails(ctx context.Context, page playwright.Page, params Res
 	return &result, nil
 }
 
-type UpdateJiraLicenseKeyParams struct {
+// UpdateJiraLicenseKeyREST applies the license key over REST, personal access tokens skip websudo.
+func UpdateJiraLicenseKeyREST(ctx context.Context, client *RESTClient, params UpdateLicenseKeyParams) error {
+	applicationKey := params.ApplicationKey
+	if applicationKey == "" {
+		applicationKey = "jira-software"
+	}
+
+	return client.Do(ctx, "PUT", fmt.Sprintf("/rest/plugins/applications/1.0/installed/%s/license", applicationKey), map[string]string{
+		"rawLicense": params.LicenseKey,
+	}, nil)
+}
+
+// ListJiraApplicationsREST lists the licensed applications over REST.
+func ListJiraApplicationsREST(ctx context.Context, client *RESTClient) ([]Application, error) {
+	licenses, err := ReadJiraLicenses(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	applications := make([]Application, 0, len(licenses))
+	for _, license := range licenses {
+		applications = append(applications, jiraApplication(license.ApplicationKey))
+	}
+	return applications, nil
+}
+
+// ResolveJiraServerIDREST reads the server id over REST, serverInfo includes it only for administrators.
+func ResolveJiraServerIDREST(ctx context.Context, client *RESTClient) (string, error) {
+	var serverInfo struct {
+		ServerID string `json:"serverId"`
+	}
+	if err := client.GetJSON(ctx, "/rest/api/2/serverInfo", &serverInfo); err == nil && serverInfo.ServerID != "" {
+		return ValidateServerID(serverInfo.ServerID)
+	}
+
+	var property struct {
+		Value string `json:"value"`
+	}
+	if err := client.GetJSON(ctx, "/rest/api/2/application-properties?key=jira.sid.key", &property); err != nil {
+		return "", fmt.Errorf("could not read server id property: %w", err)
+	}
+	return ValidateServerID(property.Value)
+}
+
+// ReadJiraLicenses reads the license details of every licensed application over REST, without a browser.
+func ReadJiraLicenses(ctx context.Context, client *RESTClient) ([]ApplicationLicense, error) {
+	var roles []struct {
+		Key string `json:"key"`
+	}
+	if err := client.GetJSON(ctx, "/rest/api/2/applicationrole", &roles); err != nil {
+		return nil, fmt.Errorf("could not list applications: %w", err)
+	}
+
+	result := make([]ApplicationLicense, 0, len(roles))
+	for _, role := range roles {
+		var license struct {
+			Evaluation               bool   `json:"evaluation"`
+			LicenseType              string `json:"licenseType"`
+			ExpiryDate               *int64 `json:"expiryDate"`
+			OrganizationName         string `json:"organizationName"`
+			SupportEntitlementNumber string `json:"supportEntitlementNumber"`
+		}
+		if err := client.GetJSON(ctx, fmt.Sprintf("/rest/plugins/applications/1.0/installed/%s/license", role.Key), &license); err != nil {
+			return nil, fmt.Errorf("could not read license of %s: %w", role.Key, err)
+		}
+
+		details := ResolveLicenseDetailsResult{
+			SEN:              license.SupportEntitlementNumber,
+			LicenseType:      license.LicenseType,
+			OrganisationName: license.OrganizationName,
+		}
+		if license.Evaluation {
+			details.LicenseType = "Evaluation"
+		}
+		// the licenses page shows the expiry only for trials, commercial licenses expire their maintenance instead
+		if license.ExpiryDate != nil && licenses.Classify(details.LicenseType).Renewable() {
+			expiresAt := time.UnixMilli(*license.ExpiryDate)
+			details.TrialExpiresAt = &expiresAt
+		}
+
+		result = append(result, ApplicationLicense{ApplicationKey: role.Key, Details: details})
+	}
+
+	return result, nil
+}
+
+type UpdateLicenseKeyParams struct {
 	BaseURL        string
 	ApplicationKey string
 	LicenseKey     string
+	// administrator credentials are asked again by the expired license page
+	Account           config.Account
+	ServiceManagement config.ServiceManagementPrompts
 }
 
-func UpdateJiraLicenseKey(ctx context.Context, page playwright.Page, params UpdateJiraLicenseKeyParams) error {
+func UpdateJiraLicenseKey(ctx context.Context, page playwright.Page, params UpdateLicenseKeyParams) error {
 	applicationKey := params.ApplicationKey
 	if applicationKey == "" {
 		applicationKey = "jira-software"
 	}
 
-	if _, err := page.Goto(fmt.Sprintf("%s/plugins/servlet/applications/versions-licenses", params.BaseURL)); err != nil {
-		return fmt.Errorf("could not navigate to licenses: %w", err)
+	layout, err := openJiraLicensesPage(ctx, page, params.BaseURL)
+	if errors.Is(err, ErrJiraLicenseGate) {
+		return updateJiraGateLicenseKey(ctx, page, params)
+	}
+	if err != nil {
+		return err
 	}
 
-	appLocator := page.Locator(fmt.Sprintf(`//div[@data-application-key="%s"]`, applicationKey))
+	appLocator := page.Locator(fmt.Sprintf(layout.Application, applicationKey))
 
-	if err := appLocator.Locator(`//*[@class="update-license-key"]`).Click(); err != nil {
+	if err := TrackSelector(ctx, layout.SelectorID("update-link"), Click(ctx, appLocator.Locator(layout.UpdateLink))); err != nil {
 		return err
 	}
 
-	if err := appLocator.Locator(`textarea.license-update-textarea`).Fill(params.LicenseKey); err != nil {
+	updateForm := appLocator
+	if layout.UpdateDialog != "" {
+		updateForm = page.Locator(layout.UpdateDialog)
+	}
+
+	if err := TrackSelector(ctx, layout.SelectorID("update-textarea"), Fill(ctx, updateForm.Locator(layout.UpdateInput), params.LicenseKey)); err != nil {
 		return err
 	}
 
-	if err := appLocator.Locator(`.license-update-submit`).Click(); err != nil {
+	if err := TrackSelector(ctx, layout.SelectorID("update-submit"), Click(ctx, updateForm.Locator(layout.UpdateSubmit))); err != nil {
 		return err
 	}
 
-	if err := page.Locator(`//*[@id="multiple-license-dialog"]//button[text()="Finish" and not(contains(concat(" ", @class, " "), " hidden "))]`).Click(); err != nil && !errors.Is(err, playwright.ErrTimeout) {
+	if err := Click(ctx, page.Locator(`//*[@id="multiple-license-dialog"]//button[text()="Finish" and not(contains(concat(" ", @class, " "), " hidden "))]`)); err != nil && !errors.Is(err, playwright.ErrTimeout) {
 		return err
 	}
 
-	if err := appLocator.Locator(`textarea.license-update-textarea`).WaitFor(playwright.LocatorWaitForOptions{
+	if applicationKey == "jira-servicedesk" {
+		if err := answerJSMAgentDialog(ctx, page, params.ServiceManagement); err != nil {
+			return err
+		}
+	}
+
+	if err := TrackSelector(ctx, layout.SelectorID("update-hidden"), WaitFor(ctx, updateForm.Locator(layout.UpdateInput), playwright.LocatorWaitForOptions{
 		State: playwright.WaitForSelectorStateHidden,
+	})); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// jsmAgentDialog asks what to do with assigned agents when the agent tier of the new license differs.
+const jsmAgentDialog = `//*[(@role="dialog" or contains(concat(" ", @class, " "), " aui-dialog2 ")) and .//input[@type="radio"] and contains(., "agent")]`
+
+func answerJSMAgentDialog(ctx context.Context, page playwright.Page, prompts config.ServiceManagementPrompts) error {
+	dialog := page.Locator(jsmAgentDialog)
+	if err := WaitFor(ctx, dialog, playwright.LocatorWaitForOptions{
+		Timeout: playwright.Float(5000),
 	}); err != nil {
+		if errors.Is(err, playwright.ErrTimeout) {
+			return nil
+		}
 		return err
 	}
 
-	// TODO: wait for updated?
+	agentTier := prompts.AgentTier
+	if agentTier == "" {
+		agentTier = "Keep"
+	}
+	confirm := prompts.Confirm
+	if confirm == "" {
+		confirm = "Confirm"
+	}
 
-	return nil
+	if err := TrackSelector(ctx, "jira.jsm-agent-dialog.option", Check(ctx, dialog.GetByLabel(agentTier).First())); err != nil {
+		return fmt.Errorf("could not choose agent tier option %q: %w", agentTier, err)
+	}
+	if err := TrackSelector(ctx, "jira.jsm-agent-dialog.confirm", Click(ctx, dialog.GetByRole("button", playwright.LocatorGetByRoleOptions{Name: confirm}))); err != nil {
+		return fmt.Errorf("could not confirm agent tier: %w", err)
+	}
+
+	return WaitFor(ctx, dialog, playwright.LocatorWaitForOptions{
+		State: playwright.WaitForSelectorStateHidden,
+	})
+}
+
+func UpdateJiraLicenseKeyRequest(ctx context.Context, page playwright.Page, params UpdateLicenseKeyParams) error {
+	applicationKey := params.ApplicationKey
+	if applicationKey == "" {
+		applicationKey = "jira-software"
+	}
+
+	return sendLicenseRequest(page, "PUT", fmt.Sprintf("%s/rest/plugins/applications/1.0/installed/%s/license", params.BaseURL, applicationKey), map[string]string{
+		"rawLicense": params.LicenseKey,
+	})
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/credentials"
+)
+
+// ErrJiraLicenseGate is returned when jira shows the license gate instead of the requested page.
+var ErrJiraLicenseGate = errors.New("jira shows the expired license page")
+
+// jiraLicenseGate is the form jira puts in front of every page once the license has expired,
+// it asks for administrator credentials together with the new license.
+const jiraLicenseGate = `//form[contains(@action, "ConfirmNewInstallationWithOldLicense")]`
+
+var serverIDInTextPattern = regexp.MustCompile(`[A-Z0-9]{4}-[A-Z0-9]{4}-[A-Z0-9]{4}-[A-Z0-9]{4}`)
+
+func jiraLicenseGateVisible(page playwright.Page) (bool, error) {
+	count, err := page.Locator(jiraLicenseGate).Count()
+	return count > 0, err
+}
+
+// resolveJiraGateServerID reads the server id the license gate shows next to its form.
+func resolveJiraGateServerID(ctx context.Context, page playwright.Page) (string, error) {
+	content := page.Locator(`//*[contains(text(), "Server ID")]/..`).First()
+	if err := TrackSelector(ctx, "jira.license-gate.server-id", WaitFor(ctx, content)); err != nil {
+		return "", err
+	}
+
+	return ExtractServerID(func() (string, error) {
+		text, err := content.TextContent()
+		if err != nil {
+			return "", err
+		}
+		return serverIDInTextPattern.FindString(text), nil
+	})
+}
+
+// updateJiraGateLicenseKey submits the license through the gate form, which unlocks the instance.
+func updateJiraGateLicenseKey(ctx context.Context, page playwright.Page, params UpdateLicenseKeyParams) error {
+	creds, err := credentials.ResolveCredentials(ctx, params.Account)
+	if err != nil {
+		return fmt.Errorf("could not resolve credentials: %w", err)
+	}
+	defer creds.Wipe()
+
+	form := page.Locator(jiraLicenseGate)
+
+	if err := TrackSelector(ctx, "jira.license-gate.username", Fill(ctx, form.Locator(`[name="userName"]`), creds.Username)); err != nil {
+		return err
+	}
+	if err := TrackSelector(ctx, "jira.license-gate.password", Fill(ctx, form.Locator(`[name="password"]`), creds.Password.Reveal())); err != nil {
+		return err
+	}
+	if err := TrackSelector(ctx, "jira.license-gate.license", Fill(ctx, form.Locator(`[name="licenseString"]`), params.LicenseKey)); err != nil {
+		return err
+	}
+	if err := TrackSelector(ctx, "jira.license-gate.submit", Click(ctx, form.Locator(`[type="submit"]`).First())); err != nil {
+		return err
+	}
+
+	if err := WaitFor(ctx, form, playwright.LocatorWaitForOptions{
+		State: playwright.WaitForSelectorStateHidden,
+	}); err != nil {
+		return fmt.Errorf("license gate did not accept the license: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+func LicenseKeyHash(licenseKey string) string {
+	if licenseKey == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.TrimSpace(licenseKey)))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func PersistableLicenseKey(licenseKey string, noPersistKeys bool) string {
+	if noPersistKeys {
+		return LicenseKeyHash(licenseKey)
+	}
+	return licenseKey
+}
+
+func LicenseKeyField(licenseKey string, noPersistKeys bool) zap.Field {
+	return zap.String("license key", PersistableLicenseKey(licenseKey, noPersistKeys))
+}
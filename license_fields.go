@@ -0,0 +1,85 @@
+package main
+
+import "strings"
+
+type licenseDetailField string
+
+const (
+	licenseFieldTrialExpires licenseDetailField = "trial-expires"
+	licenseFieldSEN          licenseDetailField = "sen"
+	licenseFieldLicenseType  licenseDetailField = "license-type"
+	licenseFieldOrganisation licenseDetailField = "organisation"
+	licenseFieldLicenseKey   licenseDetailField = "license-key"
+)
+
+// licenseDetailKeys maps the values of stable field attributes, they do not depend on the admin ui language.
+var licenseDetailKeys = map[string]licenseDetailField{
+	"trial-expires":     licenseFieldTrialExpires,
+	"trialexpires":      licenseFieldTrialExpires,
+	"expiry-date":       licenseFieldTrialExpires,
+	"sen":               licenseFieldSEN,
+	"license-type":      licenseFieldLicenseType,
+	"licensetype":       licenseFieldLicenseType,
+	"organisation":      licenseFieldOrganisation,
+	"organisation-name": licenseFieldOrganisation,
+	"organization":      licenseFieldOrganisation,
+	"license-key":       licenseFieldLicenseKey,
+	"licensekey":        licenseFieldLicenseKey,
+}
+
+// licenseDetailLabels maps the labels of the licenses page in the languages jira ships, lowercased.
+var licenseDetailLabels = map[string]licenseDetailField{
+	// en
+	"trial expires":                    licenseFieldTrialExpires,
+	"support entitlement number (sen)": licenseFieldSEN,
+	"license type":                     licenseFieldLicenseType,
+	"licence type":                     licenseFieldLicenseType,
+	"organisation name":                licenseFieldOrganisation,
+	"organization name":                licenseFieldOrganisation,
+	"license key":                      licenseFieldLicenseKey,
+	"licence key":                      licenseFieldLicenseKey,
+
+	// de
+	"testversion läuft ab":              licenseFieldTrialExpires,
+	"testphase läuft ab":                licenseFieldTrialExpires,
+	"support-berechtigungsnummer (sen)": licenseFieldSEN,
+	"lizenztyp":                         licenseFieldLicenseType,
+	"name der organisation":             licenseFieldOrganisation,
+	"organisationsname":                 licenseFieldOrganisation,
+	"lizenzschlüssel":                   licenseFieldLicenseKey,
+
+	// fr
+	"l'essai expire":                   licenseFieldTrialExpires,
+	"expiration de l'essai":            licenseFieldTrialExpires,
+	"numéro de droit au support (sen)": licenseFieldSEN,
+	"type de licence":                  licenseFieldLicenseType,
+	"nom de l'organisation":            licenseFieldOrganisation,
+	"clé de licence":                   licenseFieldLicenseKey,
+
+	// es
+	"la prueba caduca":                  licenseFieldTrialExpires,
+	"vencimiento de la prueba":          licenseFieldTrialExpires,
+	"número de derecho a soporte (sen)": licenseFieldSEN,
+	"tipo de licencia":                  licenseFieldLicenseType,
+	"nombre de la organización":         licenseFieldOrganisation,
+	"clave de licencia":                 licenseFieldLicenseKey,
+
+	// ru
+	"пробная версия истекает":        licenseFieldTrialExpires,
+	"окончание пробного периода":     licenseFieldTrialExpires,
+	"номер права на поддержку (sen)": licenseFieldSEN,
+	"тип лицензии":                   licenseFieldLicenseType,
+	"название организации":           licenseFieldOrganisation,
+	"лицензионный ключ":              licenseFieldLicenseKey,
+}
+
+func licenseDetailFieldByKey(key string) (licenseDetailField, bool) {
+	field, ok := licenseDetailKeys[strings.ToLower(strings.TrimSpace(key))]
+	return field, ok
+}
+
+func licenseDetailFieldByLabel(label string) (licenseDetailField, bool) {
+	label = strings.ToLower(strings.Join(strings.Fields(label), " "))
+	field, ok := licenseDetailLabels[strings.TrimSuffix(label, ":")]
+	return field, ok
+}
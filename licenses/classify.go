@@ -0,0 +1,65 @@
+package licenses
+
+import (
+	"strings"
+)
+
+type Class string
+
+const (
+	ClassUnknown    Class = "Unknown"
+	ClassEvaluation Class = "Evaluation"
+	ClassCommercial Class = "Commercial"
+	ClassAcademic   Class = "Academic"
+	ClassDeveloper  Class = "Developer"
+	ClassTimebomb   Class = "Timebomb"
+)
+
+var Classes = []Class{
+	ClassEvaluation,
+	ClassCommercial,
+	ClassAcademic,
+	ClassDeveloper,
+	ClassTimebomb,
+}
+
+var keywords = []struct {
+	class    Class
+	keywords []string
+}{
+	{ClassTimebomb, []string{"timebomb", "time bomb", "time-bomb"}},
+	{ClassDeveloper, []string{"developer", "entwickler", "développeur", "developpeur", "desarrollador", "разработчик"}},
+	{ClassEvaluation, []string{"evaluation", "trial", "évaluation", "evaluierung", "testversion", "evaluación", "evaluacion", "prueba", "ознакомительная", "пробная", "оценочная"}},
+	{ClassAcademic, []string{"academic", "akademisch", "académique", "academique", "académica", "academica", "академическая"}},
+	{ClassCommercial, []string{"commercial", "kommerziell", "commerciale", "comercial", "коммерческая"}},
+}
+
+func Classify(licenseType string) Class {
+	value := strings.ToLower(strings.TrimSpace(licenseType))
+	if value == "" {
+		return ClassUnknown
+	}
+
+	for _, entry := range keywords {
+		for _, keyword := range entry.keywords {
+			if strings.Contains(value, keyword) {
+				return entry.class
+			}
+		}
+	}
+
+	return ClassUnknown
+}
+
+func ParseClass(value string) (Class, bool) {
+	for _, class := range append(Classes, ClassUnknown) {
+		if strings.EqualFold(string(class), value) {
+			return class, true
+		}
+	}
+	return ClassUnknown, false
+}
+
+func (c Class) Renewable() bool {
+	return c == ClassEvaluation || c == ClassTimebomb
+}
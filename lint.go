@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/credentials"
+	"github.com/tarik02/jira-auto-trial/policy"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// secretKeys are the config fields that hold a secret, they should come from the environment or a secret store.
+var secretKeys = []string{"password", "token", "secret", "totpSecret"}
+
+// LintConfigParams selects the configs to lint, Raw is the file they were loaded from.
+type LintConfigParams struct {
+	Raw  []byte
+	Cfgs []*config.Config
+	// resolve the server id of every instance over rest to find duplicates
+	ServerIDs bool
+	Log       *zap.Logger
+}
+
+// LintConfig looks for setups that are valid but risky, each warning points at the field it is about.
+func LintConfig(ctx context.Context, params LintConfigParams) (ConfigErrors, error) {
+	v := &configValidator{}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(params.Raw, &document); err != nil {
+		return nil, fmt.Errorf("could not parse config: %w", err)
+	}
+	lintPlainSecrets(v, &document, "")
+
+	type accountUse struct {
+		path    string
+		account string
+	}
+	accounts := make(map[string]accountUse)
+	otpWarned := make(map[string]bool)
+	for _, cfg := range params.Cfgs {
+		prefix := ""
+		if cfg.Profile != "" {
+			prefix = "profiles." + cfg.Profile + "."
+		}
+
+		scheduled := cfg.Schedule != ""
+		for i, instance := range cfg.Instances {
+			if instance.Disabled {
+				continue
+			}
+			path := fmt.Sprintf("%sinstances[%d]", prefix, i)
+			scheduled = scheduled || instance.Schedule != ""
+
+			// profiles usually share the instances of the config, each is only reported once
+			key, account := normalizeBaseURL(instance.BaseURL), DescribeAccount(instance.Account)
+			if other, ok := accounts[key]; ok {
+				if other.account != account {
+					v.fail(path+".account", "%s uses the same base url with another account (%s)", other.path, other.account)
+				}
+				continue
+			}
+			accounts[key] = accountUse{path: path, account: account}
+
+			if cfg.InstancePolicy(instance).ThresholdDays == nil {
+				v.fail(path, "no thresholdDays or renewThresholdDays, renewals start %d days before the trial expires", policy.DefaultThresholdDays)
+			}
+		}
+
+		// a profile without its own atlassian section uses the one of the config
+		otpPath := "atlassian.otp"
+		if cfg.Profile != "" && cfg.Profiles[cfg.Profile].Atlassian != nil {
+			otpPath = prefix + otpPath
+		}
+		if scheduled && !cfg.DryRun && !unattendedOTP(cfg.Atlassian) && !otpWarned[otpPath] {
+			otpWarned[otpPath] = true
+			v.fail(otpPath, "scheduled runs cannot answer an otp prompt on stdin, add a totp, imap or webhook source, or none when the account has no two-step verification")
+		}
+	}
+
+	if params.ServerIDs {
+		lintServerIDs(ctx, v, params)
+	}
+
+	return v.errs, nil
+}
+
+// lintPlainSecrets walks the raw document, values interpolated from ${VAR} are not written in the file.
+func lintPlainSecrets(v *configValidator, node *yaml.Node, path string) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			lintPlainSecrets(v, child, path)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			lintPlainSecrets(v, child, fmt.Sprintf("%s[%d]", path, i))
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			childPath := key.Value
+			if path != "" {
+				childPath = path + "." + key.Value
+			}
+			if value.Kind == yaml.ScalarNode && slices.Contains(secretKeys, key.Value) {
+				if value.Value != "" && !strings.Contains(value.Value, "${") {
+					v.fail(childPath, "plain-text %s in the config file (line %d), use ${VAR} or an env, command, vault or keyring account", key.Value, value.Line)
+				}
+				continue
+			}
+			lintPlainSecrets(v, value, childPath)
+		}
+	}
+}
+
+// unattendedOTP reports whether the atlassian account can log in without someone typing the code.
+func unattendedOTP(atlassian config.Atlassian) bool {
+	if atlassian.TOTPSecret != "" {
+		return true
+	}
+	return slices.ContainsFunc(atlassian.OTP, func(source config.OTP) bool {
+		return source.Stdin == nil
+	})
+}
+
+// lintServerIDs warns about instances sharing a server id, atlassian would give them the same evaluation.
+func lintServerIDs(ctx context.Context, v *configValidator, params LintConfigParams) {
+	seen := make(map[string]bool)
+	serverIDs := make(map[string]string)
+	for _, cfg := range params.Cfgs {
+		prefix := ""
+		if cfg.Profile != "" {
+			prefix = "profiles." + cfg.Profile + "."
+		}
+		for i, instance := range cfg.Instances {
+			key := normalizeBaseURL(instance.BaseURL)
+			if instance.Disabled || seen[key] {
+				continue
+			}
+			seen[key] = true
+			path := fmt.Sprintf("%sinstances[%d]", prefix, i)
+
+			serverID, err := lintServerID(ctx, instance)
+			if err != nil {
+				params.Log.Warn("could not resolve server id", zap.String("instance", InstanceName(instance)), zap.Error(err))
+				v.fail(path, "could not resolve the server id: %s", err)
+				continue
+			}
+			serverID = normalizeServerID(serverID)
+			if other, ok := serverIDs[serverID]; ok {
+				v.fail(path, "has the same server id %s as %s, a cloned instance gets the evaluation license of the other", serverID, other)
+			} else {
+				serverIDs[serverID] = path
+			}
+		}
+	}
+}
+
+func lintServerID(ctx context.Context, instance config.JiraInstance) (string, error) {
+	product, err := InstanceProduct(instance)
+	if err != nil {
+		return "", err
+	}
+	if product.ResolveServerIDREST == nil {
+		return "", fmt.Errorf("%s has no rest endpoint for the server id", product.Name)
+	}
+
+	creds, err := credentials.ResolveCredentials(ctx, instance.Account)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve credentials: %w", err)
+	}
+	defer creds.Wipe()
+
+	return product.ResolveServerIDREST(ctx, &RESTClient{
+		HTTP:        NewRESTHTTPClient(20 * time.Second),
+		BaseURL:     NavigationBaseURL(instance),
+		Credentials: creds,
+	})
+}
+
+func lintConfigCommand() *Command {
+	cmd := &Command{
+		Name:  "lint-config",
+		Usage: "jira-auto-trial lint-config [-profile names] [-server-ids]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		serverIDs := fs.Bool("server-ids", false, "resolve the server id of every instance over rest to find duplicates")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		raw, err := os.ReadFile(configFlags.Path)
+		if err != nil {
+			return fmt.Errorf("could not read config: %w", err)
+		}
+
+		// without -profile the config and all of its profiles are linted
+		cfgs, err := configFlags.LoadAll()
+		if err != nil {
+			return err
+		}
+		if configFlags.Profiles == "" {
+			for _, name := range sortedKeys(cfgs[0].Profiles) {
+				profileCfg, err := cfgs[0].WithProfile(name)
+				if err != nil {
+					return err
+				}
+				cfgs = append(cfgs, profileCfg)
+			}
+		}
+
+		warnings, err := LintConfig(ctx, LintConfigParams{Raw: raw, Cfgs: cfgs, ServerIDs: *serverIDs, Log: log})
+		if err != nil {
+			return err
+		}
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+		}
+
+		switch len(warnings) {
+		case 0:
+			fmt.Printf("%s: no warnings\n", configFlags.Path)
+			return nil
+		case 1:
+			return fmt.Errorf("%s: 1 warning", configFlags.Path)
+		default:
+			return fmt.Errorf("%s: %d warnings", configFlags.Path, len(warnings))
+		}
+	}
+
+	return cmd
+}
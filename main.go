@@ -1,11 +1,13 @@
 package main
 
 import (
-	"bufio"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -13,254 +15,1087 @@ import (
 	"github.com/playwright-community/playwright-go"
 	"github.com/tarik02/jira-auto-trial/config"
 	"github.com/tarik02/jira-auto-trial/credentials"
+	"github.com/tarik02/jira-auto-trial/licenses"
+	"github.com/tarik02/jira-auto-trial/policy"
+	"github.com/tarik02/jira-auto-trial/state"
 	prettyconsole "github.com/thessem/zap-prettyconsole"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"golang.org/x/sync/errgroup"
-	"gopkg.in/yaml.v3"
 )
 
 func main() {
-	logger := prettyconsole.NewLogger(zap.DebugLevel)
+	logger := zap.New(zapcore.NewCore(
+		prettyconsole.NewEncoder(prettyconsole.NewEncoderConfig()),
+		zapcore.Lock(os.Stderr),
+		zap.DebugLevel,
+	))
 	defer logger.Sync()
 
 	ctx := context.Background()
-	if err := run(ctx, logger); err != nil && !errors.Is(err, context.Canceled) {
-		logger.Fatal("error", zap.Error(err))
+	if err := rootCommand().Execute(ctx, logger, os.Args[1:]); err != nil && !errors.Is(err, context.Canceled) {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		logger.Error("error", zap.Error(err))
+		_ = logger.Sync()
+		os.Exit(exitCode(err))
 	}
 }
 
+type ProcessInstanceParams struct {
+	Instance      config.JiraInstance
+	Policy        *policy.Policy
+	LastRenewedAt *time.Time
+	NoPersistKeys bool
+	DryRun        bool
+	// stop after the decision, without resolving the server id
+	CheckOnly bool
+	// send the update request directly when the update form fails twice
+	UpdateFallback bool
+	// read applications, license details and the server id over REST before using the browser
+	PreferREST   bool
+	VerifyUpdate config.VerifyUpdate
+	// confirm the renewal in the audit log of the instance and record it in the audit log of the tool
+	VerifyAuditLog bool
+	RunID          string
+	// server ids resolved by earlier runs, nil resolves them every time
+	ServerIDs     *state.ServerIDCache
+	GetLicenseKey func(ctx context.Context, application Application, serverID string) (string, error)
+	// asked before a license key is generated, nil renews without asking
+	Confirm func(ctx context.Context, question string) (bool, error)
+	Events  EventSink
+}
+
 func processInstance(
 	ctx context.Context,
 	log *zap.Logger,
 	jiraPage playwright.Page,
-	instance config.JiraInstance,
-	getLicenseKey func(context context.Context, serverId string) (string, error),
-) error {
-	g, ctx := errgroup.WithContext(ctx)
+	params ProcessInstanceParams,
+	result *InstanceResult,
+) (err error) {
+	instance := params.Instance
+	baseURL := NavigationBaseURL(instance)
 
-	_ = g.TryGo(func() error {
-		return (&JiraLoginHandler{
-			CredentialsResolver: func(ctx context.Context) (string, string, error) {
-				creds, err := credentials.ResolveCredentials(ctx, instance.Account)
-				if err != nil {
-					return "", "", err
-				}
-				return creds.Username, creds.Password, nil
-			},
-			RememberMe: true,
-		}).Run(ctx, jiraPage)
-	})
+	if instance.Disabled {
+		log.Warn("skipping: instance is disabled")
+		result.Outcome = OutcomeSkippedDisabled
+		return nil
+	}
 
-	_ = g.TryGo(func() error {
-		return (&JiraSudoHandler{
-			PasswordResolver: func(ctx context.Context) (string, error) {
-				creds, err := credentials.ResolveCredentials(ctx, instance.Account)
-				if err != nil {
-					return "", err
-				}
-				return creds.Password, nil
-			},
-		}).Run(ctx, jiraPage)
-	})
+	product, err := InstanceProduct(instance)
+	if err != nil {
+		return Fail(FailureConfig, err)
+	}
+
+	// accounts with a personal access token never log in to the browser
+	if params.PreferREST || instance.Account.PAT != nil {
+		creds, err := credentials.ResolveCredentials(ctx, instance.Account)
+		if err != nil {
+			return Fail(FailureConfig, fmt.Errorf("could not resolve credentials: %w", err))
+		}
+		defer creds.Wipe()
+
+		product = PreferREST(product, log, &RESTClient{
+			HTTP:        NewRESTHTTPClient(20 * time.Second),
+			BaseURL:     baseURL,
+			Credentials: creds,
+		})
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	defer func() {
+		// a rejected login leaves the page waiting, report it instead of the timeout it causes
+		if cause := context.Cause(ctx); err != nil && errors.Is(cause, ErrLoginFailed) {
+			var failure *FailureError
+			if errors.As(err, &failure) {
+				failure.Err = fmt.Errorf("%w: %w", cause, failure.Err)
+			} else {
+				err = fmt.Errorf("%w: %w", cause, err)
+			}
+		}
+	}()
+
+	ctx, webSudo := WithWebSudo(ctx)
+	ctx = WithSelectorPage(ctx, jiraPage)
+	product.StartHandlers(ctx, g, jiraPage, instance.Account)
+	if err := StartURLRewrite(ctx, g, jiraPage, instance.URLRewrite); err != nil {
+		return Fail(FailureConfig, err)
+	}
 
 	log.Info("processing instance")
 
+	applications := []Application{{
+		EvaluationProduct: product.EvaluationProduct,
+		EvaluationEdition: product.EvaluationEdition,
+	}}
+	if product.ListApplications != nil {
+		params.Events.Emit(Event{Type: EventInstanceStep, Step: "applications"})
+
+		applications, err = product.ListApplications(ctx, jiraPage, baseURL)
+		if err != nil {
+			return Fail(FailureLicenseDetails, fmt.Errorf("listing applications: %w", err))
+		}
+		applications = MapApplications(applications, instance.Applications)
+		log.Info("applications", zap.Int("count", len(applications)))
+	}
+	if webSudo.Disabled() {
+		log.Info("websudo is disabled, stopped waiting for its prompt")
+		result.WebSudoDisabled = true
+	}
+
+	state := &applicationState{}
+	errs := make([]error, 0)
+	decisions := make([]string, 0, len(applications))
+	outcomes := make([]Outcome, 0, len(applications))
+
+	for _, application := range applications {
+		appLog := log
+		if application.Key != "" {
+			appLog = log.With(zap.String("application", application.Key))
+		}
+
+		appResult := InstanceResult{}
+		if err := processApplication(ctx, appLog, jiraPage, product, application, state, params, &appResult); err != nil {
+			errs = append(errs, err)
+			appResult.SetError(err)
+		}
+		if application.Key != "" {
+			applicationResult := ApplicationResult{
+				Application: application.Key,
+				Outcome:     appResult.Outcome,
+				Category:    appResult.Category,
+				Decision:    appResult.Decision,
+				Err:         appResult.Err,
+				ExpiresAt:   appResult.ExpiresAt,
+			}
+			if len(appResult.Licenses) > 0 {
+				applicationResult.PreviousExpiresAt = appResult.Licenses[0].TrialExpiresAt
+			}
+			result.Applications = append(result.Applications, applicationResult)
+		}
+
+		decision := appResult.Decision
+		if application.Key != "" && len(applications) > 1 && decision != "" {
+			decision = application.Key + ": " + decision
+		}
+		if decision != "" {
+			decisions = append(decisions, decision)
+		}
+		outcomes = append(outcomes, appResult.Outcome)
+		result.Expired = result.Expired || appResult.Expired
+		result.Licenses = append(result.Licenses, appResult.Licenses...)
+
+		if result.LicenseKey == "" {
+			result.LicenseKey = appResult.LicenseKey
+		}
+		if appResult.ExpiresAt != nil && (result.ExpiresAt == nil || appResult.ExpiresAt.Before(*result.ExpiresAt)) {
+			result.ExpiresAt = appResult.ExpiresAt
+		}
+		for _, change := range appResult.Changes {
+			if application.Key != "" && len(applications) > 1 {
+				change.Field = application.Key + " " + change.Field
+			}
+			result.Changes = append(result.Changes, change)
+		}
+	}
+
+	result.Decision = strings.Join(decisions, "; ")
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	switch {
+	case slices.Contains(outcomes, OutcomeRenewed):
+		result.Outcome = OutcomeRenewed
+	case slices.Contains(outcomes, OutcomeWouldRenew):
+		result.Outcome = OutcomeWouldRenew
+	case len(outcomes) > 0 && !slices.ContainsFunc(outcomes, func(outcome Outcome) bool { return outcome != OutcomeSkippedCommercial }):
+		result.Outcome = OutcomeSkippedCommercial
+	case slices.Contains(outcomes, OutcomeSkippedDeclined):
+		result.Outcome = OutcomeSkippedDeclined
+	default:
+		result.Outcome = OutcomeSkippedNotDue
+	}
+	return nil
+}
+
+type applicationState struct {
+	serverID string
+}
+
+func processApplication(
+	ctx context.Context,
+	log *zap.Logger,
+	jiraPage playwright.Page,
+	product *Product,
+	application Application,
+	state *applicationState,
+	params ProcessInstanceParams,
+	result *InstanceResult,
+) error {
+	baseURL := NavigationBaseURL(params.Instance)
+
 	log.Info("resolving license details")
+	params.Events.Emit(Event{Type: EventInstanceStep, Step: "license-details"})
 
-	licenseDetails, err := ResolveLicenseDetails(ctx, jiraPage, ResolveLicenseDetailsParams{
-		BaseURL: instance.BaseURL,
+	licenseDetails, err := product.ResolveLicenseDetails(ctx, jiraPage, ResolveLicenseDetailsParams{
+		BaseURL:        baseURL,
+		ApplicationKey: application.Key,
 	})
 	if err != nil {
-		return fmt.Errorf("resolving license details: %w", err)
+		return Fail(FailureLicenseDetails, fmt.Errorf("resolving license details: %w", err))
 	}
 
 	trialExpiresAtStr := "-"
 	if licenseDetails.TrialExpiresAt != nil {
-		trialExpiresAtStr = licenseDetails.TrialExpiresAt.Format(time.DateTime)
+		trialExpiresAtStr = FormatDateTime(*licenseDetails.TrialExpiresAt)
 	}
 	log.Info(
 		"license details",
 		zap.String("trial expires at", trialExpiresAtStr),
+		zap.String("days left", formatDaysLeft(licenseDetails.TrialExpiresAt)),
 		zap.String("sen", licenseDetails.SEN),
 		zap.String("license type", licenseDetails.LicenseType),
 		zap.String("organisation name", licenseDetails.OrganisationName),
-		zap.String("license key", licenseDetails.LicenseKey),
+		LicenseKeyField(licenseDetails.LicenseKey, params.NoPersistKeys),
 	)
 
-	if licenseDetails.TrialExpiresAt != nil && !licenseDetails.TrialExpiresAt.Before(time.Now().AddDate(0, 0, 7)) {
-		log.Warn("skipping: more than 7 days of trial left")
+	result.LicenseKey = licenseDetails.LicenseKey
+	result.ExpiresAt = licenseDetails.TrialExpiresAt
+	result.Licenses = append(result.Licenses, LicenseSummary{
+		Application:    application.Key,
+		SEN:            licenseDetails.SEN,
+		LicenseType:    licenseDetails.LicenseType,
+		TrialExpiresAt: licenseDetails.TrialExpiresAt,
+	})
+
+	licenseClass := licenses.Classify(licenseDetails.LicenseType)
+
+	decision := params.Policy.Decide(policy.Input{
+		Now:            time.Now(),
+		TrialExpiresAt: licenseDetails.TrialExpiresAt,
+		Expired:        licenseDetails.Expired,
+		LicenseClass:   licenseClass,
+		LastRenewedAt:  params.LastRenewedAt,
+	})
+	result.Decision = decision.String()
+
+	log.Info("decision", zap.String("license class", string(licenseClass)), zap.String("decision", result.Decision))
+
+	switch decision.Kind {
+	case policy.KindRenew:
+	case policy.KindExpired:
+		// reported right away, the instance may be read-only until the renewal is done
+		result.Expired = true
+		log.Error("trial already expired", zap.String("trial expired at", trialExpiresAtStr))
+		params.Events.Emit(Event{Type: EventInstanceExpired, Decision: result.Decision, ExpiresAt: licenseDetails.TrialExpiresAt})
+	case policy.KindLicenseType:
+		log.Warn("skipping: not an evaluation license")
+		result.Outcome = OutcomeSkippedCommercial
+		return nil
+	default:
+		log.Warn("skipping: renewal not due")
+		result.Outcome = OutcomeSkippedNotDue
 		return nil
 	}
 
-	log.Info("resolving server id")
+	if params.CheckOnly {
+		result.Outcome = OutcomeWouldRenew
+		return nil
+	}
 
-	serverID, err := ResolveServerID(ctx, jiraPage, ResolveServerIDParams{
-		BaseURL: instance.BaseURL,
-	})
-	if err != nil {
-		return fmt.Errorf("resolving server id: %w", err)
+	if state.serverID == "" && params.ServerIDs != nil {
+		if serverID, ok := params.ServerIDs.Get(params.Instance.BaseURL); ok {
+			state.serverID = serverID
+			log.Info("server id from cache", zap.String("server id", serverID))
+		}
+	}
+
+	if state.serverID == "" {
+		log.Info("resolving server id")
+		params.Events.Emit(Event{Type: EventInstanceStep, Step: "server-id"})
+
+		serverID, err := product.ResolveServerID(ctx, jiraPage, ResolveServerIDParams{
+			BaseURL: baseURL,
+		})
+		if err != nil {
+			return Fail(FailureServerID, fmt.Errorf("resolving server id: %w", err))
+		}
+		state.serverID = serverID
+
+		log.Info("server id", zap.String("server id", serverID))
+		if params.ServerIDs != nil {
+			if err := params.ServerIDs.Set(params.Instance.BaseURL, serverID); err != nil {
+				log.Warn("could not cache server id", zap.Error(err))
+			}
+		}
 	}
 
-	log.Info("server id", zap.String("server id", serverID))
+	if params.DryRun {
+		log.Info(
+			"dry run: would renew",
+			zap.String("server id", state.serverID),
+			zap.String("evaluation product", application.EvaluationProduct),
+			zap.String("evaluation edition", application.EvaluationEdition),
+		)
+		result.Outcome = OutcomeWouldRenew
+		return nil
+	}
+
+	if params.Confirm != nil {
+		question := fmt.Sprintf("%s: %s", InstanceName(params.Instance), result.Decision)
+		if application.Key != "" {
+			question = fmt.Sprintf("%s (%s): %s", InstanceName(params.Instance), application.Key, result.Decision)
+		}
+		question += fmt.Sprintf(", trial expires %s. Generate and apply a new %s evaluation license?", trialExpiresAtStr, application.EvaluationEdition)
+
+		confirmed, err := params.Confirm(ctx, question)
+		if err != nil {
+			return err
+		}
+		if !confirmed {
+			log.Warn("skipping: renewal declined")
+			result.Outcome = OutcomeSkippedDeclined
+			return nil
+		}
+	}
 
 	log.Info("resolving license key")
+	params.Events.Emit(Event{Type: EventInstanceStep, Step: "license-key"})
 
-	licenseKey, err := getLicenseKey(ctx, serverID)
+	licenseKey, err := params.GetLicenseKey(ctx, application, state.serverID)
 	if err != nil {
-		return fmt.Errorf("resolving license key: %w", err)
+		return Fail(FailureLicenseKey, fmt.Errorf("resolving license key: %w", err))
 	}
 
-	log.Info("license key", zap.String("license key", licenseKey))
+	log.Info("license key", LicenseKeyField(licenseKey, params.NoPersistKeys))
 
-	if err := UpdateJiraLicenseKey(ctx, jiraPage, UpdateJiraLicenseKeyParams{
-		BaseURL:    instance.BaseURL,
-		LicenseKey: licenseKey,
-	}); err != nil {
-		return err
+	// the replaced license can be pushed back with restore-license
+	backup, err := WriteLicenseBackup(LicenseBackup{
+		Instance:       InstanceName(params.Instance),
+		BaseURL:        params.Instance.BaseURL,
+		ApplicationKey: application.Key,
+		CreatedAt:      time.Now(),
+		LicenseKey:     PersistableLicenseKey(licenseDetails.LicenseKey, params.NoPersistKeys),
+		SEN:            licenseDetails.SEN,
+		LicenseType:    licenseDetails.LicenseType,
+		TrialExpiresAt: licenseDetails.TrialExpiresAt,
+	})
+	if err != nil {
+		return Fail(FailureUpdate, fmt.Errorf("backing up license: %w", err))
+	}
+	log.Info("license backed up", zap.String("backup", backup))
+
+	params.Events.Emit(Event{Type: EventInstanceStep, Step: "update"})
+
+	updateParams := UpdateLicenseKeyParams{
+		BaseURL:        baseURL,
+		ApplicationKey: application.Key,
+		LicenseKey:     licenseKey,
+		Account:        params.Instance.Account,
+
+		ServiceManagement: params.Instance.ServiceManagement,
+	}
+	// the clock of the instance may be a little behind
+	updateStartedAt := time.Now().Add(-time.Minute)
+	err = product.UpdateLicenseKey(ctx, jiraPage, updateParams)
+	if err != nil && params.UpdateFallback && product.UpdateLicenseKeyRequest != nil && ctx.Err() == nil && !IsBrowserCrash(err) {
+		log.Warn("updating license key failed, retrying", zap.Error(err))
+		if err = product.UpdateLicenseKey(ctx, jiraPage, updateParams); err != nil && ctx.Err() == nil && !IsBrowserCrash(err) {
+			log.Warn("updating license key failed again, sending the update request directly", zap.Error(err))
+			params.Events.Emit(Event{Type: EventInstanceStep, Step: "update-request"})
+			err = product.UpdateLicenseKeyRequest(ctx, jiraPage, updateParams)
+		}
+	}
+	if err != nil {
+		return Fail(FailureUpdate, fmt.Errorf("updating license key: %w", err))
 	}
 
 	log.Info("license key updated")
 
+	result.LicenseKey = licenseKey
+
+	updatedDetails, err := VerifyLicenseUpdate(ctx, log, params.VerifyUpdate, licenseDetails, licenseKey, func() (*ResolveLicenseDetailsResult, error) {
+		return product.ResolveLicenseDetails(ctx, jiraPage, ResolveLicenseDetailsParams{
+			BaseURL:        baseURL,
+			ApplicationKey: application.Key,
+		})
+	})
+	if updatedDetails != nil {
+		result.ExpiresAt = updatedDetails.TrialExpiresAt
+		result.Changes = DiffLicenseDetails(licenseDetails, updatedDetails, params.NoPersistKeys)
+
+		fields := make([]zap.Field, 0, len(result.Changes))
+		for _, change := range result.Changes {
+			fields = append(fields, zap.String(change.Field, change.Old+" → "+change.New))
+		}
+		log.Info("license changes", fields...)
+	}
+	if err != nil {
+		return Fail(FailureUpdate, err)
+	}
+	result.Outcome = OutcomeRenewed
+
+	if params.VerifyAuditLog {
+		recordAudit(ctx, log, params, application, licenseDetails, updatedDetails, licenseKey, updateStartedAt)
+	}
 	return nil
 }
 
-func run(ctx context.Context, log *zap.Logger) error {
-	var cfg config.Config
+// recordAudit looks up the license update in the audit log of the instance and appends the renewal to the audit
+// log of the tool, a missing record is logged but does not fail the renewal.
+func recordAudit(
+	ctx context.Context,
+	log *zap.Logger,
+	params ProcessInstanceParams,
+	application Application,
+	before, after *ResolveLicenseDetailsResult,
+	licenseKey string,
+	since time.Time,
+) {
+	entry := AuditEntry{
+		Time:              time.Now().UTC(),
+		RunID:             params.RunID,
+		Instance:          InstanceName(params.Instance),
+		BaseURL:           params.Instance.BaseURL,
+		Application:       application.Key,
+		SEN:               after.SEN,
+		LicenseKeyHash:    LicenseKeyHash(licenseKey),
+		PreviousExpiresAt: before.TrialExpiresAt,
+		ExpiresAt:         after.TrialExpiresAt,
+	}
 
-	if file, err := os.Open("./config.yml"); err != nil {
-		return fmt.Errorf("error reading config: %w", err)
-	} else {
-		defer file.Close()
+	record, err := func() (*AuditRecord, error) {
+		creds, err := credentials.ResolveCredentials(ctx, params.Instance.Account)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve credentials: %w", err)
+		}
+		defer creds.Wipe()
 
-		if err := yaml.NewDecoder(file).Decode(&cfg); err != nil {
-			return fmt.Errorf("error decoding config: %w", err)
+		client := &RESTClient{
+			HTTP:        NewRESTHTTPClient(20 * time.Second),
+			BaseURL:     NavigationBaseURL(params.Instance),
+			Credentials: creds,
+		}
+		attempts, interval := params.VerifyUpdate.Attempts, params.VerifyUpdate.Interval
+		if attempts <= 0 {
+			attempts = 3
+		}
+		if interval <= 0 {
+			interval = 5 * time.Second
 		}
+		return WaitForLicenseAuditRecord(ctx, log, client, since, attempts, interval)
+	}()
+	if err != nil {
+		log.Warn("could not confirm the renewal in the audit log of the instance", zap.Error(err))
+		entry.AuditError = err.Error()
+	} else {
+		log.Info("renewal confirmed in the audit log of the instance", zap.String("audit id", record.ID), zap.String("action", record.Action))
+		entry.InstanceAuditID = record.ID
 	}
 
-	if err := os.MkdirAll("./data", 0700); err != nil {
-		return fmt.Errorf("error creating data directory: %w", err)
+	if err := AppendAuditEntry(entry); err != nil {
+		log.Warn("could not write audit log", zap.Error(err))
 	}
+}
+
+type RunOptions struct {
+	Force         bool
+	NoPersistKeys bool
+	DryRun        bool
+	// only read licenses and decide, implies DryRun
+	CheckOnly    bool
+	Verbose      bool
+	InstanceLogs bool
+	Events       EventSink
+
+	// asks before each renewal, nil renews without asking
+	Confirm *Confirmer
 
-	runOptions := &playwright.RunOptions{
-		DriverDirectory: "./data/playwright",
-		Browsers:        []string{"chromium"},
+	RunID           string
+	InstanceContext func(ctx context.Context, instance string) (context.Context, context.CancelFunc)
+	// resolve the server ids again instead of using the cached ones
+	RefreshServerIDs bool
+}
+
+func run(ctx context.Context, log *zap.Logger, cfg *config.Config, options RunOptions) ([]InstanceResult, error) {
+	ctx = WithPlaywrightTimeouts(ctx, cfg.Playwright)
+	if !options.Verbose {
+		log = log.WithOptions(zap.IncreaseLevel(zap.WarnLevel))
 	}
 
-	if err := playwright.Install(runOptions); err != nil {
-		return err
+	store, err := OpenState()
+	if err != nil {
+		return nil, err
 	}
 
-	pw, err := playwright.Run(runOptions)
+	// the scheduler and the operator skip paused runs before they get here, a manual run fails so it does not
+	// look like it renewed nothing; checks change nothing and still run
+	if pause := store.Paused(); pause != nil && !options.CheckOnly {
+		return nil, fmt.Errorf("%w since %s: %s, use resume first", ErrPaused, FormatDateTime(pause.At), pause.Reason)
+	}
+
+	serverIDs, err := OpenServerIDCache()
 	if err != nil {
-		return fmt.Errorf("could not run playwright: %w", err)
+		return nil, err
+	}
+	if options.RefreshServerIDs {
+		baseURLs := make([]string, 0, len(cfg.Instances))
+		for _, instance := range cfg.Instances {
+			baseURLs = append(baseURLs, instance.BaseURL)
+		}
+		if err := serverIDs.Delete(baseURLs...); err != nil {
+			return nil, err
+		}
 	}
-	defer pw.Stop()
 
-	var browserContext playwright.BrowserContext
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(context.Canceled)
 
-	if ep := cfg.Playwright.Endpoint; ep != "" {
-		browser, err := pw.Chromium.ConnectOverCDP(cfg.Playwright.Endpoint)
-		if err != nil {
-			return fmt.Errorf("could not connect to browser: %w", err)
+	rootGroup, ctx := errgroup.WithContext(ctx)
+
+	// instances whose license was read over REST and need no renewal skip the browser
+	prechecked := make([]*InstanceResult, len(cfg.Instances))
+	if cfg.Precheck.Enabled && !options.Force {
+		prechecked = Precheck(ctx, log, cfg, func(instance config.JiraInstance) *time.Time {
+			return store.Instance(instance.BaseURL).LastRenewedAt
+		})
+		pending := 0
+		for _, result := range prechecked {
+			if result == nil {
+				pending++
+			}
 		}
-		defer browser.Close()
+		log.Info("precheck done", zap.Int("instances", len(cfg.Instances)), zap.Int("need browser", pending))
+	}
 
-		browserContext, err = browser.NewContext()
-		if err != nil {
-			return fmt.Errorf("error creating browser context: %w", err)
+	var pool *BrowserPool
+	if slices.Contains(prechecked, nil) {
+		if pool, err = NewBrowserPool(cfg); err != nil {
+			return nil, err
 		}
-		defer browserContext.Close()
-	} else {
-		browserContext, err = pw.Chromium.LaunchPersistentContext("./data/browser", playwright.BrowserTypeLaunchPersistentContextOptions{
-			Headless: playwright.Bool(!cfg.Playwright.Headful),
-		})
+		defer pool.Close()
+	}
+
+	// my.atlassian.com is used by one instance at a time, its page is reopened when the browser is relaunched
+	// or the page was closed or crashed
+	var (
+		atlassianMu         sync.Mutex
+		atlassianBrowser    *Browser
+		atlassianSession    *SessionContext
+		atlassianPage       playwright.Page
+		atlassianPageCancel context.CancelFunc
+		// listed once per run for reuseEvaluations
+		atlassianLicenses []AtlassianLicense
+		// products whose evaluation quota ran out, the remaining instances needing them are not tried
+		quotaExhausted = make(map[string]error)
+		// set once the account gets no more evaluations at all, no remaining instance is tried
+		evaluationLimit error
+	)
+	defer func() {
+		if atlassianSession != nil {
+			if err := atlassianSession.Close(); err != nil {
+				log.Warn("could not save atlassian session", zap.Error(err))
+			}
+		}
+	}()
+
+	runID := options.RunID
+	if runID == "" {
+		runID = NewRunID()
+	}
+	log.Info("starting run", zap.String("run id", runID))
+
+	progress := io.Writer(os.Stdout)
+	// check prints its report to stdout
+	if options.Events != nil || options.CheckOnly {
+		progress = os.Stderr
+	}
+
+	events := options.Events.With(Event{RunID: runID, Profile: cfg.Profile})
+	events.Emit(Event{Type: EventRunStarted, Total: len(cfg.Instances)})
+
+	if !cfg.Playwright.IsolateSessions {
+		for _, collision := range SessionCollisions(cfg.Instances) {
+			names := make([]string, 0, len(collision.Instances))
+			for _, instance := range collision.Instances {
+				names = append(names, InstanceName(instance))
+			}
+			log.Warn(
+				"instances share a single sign-on domain with different accounts, isolating their sessions",
+				zap.String("domain", collision.Domain),
+				zap.Strings("instances", names),
+			)
+		}
+	}
+
+	selectorTracker := NewSelectorTracker()
+	if cfg.Telemetry.Enabled {
+		selectorTracker.CollectFailures()
+	}
+	ctx = WithSelectorTracker(ctx, selectorTracker)
+	defer func() {
+		if err := selectorTracker.Save(store); err != nil {
+			log.Error("saving selector health failed", zap.Error(err))
+		}
+		if cfg.Telemetry.Enabled {
+			if err := SendTelemetry(context.WithoutCancel(ctx), cfg.Telemetry, selectorTracker.TelemetryReport()); err != nil {
+				log.Warn("sending telemetry failed", zap.Error(err))
+			}
+		}
+	}()
+
+	atlassianBackoff := &Backoff{
+		Base: cfg.Atlassian.Backoff.Base,
+		Max:  cfg.Atlassian.Backoff.Max,
+	}
+	if atlassianBackoff.Base <= 0 {
+		atlassianBackoff.Base = 30 * time.Second
+	}
+	if atlassianBackoff.Max <= 0 {
+		atlassianBackoff.Max = 10 * time.Minute
+	}
+
+	retryBackoff := cfg.RetryBackoff
+	if retryBackoff <= 0 {
+		retryBackoff = 10 * time.Second
+	}
+
+	noPersistKeys := options.NoPersistKeys || cfg.NoPersistKeys
+	dryRun := options.DryRun || cfg.DryRun || options.CheckOnly
+	if dryRun {
+		log.Info("dry run: no license keys are generated or applied")
+	}
+
+	var progressMu sync.Mutex
+
+	var confirm func(ctx context.Context, question string) (bool, error)
+	if options.Confirm != nil && !dryRun {
+		confirm = options.Confirm.Confirm
+	}
+
+	// the page outlives the instance that opened it, its handlers stop with the run
+	runCtx := ctx
+
+	// ensureAtlassianPage opens the atlassian page in the browser of the lease, or again when the previous one is gone
+	ensureAtlassianPage := func(lease *BrowserLease, instanceLog *zap.Logger) error {
+		if atlassianBrowser == lease.Browser && atlassianPage != nil && !atlassianPage.IsClosed() {
+			return nil
+		}
+
+		if atlassianBrowser != lease.Browser {
+			session, err := lease.Browser.AtlassianSession(cfg.Atlassian.Account)
+			if err != nil {
+				cancel(err)
+				return context.Canceled
+			}
+			atlassianBrowser, atlassianSession = lease.Browser, session
+		} else {
+			instanceLog.Warn("atlassian page was closed, opening it again")
+		}
+		if atlassianPageCancel != nil {
+			atlassianPageCancel()
+		}
+
+		pageCtx, pageCancel := context.WithCancel(runCtx)
+		page, err := StartAtlassianPage(pageCtx, rootGroup, atlassianSession.BrowserContext, cfg.Atlassian)
 		if err != nil {
-			return fmt.Errorf("could not launch browser: %w", err)
+			pageCancel()
+			atlassianPage, atlassianPageCancel = nil, nil
+			return Fail(FailureBrowser, fmt.Errorf("could not open atlassian page: %w", err))
 		}
-		defer browserContext.Close()
+		atlassianPage, atlassianPageCancel = page, pageCancel
+		return nil
 	}
 
-	jiraPage, err := browserContext.NewPage()
-	if err != nil {
-		return fmt.Errorf("could not create page: %w", err)
+	getLicenseKey := func(ctx context.Context, lease *BrowserLease, instanceLog *zap.Logger, instance config.JiraInstance, application Application, serverID string) (string, error) {
+		atlassianMu.Lock()
+		defer atlassianMu.Unlock()
+
+		if evaluationLimit != nil {
+			return "", evaluationLimit
+		}
+		if err, ok := quotaExhausted[application.EvaluationProduct]; ok {
+			return "", err
+		}
+
+		params := GetLicenseKeyParams{
+			ServerID:        serverID,
+			Product:         application.EvaluationProduct,
+			Edition:         application.EvaluationEdition,
+			StepTimeout:     cfg.Atlassian.Timeouts.Step,
+			GenerateTimeout: cfg.Atlassian.Timeouts.Generate,
+			Log:             instanceLog,
+		}
+		if cfg.Atlassian.LabelEvaluations {
+			params.Label = fmt.Sprintf("%s (run %s)", InstanceName(instance), runID)
+		}
+
+		if cfg.Atlassian.ReuseEvaluations {
+			if err := ensureAtlassianPage(lease, instanceLog); err != nil {
+				return "", err
+			}
+			if atlassianLicenses == nil {
+				licenses, err := ListAtlassianLicenses(ctx, atlassianPage)
+				if err != nil {
+					instanceLog.Warn("could not list atlassian licenses, evaluations are not reused", zap.Error(err))
+					licenses = []AtlassianLicense{}
+				}
+				atlassianLicenses = licenses
+			}
+
+			// a reused evaluation must not be due for renewal again right away
+			thresholdDays := policy.DefaultThresholdDays
+			if instancePolicy, err := policy.New(cfg.InstancePolicy(instance)); err == nil {
+				thresholdDays = instancePolicy.ThresholdDays
+			}
+			validUntil := time.Now().AddDate(0, 0, thresholdDays+1)
+			if license, ok := FindReusableEvaluation(atlassianLicenses, params, validUntil); ok {
+				instanceLog.Info("reusing existing evaluation", zap.String("sen", license.SEN), zap.Time("expires at", *license.ExpiresAt))
+				return license.LicenseKey, nil
+			}
+		}
+
+		for retry := 0; ; retry++ {
+			if err := atlassianBackoff.Wait(ctx); err != nil {
+				return "", err
+			}
+			if err := ensureAtlassianPage(lease, instanceLog); err != nil {
+				return "", err
+			}
+
+			licenseKey, err := GetLicenseKey(ctx, atlassianPage, params)
+			if err == nil {
+				atlassianBackoff.Success()
+				// the browser may be recycled before the end of the run
+				if err := atlassianSession.Save(); err != nil {
+					instanceLog.Warn("could not save atlassian session", zap.Error(err))
+				}
+				return licenseKey, nil
+			}
+
+			if errors.Is(err, ErrEvaluationLimit) {
+				instanceLog.Error("evaluation limit of the atlassian account reached, skipping the remaining renewals", zap.Error(err))
+				evaluationLimit = err
+				return "", err
+			}
+			if errors.Is(err, ErrEvaluationQuota) {
+				instanceLog.Warn("evaluation quota exhausted, blocking the remaining instances of the product", zap.String("product", application.EvaluationProduct), zap.Error(err))
+				quotaExhausted[application.EvaluationProduct] = err
+				return "", err
+			}
+
+			unavailable := errors.Is(err, ErrAtlassianUnavailable)
+			if unavailable {
+				delay := atlassianBackoff.Failure()
+				instanceLog.Warn("delaying atlassian requests", zap.Duration("delay", delay), zap.Error(err))
+			}
+
+			// a closed or crashed page is opened again by the next attempt
+			pageLost := atlassianPage.IsClosed()
+			if retry >= cfg.Retries || ctx.Err() != nil || !(IsTransient(err) || pageLost) {
+				return "", err
+			}
+
+			// the atlassian backoff already delays the next attempt when atlassian is unavailable
+			delay := time.Duration(0)
+			if !unavailable {
+				delay = RetryDelay(retryBackoff, retry)
+			}
+			instanceLog.Warn("generating license key failed, retrying", zap.Int("attempt", retry+1), zap.Duration("delay", delay), zap.Error(err))
+			if err := sleepContext(ctx, delay); err != nil {
+				return "", err
+			}
+		}
 	}
-	defer jiraPage.Close()
 
-	ctx, cancel := context.WithCancelCause(ctx)
+	// processRunInstance returns an error only when the run cannot continue, instance failures are part of the result
+	processRunInstance := func(ctx context.Context, i int, instance config.JiraInstance) (*InstanceResult, error) {
+		instanceLog := log.With(zap.String("instance", InstanceName(instance)))
+		instanceEvents := events.With(Event{Instance: InstanceName(instance)})
+		finished := func(result InstanceResult) {
+			event := ResultEvent(result)
+			event.Index, event.Total = i+1, len(cfg.Instances)
+			instanceEvents.Emit(event)
+			if !options.Verbose {
+				progressMu.Lock()
+				PrintProgress(progress, i+1, len(cfg.Instances), result)
+				progressMu.Unlock()
+			}
+		}
 
-	rootGroup, ctx := errgroup.WithContext(ctx)
+		if options.InstanceLogs || cfg.Logs.InstanceFiles {
+			fileLog, closeLog, err := OpenInstanceLog(instanceLog, runID, InstanceName(instance))
+			if err != nil {
+				instanceLog.Error("could not open instance log", zap.Error(err))
+			} else {
+				instanceLog = fileLog
+				defer closeLog()
+			}
+		}
 
-	resolveAtlassianPage := sync.OnceValues(func() (playwright.Page, error) {
-		atlassianPage, err := browserContext.NewPage()
+		result := InstanceResult{Instance: InstanceName(instance)}
+		instanceEvents.Emit(Event{Type: EventInstanceStarted, Index: i + 1, Total: len(cfg.Instances)})
+
+		instancePolicy, err := policy.New(cfg.InstancePolicy(instance))
 		if err != nil {
-			return nil, fmt.Errorf("could not create page: %w", err)
+			result.SetError(Fail(FailureConfig, fmt.Errorf("invalid policy: %w", err)))
+			instanceLog.Error("processing failed", zap.String("outcome", result.Status()), zap.Error(result.Err))
+			finished(result)
+			return &result, nil
+		}
+		if options.Force {
+			instancePolicy.Force = true
 		}
 
-		rootGroup.Go(func() error {
-			defer atlassianPage.Close()
-			<-ctx.Done()
-			return nil
-		})
+		previous := store.Instance(instance.BaseURL)
+
+		var failureCapture string
+		if prechecked[i] != nil {
+			result = *prechecked[i]
+			instanceLog.Info("license read over rest", zap.String("days left", formatDaysLeft(result.ExpiresAt)), zap.String("decision", result.Decision))
+		} else {
+			lease, err := pool.Acquire(instanceLog, InstanceSessionKey(instance))
+			if err != nil {
+				return nil, err
+			}
+			defer pool.Release(lease)
 
-		_ = rootGroup.TryGo(func() error {
-			return (&AtlassianLoginHandler{
-				UsernameResolver: func(ctx context.Context) (string, error) {
-					creds, err := credentials.ResolveCredentials(ctx, cfg.Atlassian.Account)
-					if err != nil {
-						return "", err
+			// a retried attempt applies the key generated by the failed one instead of generating another evaluation
+			generated := map[string]string{}
+			relaunched, retry := false, 0
+			for {
+				instanceCtx, cancelInstance := context.WithCancel(ctx)
+				if options.InstanceContext != nil {
+					instanceCtx, cancelInstance = options.InstanceContext(ctx, InstanceName(instance))
+				}
+				// pending playwright calls do not observe the context, closing the page aborts them
+				page := lease.Page
+				closeOnCancel := context.AfterFunc(instanceCtx, func() {
+					if ctx.Err() == nil {
+						_ = page.Close()
 					}
-					return creds.Username, nil
-				},
-				PasswordResolver: func(ctx context.Context) (string, error) {
-					creds, err := credentials.ResolveCredentials(ctx, cfg.Atlassian.Account)
-					if err != nil {
-						return "", err
+				})
+				err = processInstance(instanceCtx, instanceLog, page, ProcessInstanceParams{
+					Instance:       instance,
+					Policy:         instancePolicy,
+					LastRenewedAt:  previous.LastRenewedAt,
+					NoPersistKeys:  noPersistKeys,
+					DryRun:         dryRun,
+					CheckOnly:      options.CheckOnly,
+					UpdateFallback: cfg.UpdateFallback,
+					PreferREST:     cfg.InstancePreferREST(instance),
+					VerifyUpdate:   cfg.VerifyUpdate,
+					VerifyAuditLog: cfg.VerifyAuditLog,
+					RunID:          runID,
+					ServerIDs:      serverIDs,
+					Events:         instanceEvents,
+					Confirm:        confirm,
+					GetLicenseKey: func(ctx context.Context, application Application, serverID string) (string, error) {
+						generatedKey := serverID + " " + application.EvaluationEdition
+						if licenseKey, ok := generated[generatedKey]; ok {
+							return licenseKey, nil
+						}
+						licenseKey, err := getLicenseKey(ctx, lease, instanceLog, instance, application, serverID)
+						if err == nil {
+							generated[generatedKey] = licenseKey
+						}
+						return licenseKey, err
+					},
+				}, &result)
+				instanceCanceled := !closeOnCancel() && ctx.Err() == nil
+				cancelInstance()
+
+				if instanceCanceled {
+					instanceLog.Warn("instance canceled")
+					err = context.Canceled
+					break
+				}
+
+				if err == nil || ctx.Err() != nil {
+					break
+				}
+
+				if IsBrowserCrash(err) && !relaunched {
+					relaunched = true
+					instanceLog.Warn("browser crashed, relaunching", zap.Error(err))
+					result = InstanceResult{Instance: result.Instance}
+
+					if launchErr := pool.Relaunch(lease); launchErr != nil {
+						err = fmt.Errorf("relaunching browser: %w", launchErr)
+						break
 					}
-					return creds.Password, nil
-				},
-				OTPCodeResolver: func(ctx context.Context) (string, error) {
-					os.Stdout.WriteString("OTP Code: ")
-					reader := bufio.NewReader(os.Stdin)
-					text, _ := reader.ReadString('\n')
-					text = strings.Replace(text, "\n", "", -1)
-					return text, nil
-				},
-			}).Run(ctx, atlassianPage)
-		})
+					continue
+				}
 
-		return atlassianPage, nil
-	})
+				// license key generation is retried on its own
+				var failure *FailureError
+				if retry >= cfg.Retries || !IsTransient(err) || (errors.As(err, &failure) && failure.Category == FailureLicenseKey) {
+					break
+				}
+
+				delay := RetryDelay(retryBackoff, retry)
+				retry++
+				instanceLog.Warn("processing failed, retrying", zap.Int("attempt", retry), zap.Duration("delay", delay), zap.Error(err))
+				result = InstanceResult{Instance: result.Instance}
+
+				if sleepContext(ctx, delay) != nil {
+					break
+				}
+			}
+
+			if err != nil && !IsBrowserCrash(err) && !errors.Is(err, context.Canceled) && !EvaluationRefused(err) && !lease.Page.IsClosed() {
+				dir, captureErr := CaptureFailure(lease.Page, CaptureFailureParams{Instance: InstanceName(instance), HTML: !noPersistKeys})
+				if captureErr != nil {
+					instanceLog.Warn("could not capture failure", zap.Error(captureErr))
+				}
+				failureCapture = dir
+			}
 
-	for _, instance := range cfg.Instances {
-		instanceLog := log.With(zap.String("instance", instance.BaseURL))
+			if IsBrowserCrash(err) {
+				err = Fail(FailureBrowser, err)
+			}
+
+			if errors.Is(err, context.Canceled) {
+				err = Fail(FailureCanceled, err)
+			}
 
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
+			result.SetError(err)
 		}
 
-		instanceCtx, cancelInstance := context.WithCancel(ctx)
-		if err := processInstance(instanceCtx, instanceLog, jiraPage, instance, func(ctx context.Context, serverId string) (string, error) {
-			page, err := resolveAtlassianPage()
-			if err != nil {
-				cancel(err)
-				return "", context.Canceled
+		if keyHash := LicenseKeyHash(result.LicenseKey); keyHash != "" && previous.LicenseKeyHash != "" && result.Outcome != OutcomeRenewed && keyHash != previous.LicenseKeyHash {
+			instanceLog.Warn("license key changed since last run")
+		}
+
+		result.BaseURL, result.PreviousStatus = instance.BaseURL, previous.LastOutcome
+
+		// a dry run must not influence the next real run
+		if !dryRun {
+			if err := store.UpdateInstance(instance.BaseURL, func(s *state.InstanceState) {
+				now := time.Now()
+				s.LastRunAt = &now
+				s.LastOutcome = result.Status()
+				if !result.Failing() {
+					s.NotifiedFailures = nil
+				}
+				if result.Outcome == OutcomeRenewed {
+					s.LastRenewedAt = &now
+				}
+				if result.ExpiresAt != nil {
+					s.ExpiresAt = result.ExpiresAt
+				}
+				if result.LicenseKey != "" {
+					s.LicenseKeyHash = LicenseKeyHash(result.LicenseKey)
+					s.LicenseKey = ""
+					if !noPersistKeys {
+						s.LicenseKey = result.LicenseKey
+					}
+				}
+			}); err != nil {
+				instanceLog.Error("saving state failed", zap.Error(err))
+			}
+		}
+
+		finished(result)
+
+		if result.Err != nil {
+			fields := []zap.Field{zap.String("outcome", result.Status()), zap.Error(result.Err)}
+			if failureCapture != "" {
+				fields = append(fields, zap.String("capture", failureCapture))
 			}
-			return GetLicenseKey(ctx, page, GetLicenseKeyParams{
-				ServerID: serverId,
-			})
-		}); err != nil {
-			instanceLog.Error("processing failed", zap.Error(err))
-			cancelInstance()
-			continue
+			instanceLog.Error("processing failed", fields...)
+		} else {
+			instanceLog.Info("processing done", zap.String("outcome", result.Status()))
 		}
 
-		cancelInstance()
-		instanceLog.Info("processing done")
+		return &result, nil
 	}
 
+	maxParallel := max(cfg.MaxParallel, 1)
+	slots := make([]*InstanceResult, len(cfg.Instances))
+
+	instancesGroup, instancesCtx := errgroup.WithContext(ctx)
+	instancesGroup.SetLimit(maxParallel)
+
+	// instances whose trial had expired at the last run go first, they may be read-only until renewed
+	now := time.Now()
+	order := make([]int, 0, len(cfg.Instances))
+	for _, expired := range []bool{true, false} {
+		for i, instance := range cfg.Instances {
+			expiresAt := store.Instance(instance.BaseURL).ExpiresAt
+			if (expiresAt != nil && !expiresAt.After(now)) == expired {
+				order = append(order, i)
+			}
+		}
+	}
+
+	for _, i := range order {
+		instance := cfg.Instances[i]
+		if instancesCtx.Err() != nil {
+			break
+		}
+
+		instancesGroup.Go(func() error {
+			if instancesCtx.Err() != nil {
+				return nil
+			}
+
+			result, err := processRunInstance(instancesCtx, i, instance)
+			slots[i] = result
+			return err
+		})
+	}
+	fatalErr := instancesGroup.Wait()
+
+	results := make([]InstanceResult, 0, len(cfg.Instances))
+	for _, result := range slots {
+		if result != nil {
+			results = append(results, *result)
+		}
+	}
+	notify := func(runErr error) {
+		if len(cfg.Notifications) == 0 {
+			return
+		}
+		title := "jira-auto-trial"
+		if cfg.Profile != "" {
+			title += " (" + cfg.Profile + ")"
+		}
+		// a dry run does not record which failures were sent
+		notifyStore := store
+		if dryRun {
+			notifyStore = nil
+		}
+		if err := Notify(context.WithoutCancel(ctx), cfg.Notifications, RunSummary{Title: title, RunID: runID, Results: results, Err: runErr}, notifyStore); err != nil {
+			log.Error("sending notifications failed", zap.Error(err))
+		}
+	}
+
+	if fatalErr != nil {
+		notify(fatalErr)
+		return results, fatalErr
+	}
+	if err := ctx.Err(); err != nil {
+		// the instances that finished before the run was canceled are reported too
+		notify(err)
+		return results, err
+	}
+
+	for _, result := range results {
+		changes := make([]string, 0, len(result.Changes))
+		for _, change := range result.Changes {
+			changes = append(changes, change.String())
+		}
+		log.Info("result", zap.String("instance", result.Instance), zap.String("outcome", result.Status()), zap.String("days left", formatDaysLeft(result.ExpiresAt)), zap.String("decision", result.Decision), zap.Strings("changes", changes))
+	}
+
+	notify(nil)
+
+	events.Emit(Event{Type: EventRunFinished, Total: len(cfg.Instances)})
+
 	cancel(context.Canceled)
 
-	return rootGroup.Wait()
+	return results, rootGroup.Wait()
 }
@@ -0,0 +1,70 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BrowserMemoryUsage sums the resident memory of all descendants of this process,
+// which covers the playwright driver and the browser processes it launched.
+func BrowserMemoryUsage() (uint64, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0, err
+	}
+
+	parents := make(map[int]int, len(entries))
+	rss := make(map[int]uint64, len(entries))
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		status, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "status"))
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(status))
+		for scanner.Scan() {
+			key, value, ok := strings.Cut(scanner.Text(), ":")
+			if !ok {
+				continue
+			}
+			fields := strings.Fields(value)
+			if len(fields) == 0 {
+				continue
+			}
+
+			switch key {
+			case "PPid":
+				parents[pid], _ = strconv.Atoi(fields[0])
+			case "VmRSS":
+				kb, _ := strconv.ParseUint(fields[0], 10, 64)
+				rss[pid] = kb * 1024
+			}
+		}
+	}
+
+	self := os.Getpid()
+
+	var total uint64
+	for pid, usage := range rss {
+		for parent, depth := parents[pid], 0; parent > 1 && depth < 64; parent, depth = parents[parent], depth+1 {
+			if parent == self {
+				total += usage
+				break
+			}
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runDurationBuckets are the upper bounds of the run duration histogram in seconds.
+var runDurationBuckets = []float64{30, 60, 120, 300, 600, 1200, 1800, 3600, 7200}
+
+// Metrics collects run events for the prometheus /metrics endpoint of serve.
+type Metrics struct {
+	mu sync.Mutex
+
+	// keyed by the rendered labels of the series
+	expiresAt map[string]time.Time
+	renewals  map[string]int
+	failures  map[string]int
+
+	runDurationCounts []int
+	runDurationSum    float64
+	runDurationCount  int
+	runFailures       int
+	lastRunAt         time.Time
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		expiresAt:         make(map[string]time.Time),
+		renewals:          make(map[string]int),
+		failures:          make(map[string]int),
+		runDurationCounts: make([]int, len(runDurationBuckets)),
+	}
+}
+
+func (m *Metrics) ObserveEvent(event Event) {
+	if event.Type != EventInstanceFinished {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// instances with several applications are reported per application
+	if len(event.Applications) > 0 {
+		for _, application := range event.Applications {
+			m.observe(metricLabels(event.Instance, application.Application), application.Outcome, application.ExpiresAt)
+		}
+		return
+	}
+	m.observe(metricLabels(event.Instance, ""), event.Outcome, event.ExpiresAt)
+}
+
+func (m *Metrics) observe(labels, outcome string, expiresAt *time.Time) {
+	if expiresAt != nil {
+		m.expiresAt[labels] = *expiresAt
+	}
+	switch {
+	case strings.HasPrefix(outcome, string(OutcomeRenewed)):
+		m.renewals[labels]++
+	case strings.HasPrefix(outcome, string(OutcomeFailed)):
+		m.failures[labels]++
+	}
+}
+
+// metricLabels renders the labels of a series, the maps of Metrics are keyed by them.
+func metricLabels(instance, application string) string {
+	labels := fmt.Sprintf("instance=\"%s\"", metricLabelEscaper.Replace(instance))
+	if application != "" {
+		labels += fmt.Sprintf(",application=\"%s\"", metricLabelEscaper.Replace(application))
+	}
+	return labels
+}
+
+// ObserveRun records a finished run, err is the error that stopped it.
+func (m *Metrics) ObserveRun(duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastRunAt = time.Now()
+	if err != nil {
+		m.runFailures++
+	}
+
+	seconds := duration.Seconds()
+	for i, bound := range runDurationBuckets {
+		if seconds <= bound {
+			m.runDurationCounts[i]++
+		}
+	}
+	m.runDurationSum += seconds
+	m.runDurationCount++
+}
+
+// WriteTo writes the metrics in the prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	now := time.Now()
+
+	b.WriteString("# HELP jira_trial_days_remaining Days until the trial license of the instance expires, as of the last run.\n")
+	b.WriteString("# TYPE jira_trial_days_remaining gauge\n")
+	for _, labels := range sortedKeys(m.expiresAt) {
+		days := m.expiresAt[labels].Sub(now).Hours() / 24
+		fmt.Fprintf(&b, "jira_trial_days_remaining{%s} %s\n", labels, formatMetricValue(math.Floor(days*100)/100))
+	}
+
+	writeCounter := func(name, help string, values map[string]int) {
+		fmt.Fprintf(&b, "# HELP %s %s\n", name, help)
+		fmt.Fprintf(&b, "# TYPE %s counter\n", name)
+		for _, labels := range sortedKeys(values) {
+			fmt.Fprintf(&b, "%s{%s} %d\n", name, labels, values[labels])
+		}
+	}
+	writeCounter("jira_trial_renewals_total", "Renewed trial licenses since the daemon started.", m.renewals)
+	writeCounter("jira_trial_failures_total", "Failed instance runs since the daemon started.", m.failures)
+
+	b.WriteString("# HELP jira_trial_run_duration_seconds Duration of runs.\n")
+	b.WriteString("# TYPE jira_trial_run_duration_seconds histogram\n")
+	for i, bound := range runDurationBuckets {
+		fmt.Fprintf(&b, "jira_trial_run_duration_seconds_bucket{le=\"%s\"} %d\n", formatMetricValue(bound), m.runDurationCounts[i])
+	}
+	fmt.Fprintf(&b, "jira_trial_run_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.runDurationCount)
+	fmt.Fprintf(&b, "jira_trial_run_duration_seconds_sum %s\n", formatMetricValue(m.runDurationSum))
+	fmt.Fprintf(&b, "jira_trial_run_duration_seconds_count %d\n", m.runDurationCount)
+
+	b.WriteString("# HELP jira_trial_run_failures_total Runs that stopped with an error since the daemon started.\n")
+	b.WriteString("# TYPE jira_trial_run_failures_total counter\n")
+	fmt.Fprintf(&b, "jira_trial_run_failures_total %d\n", m.runFailures)
+
+	// absent until the first run, so a restarted daemon is not reported as having missed runs
+	if !m.lastRunAt.IsZero() {
+		b.WriteString("# HELP jira_trial_last_run_timestamp_seconds Unix time the last run finished.\n")
+		b.WriteString("# TYPE jira_trial_last_run_timestamp_seconds gauge\n")
+		fmt.Fprintf(&b, "jira_trial_last_run_timestamp_seconds %d\n", m.lastRunAt.Unix())
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatMetricValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
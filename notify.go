@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/state"
+)
+
+type RunSummary struct {
+	Title   string
+	RunID   string
+	Results []InstanceResult
+	// the run stopped before all instances were processed
+	Err error
+}
+
+func (s RunSummary) Count(outcome Outcome) int {
+	count := 0
+	for _, result := range s.Results {
+		if result.Outcome == outcome {
+			count++
+		}
+	}
+	return count
+}
+
+func (s RunSummary) Skipped() int {
+	count := 0
+	for _, result := range s.Results {
+		if result.Outcome.Skipped() {
+			count++
+		}
+	}
+	return count
+}
+
+// EvaluationLimit returns the error of the first instance that hit the evaluation limit of the account, or nil.
+func (s RunSummary) EvaluationLimit() error {
+	for _, result := range s.Results {
+		if errors.Is(result.Err, ErrEvaluationLimit) {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+// Text renders the summary as markdown understood by slack and discord, failed instances come first.
+func (s RunSummary) Text() string {
+	var b strings.Builder
+
+	failed := s.Count(OutcomeFailed)
+	if s.Err != nil {
+		fmt.Fprintf(&b, "🚨 *%s: run failed* - %s", s.Title, s.Err)
+	} else if failed > 0 {
+		fmt.Fprintf(&b, "🚨 *%s: %d failed*", s.Title, failed)
+	} else if blocked := s.Count(OutcomeBlockedByQuota); blocked > 0 {
+		fmt.Fprintf(&b, "⛔ *%s: %d blocked by evaluation quota*", s.Title, blocked)
+	} else {
+		fmt.Fprintf(&b, "*%s*", s.Title)
+	}
+	fmt.Fprintf(&b, "\n(%d renewed, %d skipped", s.Count(OutcomeRenewed), s.Skipped())
+	if blocked := s.Count(OutcomeBlockedByQuota); blocked > 0 {
+		fmt.Fprintf(&b, ", %d blocked by quota", blocked)
+	}
+	if wouldRenew := s.Count(OutcomeWouldRenew); wouldRenew > 0 {
+		fmt.Fprintf(&b, ", %d would renew", wouldRenew)
+	}
+	b.WriteString(")\n")
+	if s.EvaluationLimit() != nil {
+		b.WriteString("⛔ the Atlassian account reached its evaluation limit, the remaining renewals were skipped\n")
+	}
+
+	for _, failedFirst := range []bool{true, false} {
+		for _, result := range s.Results {
+			if (result.Outcome == OutcomeFailed || result.Outcome == OutcomeBlockedByQuota) != failedFirst {
+				continue
+			}
+
+			fmt.Fprintf(&b, "%s %s: %s", OutcomeIcon(result.Outcome), result.Instance, result.Status())
+			if result.ExpiresAt != nil {
+				fmt.Fprintf(&b, ", expires %s", FormatDate(*result.ExpiresAt))
+			}
+			if result.Recovered() {
+				fmt.Fprintf(&b, ", recovered from %s", result.PreviousStatus)
+			}
+			if result.Err != nil {
+				fmt.Fprintf(&b, " - %s", result.Err)
+			}
+			b.WriteString("\n")
+			for _, line := range ApplicationLines(result) {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+func (s RunSummary) Changed() bool {
+	return s.Err != nil || s.Count(OutcomeRenewed) > 0 || s.Count(OutcomeFailed) > 0 || s.Count(OutcomeBlockedByQuota) > 0
+}
+
+// discord rejects messages longer than this
+const discordMessageLimit = 2000
+
+// Notify sends the run summary to every configured notification target. The store records the failures sent to
+// onlyDeltas targets, it is nil when they must not be recorded.
+func Notify(ctx context.Context, notifications []config.Notification, summary RunSummary, store *state.Store) error {
+	errs := make([]error, 0)
+	for _, notification := range notifications {
+		if notification.OnlyChanges && !summary.Changed() {
+			continue
+		}
+
+		sent := summary
+		if notification.OnlyDeltas {
+			sent = deltaSummary(summary, notificationKey(notification), notification.RenotifyAfter, store)
+			if sent.Err == nil && len(sent.Results) == 0 {
+				continue
+			}
+		}
+
+		var err error
+		switch {
+		case notification.Slack != nil:
+			err = postNotification(ctx, *notification.Slack, map[string]string{"text": sent.Text()})
+		case notification.Discord != nil:
+			text := sent.Text()
+			if runes := []rune(text); len(runes) > discordMessageLimit {
+				text = string(runes[:discordMessageLimit-4]) + "\n..."
+			}
+			err = postNotification(ctx, *notification.Discord, map[string]string{"content": text})
+		case notification.Webhook != nil:
+			err = postNotification(ctx, *notification.Webhook, webhookPayload(sent))
+		default:
+			err = errors.New("notification has no target")
+		}
+		if err != nil {
+			errs = append(errs, err)
+		} else if notification.OnlyDeltas && store != nil {
+			if err := recordNotifiedFailures(store, notificationKey(notification), sent.Results); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// notificationKey identifies a notification target in the state without storing its url, which is a secret.
+func notificationKey(notification config.Notification) string {
+	kind, target := "webhook", notification.Webhook
+	switch {
+	case notification.Slack != nil:
+		kind, target = "slack", notification.Slack
+	case notification.Discord != nil:
+		kind, target = "discord", notification.Discord
+	}
+	if target == nil {
+		return kind
+	}
+	sum := sha256.Sum256([]byte(target.URL))
+	return kind + ":" + hex.EncodeToString(sum[:6])
+}
+
+// deltaSummary keeps the results that changed since the previous run: renewals, recoveries and failures the target
+// was not sent yet, or was sent with another status, or was sent longer than renotifyAfter ago.
+func deltaSummary(summary RunSummary, key string, renotifyAfter time.Duration, store *state.Store) RunSummary {
+	now := time.Now()
+	results := make([]InstanceResult, 0, len(summary.Results))
+	for _, result := range summary.Results {
+		switch {
+		case result.Outcome == OutcomeRenewed, result.Recovered():
+			results = append(results, result)
+		case result.Failing():
+			if store == nil || result.BaseURL == "" {
+				results = append(results, result)
+				continue
+			}
+			notified, ok := store.Instance(result.BaseURL).NotifiedFailures[key]
+			if !ok || notified.Status != failureStatus(result) || renotifyAfter > 0 && now.Sub(notified.At) >= renotifyAfter {
+				results = append(results, result)
+			}
+		}
+	}
+	summary.Results = results
+	return summary
+}
+
+func recordNotifiedFailures(store *state.Store, key string, results []InstanceResult) error {
+	now := time.Now()
+	for _, result := range results {
+		if !result.Failing() || result.BaseURL == "" {
+			continue
+		}
+		if err := store.UpdateInstance(result.BaseURL, func(s *state.InstanceState) {
+			if s.NotifiedFailures == nil {
+				s.NotifiedFailures = map[string]state.NotifiedFailure{}
+			}
+			s.NotifiedFailures[key] = state.NotifiedFailure{Status: failureStatus(result), At: now}
+		}); err != nil {
+			return fmt.Errorf("could not record sent notification: %w", err)
+		}
+	}
+	return nil
+}
+
+// failureStatus is the status without the expired marker, an instance whose trial expired meanwhile fails the same way.
+func failureStatus(result InstanceResult) string {
+	result.Expired = false
+	return result.Status()
+}
+
+type WebhookPayload struct {
+	Title     string  `json:"title"`
+	RunID     string  `json:"runId"`
+	Renewed   int     `json:"renewed"`
+	Skipped   int     `json:"skipped"`
+	Failed    int     `json:"failed"`
+	Blocked   int     `json:"blockedByQuota"`
+	Error     string  `json:"error,omitempty"`
+	Instances []Event `json:"instances"`
+}
+
+func webhookPayload(summary RunSummary) WebhookPayload {
+	payload := WebhookPayload{
+		Title:     summary.Title,
+		RunID:     summary.RunID,
+		Renewed:   summary.Count(OutcomeRenewed),
+		Skipped:   summary.Skipped(),
+		Failed:    summary.Count(OutcomeFailed),
+		Blocked:   summary.Count(OutcomeBlockedByQuota),
+		Instances: make([]Event, 0, len(summary.Results)),
+	}
+	if summary.Err != nil {
+		payload.Error = summary.Err.Error()
+	}
+	now := time.Now().UTC()
+	for _, result := range summary.Results {
+		event := ResultEvent(result)
+		event.Time, event.RunID = now, summary.RunID
+		payload.Instances = append(payload.Instances, event)
+	}
+	return payload
+}
+
+func postNotification(ctx context.Context, target config.NotificationWebhook, payload any) error {
+	timeout := target.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range target.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// the error includes the url, which is the secret of slack and discord webhooks
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("sending notification: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("notification responded with status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/kube"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+const jiraTrialAPI = "/apis/jira-auto-trial.tarik02.github.io/v1alpha1"
+
+type JiraTrialSecretRef struct {
+	Name        string `json:"name"`
+	UsernameKey string `json:"usernameKey,omitempty"`
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+type JiraTrialSpec struct {
+	BaseURL       string             `json:"baseURL"`
+	SecretRef     JiraTrialSecretRef `json:"secretRef"`
+	Schedule      string             `json:"schedule,omitempty"`
+	ThresholdDays *int               `json:"thresholdDays,omitempty"`
+}
+
+type JiraTrialStatus struct {
+	ObservedGeneration int64            `json:"observedGeneration,omitempty"`
+	LastRunAt          *time.Time       `json:"lastRunAt,omitempty"`
+	LastRenewedAt      *time.Time       `json:"lastRenewedAt,omitempty"`
+	TrialExpiresAt     *time.Time       `json:"trialExpiresAt,omitempty"`
+	LastOutcome        string           `json:"lastOutcome,omitempty"`
+	Conditions         []kube.Condition `json:"conditions,omitempty"`
+}
+
+type JiraTrial struct {
+	Metadata kube.ObjectMeta `json:"metadata"`
+	Spec     JiraTrialSpec   `json:"spec"`
+	Status   JiraTrialStatus `json:"status"`
+}
+
+type JiraTrialList struct {
+	Metadata kube.ListMeta `json:"metadata"`
+	Items    []JiraTrial   `json:"items"`
+}
+
+func jiraTrialsPath(namespace string) string {
+	if namespace == "" {
+		return jiraTrialAPI + "/jiratrials"
+	}
+	return fmt.Sprintf("%s/namespaces/%s/jiratrials", jiraTrialAPI, namespace)
+}
+
+func (t JiraTrial) Key() string {
+	return t.Metadata.Namespace + "/" + t.Metadata.Name
+}
+
+func (t JiraTrial) Interval() (time.Duration, error) {
+	if t.Spec.Schedule == "" {
+		return 24 * time.Hour, nil
+	}
+	interval, err := time.ParseDuration(t.Spec.Schedule)
+	if err != nil {
+		return 0, fmt.Errorf("invalid schedule %q: %w", t.Spec.Schedule, err)
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("invalid schedule %q: must be positive", t.Spec.Schedule)
+	}
+	return interval, nil
+}
+
+func (t JiraTrial) Due(now time.Time, interval time.Duration) bool {
+	if t.Status.LastRunAt == nil || t.Status.ObservedGeneration != t.Metadata.Generation {
+		return true
+	}
+	return !now.Before(t.Status.LastRunAt.Add(interval))
+}
+
+func jiraTrialInstance(ctx context.Context, client *kube.Client, trial JiraTrial) (config.JiraInstance, error) {
+	secret, err := client.GetSecret(ctx, trial.Metadata.Namespace, trial.Spec.SecretRef.Name)
+	if err != nil {
+		return config.JiraInstance{}, err
+	}
+
+	usernameKey, passwordKey := trial.Spec.SecretRef.UsernameKey, trial.Spec.SecretRef.PasswordKey
+	if usernameKey == "" {
+		usernameKey = "username"
+	}
+	if passwordKey == "" {
+		passwordKey = "password"
+	}
+
+	username, ok := secret.Data[usernameKey]
+	if !ok {
+		return config.JiraInstance{}, fmt.Errorf("secret %s has no key %q", trial.Spec.SecretRef.Name, usernameKey)
+	}
+	password, ok := secret.Data[passwordKey]
+	if !ok {
+		return config.JiraInstance{}, fmt.Errorf("secret %s has no key %q", trial.Spec.SecretRef.Name, passwordKey)
+	}
+
+	return config.JiraInstance{
+		Name:    trial.Key(),
+		BaseURL: trial.Spec.BaseURL,
+		Account: config.Account{
+			Plain: &config.AccountPlain{
+				Username: string(username),
+				Password: string(password),
+			},
+		},
+		Policy: config.Policy{
+			ThresholdDays: trial.Spec.ThresholdDays,
+		},
+	}, nil
+}
+
+func updateJiraTrialStatus(ctx context.Context, client *kube.Client, trial JiraTrial, result InstanceResult) error {
+	now := time.Now().UTC()
+
+	status := trial.Status
+	status.ObservedGeneration = trial.Metadata.Generation
+	status.LastRunAt = &now
+	status.LastOutcome = result.Status()
+	if result.ExpiresAt != nil {
+		status.TrialExpiresAt = result.ExpiresAt
+	}
+	if result.Outcome == OutcomeRenewed {
+		status.LastRenewedAt = &now
+	}
+
+	condition := kube.Condition{
+		Type:               "Ready",
+		Status:             "True",
+		Reason:             string(result.Outcome),
+		Message:            result.Decision,
+		ObservedGeneration: trial.Metadata.Generation,
+		LastTransitionTime: now,
+	}
+	if result.Err != nil {
+		condition.Status = "False"
+		condition.Message = result.Err.Error()
+	}
+	status.Conditions = kube.SetCondition(status.Conditions, condition)
+
+	path := fmt.Sprintf("%s/namespaces/%s/jiratrials/%s/status", jiraTrialAPI, trial.Metadata.Namespace, trial.Metadata.Name)
+	if err := client.MergePatch(ctx, path, map[string]any{"status": status}); err != nil {
+		return fmt.Errorf("could not update status of %s: %w", trial.Key(), err)
+	}
+	return nil
+}
+
+type OperatorOptions struct {
+	Namespace string
+	Resync    time.Duration
+	Run       RunOptions
+}
+
+func runOperator(ctx context.Context, log *zap.Logger, cfg *config.Config, options OperatorOptions) error {
+	client, err := kube.InClusterClient()
+	if err != nil {
+		return err
+	}
+
+	log.Info("starting operator", zap.String("namespace", options.Namespace), zap.Duration("resync", options.Resync))
+
+	trigger := make(chan struct{}, 1)
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		for ctx.Err() == nil {
+			err := client.Watch(ctx, jiraTrialsPath(options.Namespace), "", func(event kube.WatchEvent) error {
+				if event.Type == "ADDED" || event.Type == "MODIFIED" {
+					select {
+					case trigger <- struct{}{}:
+					default:
+					}
+				}
+				return nil
+			})
+			if err != nil && ctx.Err() == nil {
+				log.Warn("watching jiratrials failed", zap.Error(err))
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		return nil
+	})
+
+	g.Go(func() error {
+		ticker := time.NewTicker(options.Resync)
+		defer ticker.Stop()
+
+		for {
+			if err := reconcileJiraTrials(ctx, log, client, cfg, options); err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+				log.Error("reconcile failed", zap.Error(err))
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			case <-trigger:
+			}
+		}
+	})
+
+	return g.Wait()
+}
+
+func reconcileJiraTrials(ctx context.Context, log *zap.Logger, client *kube.Client, cfg *config.Config, options OperatorOptions) error {
+	store, err := OpenState()
+	if err != nil {
+		return err
+	}
+	if pause := store.Paused(); pause != nil {
+		log.Info("runs are paused, skipping reconcile", zap.String("paused at", FormatDateTime(pause.At)), zap.String("reason", pause.Reason))
+		return nil
+	}
+
+	var list JiraTrialList
+	if err := client.Get(ctx, jiraTrialsPath(options.Namespace), &list); err != nil {
+		return fmt.Errorf("could not list jiratrials: %w", err)
+	}
+
+	now := time.Now()
+	due := make(map[string]JiraTrial)
+	instances := make([]config.JiraInstance, 0)
+
+	for _, trial := range list.Items {
+		trialLog := log.With(zap.String("jiratrial", trial.Key()))
+
+		interval, err := trial.Interval()
+		if err == nil && !trial.Due(now, interval) {
+			continue
+		}
+
+		var instance config.JiraInstance
+		if err == nil {
+			instance, err = jiraTrialInstance(ctx, client, trial)
+		}
+		if err != nil {
+			trialLog.Error("invalid jiratrial", zap.Error(err))
+			result := InstanceResult{Instance: trial.Key()}
+			result.SetError(Fail(FailureConfig, err))
+			if err := updateJiraTrialStatus(ctx, client, trial, result); err != nil {
+				trialLog.Error("updating status failed", zap.Error(err))
+			}
+			continue
+		}
+
+		due[instance.Name] = trial
+		instances = append(instances, instance)
+	}
+
+	if len(instances) == 0 {
+		return nil
+	}
+
+	runCfg := *cfg
+	runCfg.Instances = instances
+
+	results, err := run(ctx, log, &runCfg, options.Run)
+
+	for _, result := range results {
+		trial, ok := due[result.Instance]
+		if !ok {
+			continue
+		}
+		if err := updateJiraTrialStatus(ctx, client, trial, result); err != nil {
+			log.Error("updating status failed", zap.String("jiratrial", trial.Key()), zap.Error(err))
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,234 @@
+package otp
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/credentials"
+)
+
+var (
+	defaultIMAPPattern = regexp.MustCompile(`\b(\d{6})\b`)
+	htmlTagPattern     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// resolveIMAP polls the mailbox for a verification email received after the code was requested.
+func resolveIMAP(ctx context.Context, source config.OTPIMAP) (string, error) {
+	requestedAt := time.Now().Add(-time.Minute)
+
+	timeout := source.Timeout
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	interval := source.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	folder := source.Folder
+	if folder == "" {
+		folder = "INBOX"
+	}
+	from := source.From
+	if from == "" {
+		from = "atlassian"
+	}
+	pattern := defaultIMAPPattern
+	if source.Pattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(source.Pattern); err != nil {
+			return "", fmt.Errorf("invalid imap otp pattern: %w", err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	c, err := dialIMAP(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	defer c.Logout()
+	// the client has no context support, closing the connection unblocks pending commands
+	stop := context.AfterFunc(ctx, func() { _ = c.Terminate() })
+	defer stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		code, err := findIMAPCode(c, folder, from, pattern, requestedAt)
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("no verification email in %s: %w", folder, ctx.Err())
+		}
+		if err != nil {
+			return "", err
+		}
+		if code != "" {
+			return code, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("no verification email in %s: %w", folder, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func dialIMAP(ctx context.Context, source config.OTPIMAP) (*client.Client, error) {
+	var (
+		c   *client.Client
+		err error
+	)
+	if source.StartTLS {
+		c, err = client.Dial(source.Address)
+		if err == nil {
+			err = c.StartTLS(nil)
+		}
+	} else {
+		c, err = client.DialTLS(source.Address, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to imap server %s: %w", source.Address, err)
+	}
+
+	creds, err := credentials.ResolveCredentials(ctx, source.Account)
+	if err != nil {
+		_ = c.Terminate()
+		return nil, fmt.Errorf("could not resolve imap credentials: %w", err)
+	}
+	defer creds.Wipe()
+
+	if err := c.Login(creds.Username, creds.Password.Reveal()); err != nil {
+		_ = c.Terminate()
+		return nil, fmt.Errorf("could not log in to imap server: %w", err)
+	}
+
+	return c, nil
+}
+
+func findIMAPCode(c *client.Client, folder, from string, pattern *regexp.Regexp, requestedAt time.Time) (string, error) {
+	if _, err := c.Select(folder, true); err != nil {
+		return "", fmt.Errorf("could not select imap folder %s: %w", folder, err)
+	}
+
+	criteria := imap.NewSearchCriteria()
+	// SINCE only compares dates in the server's timezone, the exact time is checked below
+	criteria.Since = requestedAt.AddDate(0, 0, -1)
+	criteria.Header.Add("From", from)
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return "", fmt.Errorf("could not search imap folder %s: %w", folder, err)
+	}
+	if len(uids) == 0 {
+		return "", nil
+	}
+
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uids...)
+	section := &imap.BodySectionName{Peek: true}
+
+	messages := make(chan *imap.Message, len(uids))
+	if err := c.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, imap.FetchInternalDate, section.FetchItem()}, messages); err != nil {
+		return "", fmt.Errorf("could not fetch imap messages: %w", err)
+	}
+
+	var found []*imap.Message
+	for msg := range messages {
+		if !msg.InternalDate.Before(requestedAt) {
+			found = append(found, msg)
+		}
+	}
+	slices.SortFunc(found, func(a, b *imap.Message) int {
+		return b.InternalDate.Compare(a.InternalDate)
+	})
+
+	for _, msg := range found {
+		body := msg.GetBody(section)
+		if body == nil {
+			continue
+		}
+		text, err := messageText(body)
+		if err != nil {
+			continue
+		}
+		if match := pattern.FindStringSubmatch(text); match != nil {
+			return match[len(match)-1], nil
+		}
+	}
+
+	return "", nil
+}
+
+// messageText returns the plain text parts of the message, or the html parts without tags when there are none.
+func messageText(r io.Reader) (string, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return "", err
+	}
+
+	var plain, html strings.Builder
+	if err := collectParts(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Body, &plain, &html); err != nil {
+		return "", err
+	}
+	if plain.Len() > 0 {
+		return plain.String(), nil
+	}
+	return htmlTagPattern.ReplaceAllString(html.String(), " "), nil
+}
+
+func collectParts(contentType, encoding string, body io.Reader, plain, html *strings.Builder) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := collectParts(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"), part, plain, html); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	switch mediaType {
+	case "text/plain":
+		plain.Write(data)
+	case "text/html":
+		html.Write(data)
+	}
+	return nil
+}
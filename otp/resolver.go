@@ -0,0 +1,144 @@
+package otp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+)
+
+var ErrDisabled = errors.New("otp is disabled")
+
+func ResolveOTP(ctx context.Context, chain config.OTPChain) (string, error) {
+	if len(chain) == 0 {
+		chain = config.OTPChain{{Stdin: &config.OTPStdin{}}}
+	}
+
+	errs := make([]error, 0, len(chain))
+	for _, source := range chain {
+		code, err := resolveSource(ctx, source)
+		if err == nil {
+			return code, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		errs = append(errs, err)
+	}
+
+	return "", errors.Join(errs...)
+}
+
+func resolveSource(ctx context.Context, source config.OTP) (string, error) {
+	switch true {
+	case source.Stdin != nil:
+		return resolveStdin(ctx, *source.Stdin)
+
+	case source.Webhook != nil:
+		return resolveWebhook(ctx, *source.Webhook)
+
+	case source.IMAP != nil:
+		return resolveIMAP(ctx, *source.IMAP)
+
+	case source.TOTP != nil:
+		return GenerateTOTP(source.TOTP.Secret, time.Now())
+
+	case source.None:
+		return "", ErrDisabled
+
+	default:
+		return "", fmt.Errorf("no otp source specified")
+	}
+}
+
+func resolveStdin(ctx context.Context, source config.OTPStdin) (string, error) {
+	prompt := source.Prompt
+	if prompt == "" {
+		prompt = "OTP Code: "
+	}
+
+	type result struct {
+		text string
+		err  error
+	}
+	ch := make(chan result, 1)
+
+	go func() {
+		os.Stdout.WriteString(prompt)
+		text, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		ch <- result{strings.TrimSpace(text), err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-ch:
+		if res.err != nil && res.text == "" {
+			return "", fmt.Errorf("reading otp code from stdin: %w", res.err)
+		}
+		return res.text, nil
+	}
+}
+
+func resolveWebhook(ctx context.Context, source config.OTPWebhook) (string, error) {
+	timeout := source.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	method := source.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, source.URL, nil)
+	if err != nil {
+		return "", fmt.Errorf("creating otp webhook request: %w", err)
+	}
+	for name, value := range source.Headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting otp webhook: %w", err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if err != nil {
+		return "", fmt.Errorf("reading otp webhook response: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("otp webhook responded with status %d", res.StatusCode)
+	}
+
+	text := strings.TrimSpace(string(body))
+	if strings.HasPrefix(text, "{") {
+		var payload struct {
+			Code string `json:"code"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return "", fmt.Errorf("decoding otp webhook response: %w", err)
+		}
+		text = strings.TrimSpace(payload.Code)
+	}
+
+	if text == "" {
+		return "", fmt.Errorf("otp webhook returned no code")
+	}
+
+	return text, nil
+}
@@ -0,0 +1,73 @@
+package otp
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"testing"
+	"time"
+)
+
+// the test vectors of RFC 6238 appendix B
+var totpVectors = []struct {
+	unix                 int64
+	sha1, sha256, sha512 string
+}{
+	{59, "94287082", "46119246", "90693936"},
+	{1111111109, "07081804", "68084774", "25091201"},
+	{1111111111, "14050471", "67062674", "99943326"},
+	{1234567890, "89005924", "91819424", "93441116"},
+	{2000000000, "69279037", "90698825", "38618901"},
+	{20000000000, "65353130", "77737706", "47863826"},
+}
+
+func TestTOTPVectors(t *testing.T) {
+	keys := []struct {
+		name    string
+		newHash func() hash.Hash
+		key     string
+		code    func(i int) string
+	}{
+		{"sha1", sha1.New, "12345678901234567890", func(i int) string { return totpVectors[i].sha1 }},
+		{"sha256", sha256.New, "12345678901234567890123456789012", func(i int) string { return totpVectors[i].sha256 }},
+		{"sha512", sha512.New, "1234567890123456789012345678901234567890123456789012345678901234", func(i int) string { return totpVectors[i].sha512 }},
+	}
+
+	for _, key := range keys {
+		for i, vector := range totpVectors {
+			got := totp([]byte(key.key), time.Unix(vector.unix, 0), key.newHash, 8)
+			if want := key.code(i); got != want {
+				t.Errorf("%s at %d: got %s, want %s", key.name, vector.unix, got, want)
+			}
+		}
+	}
+}
+
+func TestGenerateTOTP(t *testing.T) {
+	// base32 of the sha1 key of the rfc vectors, in the forms setup pages show it
+	secrets := []string{
+		"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		"gezd gnbv gy3t qojq gezd gnbv gy3t qojq",
+		"GEZD-GNBV-GY3T-QOJQ-GEZD-GNBV-GY3T-QOJQ",
+		"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ====",
+	}
+
+	for _, secret := range secrets {
+		for _, vector := range totpVectors {
+			got, err := GenerateTOTP(secret, time.Unix(vector.unix, 0))
+			if err != nil {
+				t.Fatalf("%q: %v", secret, err)
+			}
+			if want := vector.sha1[2:]; got != want {
+				t.Errorf("%q at %d: got %s, want %s", secret, vector.unix, got, want)
+			}
+		}
+	}
+
+	for _, secret := range []string{"", "====", "not base32!"} {
+		if _, err := GenerateTOTP(secret, time.Unix(59, 0)); err == nil {
+			t.Errorf("%q: want an error", secret)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type Outcome string
+
+const (
+	OutcomeRenewed           Outcome = "Renewed"
+	OutcomeWouldRenew        Outcome = "WouldRenew"
+	OutcomeSkippedNotDue     Outcome = "SkippedNotDue"
+	OutcomeSkippedCommercial Outcome = "SkippedCommercial"
+	OutcomeSkippedDisabled   Outcome = "SkippedDisabled"
+	OutcomeSkippedDeclined   Outcome = "SkippedDeclined"
+	OutcomeFailed            Outcome = "Failed"
+	// a renewal was due, but atlassian gives no more evaluations of the product
+	OutcomeBlockedByQuota Outcome = "BlockedByQuota"
+)
+
+func (o Outcome) Skipped() bool {
+	switch o {
+	case OutcomeSkippedNotDue, OutcomeSkippedCommercial, OutcomeSkippedDisabled, OutcomeSkippedDeclined:
+		return true
+	default:
+		return false
+	}
+}
+
+type FailureCategory string
+
+const (
+	FailureConfig         FailureCategory = "Config"
+	FailureLicenseDetails FailureCategory = "LicenseDetails"
+	FailureServerID       FailureCategory = "ServerID"
+	FailureLicenseKey     FailureCategory = "LicenseKey"
+	FailureUpdate         FailureCategory = "Update"
+	FailureBrowser        FailureCategory = "Browser"
+	FailureCanceled       FailureCategory = "Canceled"
+)
+
+type FailureError struct {
+	Category FailureCategory
+	Err      error
+}
+
+func (e *FailureError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *FailureError) Unwrap() error {
+	return e.Err
+}
+
+func Fail(category FailureCategory, err error) error {
+	return &FailureError{Category: category, Err: err}
+}
+
+type InstanceResult struct {
+	Instance string
+	BaseURL  string
+	Outcome  Outcome
+	Category FailureCategory
+	Decision string
+	Err      error
+	// the trial had already expired when the instance was processed
+	Expired bool
+
+	LicenseKey string
+	ExpiresAt  *time.Time
+	Changes    []FieldChange
+	// the licenses as they were read, before any renewal
+	Licenses []LicenseSummary
+	// the outcome of each application of an instance that has several, e.g. jira software and service management
+	Applications []ApplicationResult
+	// the status recorded by the previous run, empty on the first one
+	PreviousStatus string
+	// the instance has websudo disabled, its prompt was not waited for
+	WebSudoDisabled bool
+}
+
+type ApplicationResult struct {
+	Application string
+	Outcome     Outcome
+	Category    FailureCategory
+	Decision    string
+	Err         error
+	// the trial expiry before and after the renewal
+	PreviousExpiresAt *time.Time
+	ExpiresAt         *time.Time
+}
+
+func (r ApplicationResult) Status() string {
+	return InstanceResult{Outcome: r.Outcome, Category: r.Category}.Status()
+}
+
+type LicenseSummary struct {
+	Application    string     `json:"application,omitempty"`
+	SEN            string     `json:"sen,omitempty"`
+	LicenseType    string     `json:"licenseType,omitempty"`
+	TrialExpiresAt *time.Time `json:"trialExpiresAt,omitempty"`
+}
+
+func (r *InstanceResult) SetError(err error) {
+	if err == nil {
+		return
+	}
+
+	r.Outcome = OutcomeFailed
+	if blockedByQuota(err) {
+		r.Outcome = OutcomeBlockedByQuota
+	}
+	r.Err = err
+
+	var failure *FailureError
+	if errors.As(err, &failure) {
+		r.Category = failure.Category
+	}
+}
+
+func (r InstanceResult) Status() string {
+	status := string(r.Outcome)
+	if r.Outcome == OutcomeFailed && r.Category != "" {
+		status = fmt.Sprintf("%s:%s", r.Outcome, r.Category)
+	}
+	if r.Expired {
+		status += " (expired)"
+	}
+	return status
+}
+
+func (r InstanceResult) Failing() bool {
+	return r.Outcome == OutcomeFailed || r.Outcome == OutcomeBlockedByQuota
+}
+
+// Recovered reports whether the previous run of the instance failed and this one did not.
+func (r InstanceResult) Recovered() bool {
+	previous := Outcome(strings.TrimSuffix(r.PreviousStatus, " (expired)"))
+	if outcome, _, ok := strings.Cut(string(previous), ":"); ok {
+		previous = Outcome(outcome)
+	}
+	return !r.Failing() && r.Outcome != "" && (previous == OutcomeFailed || previous == OutcomeBlockedByQuota)
+}
+
+// blockedByQuota reports whether every error joined in err is an exhausted evaluation quota.
+func blockedByQuota(err error) bool {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			if !blockedByQuota(err) {
+				return false
+			}
+		}
+		return true
+	}
+	return EvaluationRefused(err)
+}
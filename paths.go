@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tarik02/jira-auto-trial/state"
+	"github.com/tarik02/jira-auto-trial/storage"
+)
+
+var dataDir = envOr("JIRA_AUTO_TRIAL_DATA_DIR", "./data")
+
+// storageURL selects where state, server ids, the audit log and run history are kept, the data dir when empty.
+var storageURL = os.Getenv("JIRA_AUTO_TRIAL_STORAGE")
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func DataPath(elem ...string) string {
+	return filepath.Join(append([]string{dataDir}, elem...)...)
+}
+
+var dataStorage struct {
+	sync.Mutex
+	url     string
+	backend storage.Backend
+}
+
+// DataStorage returns the storage backend, opened once per url so a memory backend is shared by the process.
+// Browser profiles, sessions, failure captures and instance logs stay in the data dir.
+func DataStorage() (storage.Backend, error) {
+	rawURL := storageURL
+	if rawURL == "" {
+		rawURL = dataDir
+	}
+
+	dataStorage.Lock()
+	defer dataStorage.Unlock()
+
+	if dataStorage.backend == nil || dataStorage.url != rawURL {
+		backend, err := storage.Open(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		dataStorage.url, dataStorage.backend = rawURL, backend
+	}
+	return dataStorage.backend, nil
+}
+
+func OpenState() (*state.Store, error) {
+	backend, err := DataStorage()
+	if err != nil {
+		return nil, err
+	}
+	return state.Open(backend, "state.json")
+}
+
+// OpenServerIDCache opens the cache shared by all runs, server ids are keyed by base url.
+func OpenServerIDCache() (*state.ServerIDCache, error) {
+	backend, err := DataStorage()
+	if err != nil {
+		return nil, err
+	}
+	return state.OpenServerIDCache(backend, "serverids.json")
+}
+
+func RegisterDataDirFlag(fs *flag.FlagSet) {
+	fs.Func("data-dir", "directory for browser profiles, state and run files (default "+dataDir+", env JIRA_AUTO_TRIAL_DATA_DIR)", func(value string) error {
+		dataDir = value
+		return nil
+	})
+	fs.Func("storage", "keep state, server ids, the audit log and run history in a directory, s3://bucket/prefix or memory:// (env JIRA_AUTO_TRIAL_STORAGE, default the data dir)", func(value string) error {
+		storageURL = value
+		return nil
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+)
+
+// HandlerNames are the page handlers playwright.handlerTimeouts can bound.
+var HandlerNames = []string{"login", "websudo", "expiredLicense", "atlassianLogin", "otp"}
+
+type playwrightTimeoutsKey struct{}
+
+// WithPlaywrightTimeouts makes the calls below use the configured timeouts of the config when they pass none.
+func WithPlaywrightTimeouts(ctx context.Context, cfg config.Playwright) context.Context {
+	return context.WithValue(ctx, playwrightTimeoutsKey{}, cfg)
+}
+
+func playwrightTimeouts(ctx context.Context) config.Playwright {
+	cfg, _ := ctx.Value(playwrightTimeoutsKey{}).(config.Playwright)
+	return cfg
+}
+
+// handlerContext bounds one run of the named page handler by its timeout, if it has one.
+func handlerContext(ctx context.Context, name string) (context.Context, context.CancelFunc) {
+	if timeout := playwrightTimeouts(ctx).HandlerTimeouts[name]; timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+func milliseconds(d time.Duration) *float64 {
+	if d <= 0 {
+		return nil
+	}
+	return playwright.Float(float64(d.Milliseconds()))
+}
+
+// CallTimeout converts the deadline of ctx into a playwright timeout in milliseconds, timeout is kept when it ends
+// earlier or ctx has no deadline. Without a timeout the action timeout of the config applies.
+func CallTimeout(ctx context.Context, timeout *float64) *float64 {
+	if timeout == nil {
+		timeout = milliseconds(playwrightTimeouts(ctx).ActionTimeout)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return timeout
+	}
+	// zero means no timeout to playwright
+	remaining := max(float64(time.Until(deadline).Milliseconds()), 1)
+	if timeout != nil && *timeout > 0 && *timeout < remaining {
+		return timeout
+	}
+	return playwright.Float(remaining)
+}
+
+// Await runs a playwright call and returns as soon as ctx is done. Playwright calls do not observe the context,
+// the abandoned call ends on its own when the page is closed or its timeout passes.
+func Await(ctx context.Context, call func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func Goto(ctx context.Context, page playwright.Page, url string, options ...playwright.PageGotoOptions) (playwright.Response, error) {
+	var opts playwright.PageGotoOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	if opts.Timeout == nil {
+		opts.Timeout = milliseconds(playwrightTimeouts(ctx).NavigationTimeout)
+	}
+	opts.Timeout = CallTimeout(ctx, opts.Timeout)
+
+	var response playwright.Response
+	err := Await(ctx, func() (err error) {
+		response, err = page.Goto(url, opts)
+		return err
+	})
+	return response, err
+}
+
+func WaitFor(ctx context.Context, locator playwright.Locator, options ...playwright.LocatorWaitForOptions) error {
+	var opts playwright.LocatorWaitForOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	opts.Timeout = CallTimeout(ctx, opts.Timeout)
+
+	return Await(ctx, func() error {
+		return locator.WaitFor(opts)
+	})
+}
+
+func Click(ctx context.Context, locator playwright.Locator, options ...playwright.LocatorClickOptions) error {
+	var opts playwright.LocatorClickOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	opts.Timeout = CallTimeout(ctx, opts.Timeout)
+
+	return Await(ctx, func() error {
+		return locator.Click(opts)
+	})
+}
+
+func Fill(ctx context.Context, locator playwright.Locator, value string, options ...playwright.LocatorFillOptions) error {
+	var opts playwright.LocatorFillOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	opts.Timeout = CallTimeout(ctx, opts.Timeout)
+
+	return Await(ctx, func() error {
+		return locator.Fill(value, opts)
+	})
+}
+
+func Check(ctx context.Context, locator playwright.Locator, options ...playwright.LocatorCheckOptions) error {
+	var opts playwright.LocatorCheckOptions
+	if len(options) > 0 {
+		opts = options[0]
+	}
+	opts.Timeout = CallTimeout(ctx, opts.Timeout)
+
+	return Await(ctx, func() error {
+		return locator.Check(opts)
+	})
+}
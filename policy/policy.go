@@ -0,0 +1,184 @@
+package policy
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/licenses"
+)
+
+const DefaultThresholdDays = 7
+
+type Kind string
+
+const (
+	KindRenew          Kind = "Renew"
+	KindExpired        Kind = "Expired"
+	KindNotDue         Kind = "NotDue"
+	KindLicenseType    Kind = "LicenseType"
+	KindCooldown       Kind = "Cooldown"
+	KindOutsideWindows Kind = "OutsideWindows"
+)
+
+type Input struct {
+	Now            time.Time
+	TrialExpiresAt *time.Time
+	// the license is known to have expired even though its expiry date could not be read
+	Expired       bool
+	LicenseClass  licenses.Class
+	LastRenewedAt *time.Time
+}
+
+type Decision struct {
+	Kind   Kind
+	Reason string
+}
+
+func (d Decision) Renew() bool {
+	return d.Kind == KindRenew || d.Kind == KindExpired
+}
+
+func (d Decision) String() string {
+	if d.Renew() {
+		return "renew because " + d.Reason
+	}
+	return "skip because " + d.Reason
+}
+
+type Policy struct {
+	ThresholdDays       int
+	AllowedLicenseTypes []licenses.Class
+	Cooldown            time.Duration
+	MaintenanceWindows  []Window
+	Force               bool
+}
+
+func New(cfg config.Policy) (*Policy, error) {
+	p := &Policy{
+		ThresholdDays:       DefaultThresholdDays,
+		AllowedLicenseTypes: []licenses.Class{licenses.ClassEvaluation, licenses.ClassTimebomb},
+	}
+
+	if cfg.ThresholdDays != nil {
+		p.ThresholdDays = *cfg.ThresholdDays
+	}
+
+	if cfg.AllowedLicenseTypes != nil {
+		p.AllowedLicenseTypes = make([]licenses.Class, 0, len(cfg.AllowedLicenseTypes))
+		for _, value := range cfg.AllowedLicenseTypes {
+			class, ok := licenses.ParseClass(value)
+			if !ok {
+				return nil, fmt.Errorf("unknown license type %q", value)
+			}
+			p.AllowedLicenseTypes = append(p.AllowedLicenseTypes, class)
+		}
+	}
+
+	if cfg.Cooldown != nil {
+		p.Cooldown = *cfg.Cooldown
+	}
+
+	for _, window := range cfg.MaintenanceWindows {
+		w, err := ParseWindow(window)
+		if err != nil {
+			return nil, err
+		}
+		p.MaintenanceWindows = append(p.MaintenanceWindows, w)
+	}
+
+	if cfg.Force != nil {
+		p.Force = *cfg.Force
+	}
+
+	return p, nil
+}
+
+func (p *Policy) Decide(input Input) Decision {
+	// force never replaces a license of a type that is not allowed, e.g. a commercial one
+	if input.LicenseClass != licenses.ClassUnknown && !p.allowsLicenseType(input.LicenseClass) {
+		return Decision{KindLicenseType, fmt.Sprintf("license type %s is not allowed (allowed: %s)", input.LicenseClass, p.allowedLicenseTypesString())}
+	}
+
+	if p.Force {
+		return Decision{KindRenew, "force is set"}
+	}
+
+	// an expired instance may already be read-only, it is renewed regardless of windows and cooldown
+	if input.TrialExpiresAt != nil && !input.TrialExpiresAt.After(input.Now) {
+		return Decision{KindExpired, fmt.Sprintf("trial expired %s ago", FormatDuration(input.Now.Sub(*input.TrialExpiresAt)))}
+	}
+	if input.Expired {
+		return Decision{KindExpired, "license has expired"}
+	}
+
+	if len(p.MaintenanceWindows) > 0 && !p.inMaintenanceWindow(input.Now) {
+		return Decision{KindOutsideWindows, fmt.Sprintf("%s is outside maintenance windows", input.Now.Format("Mon 15:04"))}
+	}
+
+	if p.Cooldown > 0 && input.LastRenewedAt != nil {
+		if since := input.Now.Sub(*input.LastRenewedAt); since < p.Cooldown {
+			return Decision{KindCooldown, fmt.Sprintf("last renewal %s ago is within cooldown %s", FormatDuration(since), FormatDuration(p.Cooldown))}
+		}
+	}
+
+	if input.TrialExpiresAt == nil {
+		return Decision{KindRenew, "trial expiry is unknown"}
+	}
+
+	threshold := input.Now.AddDate(0, 0, p.ThresholdDays)
+	daysLeft := DaysLeft(input.Now, *input.TrialExpiresAt)
+
+	if input.TrialExpiresAt.Before(threshold) {
+		return Decision{KindRenew, fmt.Sprintf("expires in %dd < threshold %dd", daysLeft, p.ThresholdDays)}
+	}
+
+	return Decision{KindNotDue, fmt.Sprintf("expires in %dd >= threshold %dd", daysLeft, p.ThresholdDays)}
+}
+
+func (p *Policy) allowsLicenseType(class licenses.Class) bool {
+	for _, allowed := range p.AllowedLicenseTypes {
+		if allowed == class {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) allowedLicenseTypesString() string {
+	names := make([]string, 0, len(p.AllowedLicenseTypes))
+	for _, class := range p.AllowedLicenseTypes {
+		names = append(names, string(class))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// RenewsAt reports whether a renewal due at t is allowed by the maintenance windows.
+func (p *Policy) RenewsAt(t time.Time) bool {
+	return p.Force || len(p.MaintenanceWindows) == 0 || p.inMaintenanceWindow(t)
+}
+
+func (p *Policy) inMaintenanceWindow(now time.Time) bool {
+	for _, window := range p.MaintenanceWindows {
+		if window.Contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func DaysLeft(now, expiresAt time.Time) int {
+	return int(math.Floor(expiresAt.Sub(now).Hours() / 24))
+}
+
+func FormatDuration(d time.Duration) string {
+	if d >= 48*time.Hour {
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	return d.Round(time.Minute).String()
+}
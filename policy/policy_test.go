@@ -0,0 +1,141 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/licenses"
+)
+
+func TestDecide(t *testing.T) {
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC) // a sunday
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	day := 24 * time.Hour
+
+	defaults := &Policy{ThresholdDays: 7, AllowedLicenseTypes: []licenses.Class{licenses.ClassEvaluation, licenses.ClassTimebomb}}
+	zero := &Policy{ThresholdDays: 0, AllowedLicenseTypes: defaults.AllowedLicenseTypes}
+	cooldown := &Policy{ThresholdDays: 7, AllowedLicenseTypes: defaults.AllowedLicenseTypes, Cooldown: day}
+	windows := &Policy{ThresholdDays: 7, AllowedLicenseTypes: defaults.AllowedLicenseTypes, MaintenanceWindows: []Window{{Start: 22 * time.Hour, End: 6 * time.Hour}}}
+	force := &Policy{ThresholdDays: 7, AllowedLicenseTypes: defaults.AllowedLicenseTypes, Force: true}
+
+	tests := []struct {
+		name   string
+		policy *Policy
+		input  Input
+		kind   Kind
+		reason string
+	}{
+		{"well before threshold", defaults, Input{TrialExpiresAt: at(30 * day)}, KindNotDue, "expires in 30d >= threshold 7d"},
+		{"exactly at threshold", defaults, Input{TrialExpiresAt: at(7 * day)}, KindNotDue, "expires in 7d >= threshold 7d"},
+		{"a minute inside threshold", defaults, Input{TrialExpiresAt: at(7*day - time.Minute)}, KindRenew, "expires in 6d < threshold 7d"},
+		{"a day left", defaults, Input{TrialExpiresAt: at(day)}, KindRenew, "expires in 1d < threshold 7d"},
+		{"less than a day left", defaults, Input{TrialExpiresAt: at(time.Hour)}, KindRenew, "expires in 0d < threshold 7d"},
+		{"expires now", defaults, Input{TrialExpiresAt: at(0)}, KindExpired, "trial expired 0s ago"},
+		{"expired an hour ago", defaults, Input{TrialExpiresAt: at(-time.Hour)}, KindExpired, "trial expired 1h0m0s ago"},
+		{"expired days ago", defaults, Input{TrialExpiresAt: at(-3 * day)}, KindExpired, "trial expired 3d ago"},
+		{"known expired without a date", defaults, Input{Expired: true}, KindExpired, "license has expired"},
+		{"unknown expiry", defaults, Input{}, KindRenew, "trial expiry is unknown"},
+		{"zero threshold before expiry", zero, Input{TrialExpiresAt: at(time.Hour)}, KindNotDue, "expires in 0d >= threshold 0d"},
+		{"zero threshold at expiry", zero, Input{TrialExpiresAt: at(0)}, KindExpired, "trial expired 0s ago"},
+		{"license type not allowed", defaults, Input{TrialExpiresAt: at(day), LicenseClass: licenses.ClassCommercial}, KindLicenseType, "license type Commercial is not allowed (allowed: Evaluation, Timebomb)"},
+		{"license type not allowed even expired", defaults, Input{TrialExpiresAt: at(-day), LicenseClass: licenses.ClassCommercial}, KindLicenseType, "license type Commercial is not allowed (allowed: Evaluation, Timebomb)"},
+		{"unknown license type", defaults, Input{TrialExpiresAt: at(day), LicenseClass: licenses.ClassUnknown}, KindRenew, "expires in 1d < threshold 7d"},
+		{"no license type allowed", &Policy{ThresholdDays: 7, AllowedLicenseTypes: []licenses.Class{}}, Input{LicenseClass: licenses.ClassEvaluation}, KindLicenseType, "license type Evaluation is not allowed (allowed: none)"},
+		{"within cooldown", cooldown, Input{TrialExpiresAt: at(day), LastRenewedAt: at(-time.Hour)}, KindCooldown, "last renewal 1h0m0s ago is within cooldown 24h0m0s"},
+		{"after cooldown", cooldown, Input{TrialExpiresAt: at(day), LastRenewedAt: at(-day)}, KindRenew, "expires in 1d < threshold 7d"},
+		{"expired within cooldown", cooldown, Input{TrialExpiresAt: at(-time.Minute), LastRenewedAt: at(-time.Hour)}, KindExpired, "trial expired 1m0s ago"},
+		{"outside windows", windows, Input{TrialExpiresAt: at(day)}, KindOutsideWindows, "Sun 12:00 is outside maintenance windows"},
+		{"expired outside windows", windows, Input{TrialExpiresAt: at(-day)}, KindExpired, "trial expired 24h0m0s ago"},
+		{"force", force, Input{TrialExpiresAt: at(30 * day)}, KindRenew, "force is set"},
+		{"force keeps a license type that is not allowed", force, Input{TrialExpiresAt: at(30 * day), LicenseClass: licenses.ClassCommercial}, KindLicenseType, "license type Commercial is not allowed (allowed: Evaluation, Timebomb)"},
+	}
+
+	for _, test := range tests {
+		test.input.Now = now
+		if test.input.LicenseClass == "" {
+			test.input.LicenseClass = licenses.ClassEvaluation
+		}
+		decision := test.policy.Decide(test.input)
+		if decision.Kind != test.kind || decision.Reason != test.reason {
+			t.Errorf("%s: got %s %q, want %s %q", test.name, decision.Kind, decision.Reason, test.kind, test.reason)
+		}
+		if renew := test.kind == KindRenew || test.kind == KindExpired; decision.Renew() != renew {
+			t.Errorf("%s: got Renew() %v", test.name, decision.Renew())
+		}
+	}
+}
+
+func TestDaysLeft(t *testing.T) {
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expiresAt time.Duration
+		want      int
+	}{
+		{0, 0},
+		{23 * time.Hour, 0},
+		{24 * time.Hour, 1},
+		{7*24*time.Hour - time.Second, 6},
+		{-time.Second, -1},
+		{-24 * time.Hour, -1},
+		{-25 * time.Hour, -2},
+	}
+	for _, test := range tests {
+		if got := DaysLeft(now, now.Add(test.expiresAt)); got != test.want {
+			t.Errorf("DaysLeft(%s): got %d, want %d", test.expiresAt, got, test.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{90 * time.Second, "2m0s"},
+		{47 * time.Hour, "47h0m0s"},
+		{48 * time.Hour, "2d"},
+		{71 * time.Hour, "2d"},
+		{30 * 24 * time.Hour, "30d"},
+	}
+	for _, test := range tests {
+		if got := FormatDuration(test.d); got != test.want {
+			t.Errorf("FormatDuration(%s): got %q, want %q", test.d, got, test.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	p, err := New(config.Policy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ThresholdDays != DefaultThresholdDays || len(p.AllowedLicenseTypes) != 2 || p.Force || p.Cooldown != 0 {
+		t.Errorf("got defaults %+v", p)
+	}
+
+	threshold, cooldown, force := 14, time.Hour, true
+	p, err = New(config.Policy{
+		ThresholdDays:       &threshold,
+		AllowedLicenseTypes: []string{"developer"},
+		Cooldown:            &cooldown,
+		MaintenanceWindows:  []config.MaintenanceWindow{{Days: []string{"Saturday"}, Start: "22:00", End: "06:00"}},
+		Force:               &force,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ThresholdDays != 14 || len(p.AllowedLicenseTypes) != 1 || p.AllowedLicenseTypes[0] != licenses.ClassDeveloper || p.Cooldown != time.Hour || !p.Force || len(p.MaintenanceWindows) != 1 {
+		t.Errorf("got %+v", p)
+	}
+
+	if _, err := New(config.Policy{AllowedLicenseTypes: []string{"free"}}); err == nil {
+		t.Errorf("unknown license type: want an error")
+	}
+	if _, err := New(config.Policy{MaintenanceWindows: []config.MaintenanceWindow{{Start: "25:00"}}}); err == nil {
+		t.Errorf("invalid window: want an error")
+	}
+}
@@ -0,0 +1,88 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+)
+
+type Window struct {
+	Days  map[time.Weekday]bool
+	Start time.Duration
+	End   time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func ParseWindow(cfg config.MaintenanceWindow) (Window, error) {
+	w := Window{}
+
+	if len(cfg.Days) > 0 {
+		w.Days = make(map[time.Weekday]bool, len(cfg.Days))
+		for _, day := range cfg.Days {
+			key := strings.ToLower(day)
+			if len(key) > 3 {
+				key = key[:3]
+			}
+			weekday, ok := weekdays[key]
+			if !ok {
+				return Window{}, fmt.Errorf("unknown maintenance window day %q", day)
+			}
+			w.Days[weekday] = true
+		}
+	}
+
+	var err error
+	if w.Start, err = parseClock(cfg.Start, 0); err != nil {
+		return Window{}, fmt.Errorf("invalid maintenance window start: %w", err)
+	}
+	if w.End, err = parseClock(cfg.End, 24*time.Hour); err != nil {
+		return Window{}, fmt.Errorf("invalid maintenance window end: %w", err)
+	}
+
+	return w, nil
+}
+
+func parseClock(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w Window) Contains(now time.Time) bool {
+	clock := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute
+
+	if w.Start <= w.End {
+		return w.dayMatches(now.Weekday()) && clock >= w.Start && clock < w.End
+	}
+
+	// window wraps around midnight, e.g. 22:00-06:00
+	if clock >= w.Start {
+		return w.dayMatches(now.Weekday())
+	}
+	if clock < w.End {
+		return w.dayMatches((now.Weekday() + 6) % 7)
+	}
+	return false
+}
+
+func (w Window) dayMatches(day time.Weekday) bool {
+	return len(w.Days) == 0 || w.Days[day]
+}
@@ -0,0 +1,122 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		cfg  config.MaintenanceWindow
+		want Window
+		err  bool
+	}{
+		{config.MaintenanceWindow{}, Window{Start: 0, End: 24 * time.Hour}, false},
+		{config.MaintenanceWindow{Start: "22:00", End: "06:30"}, Window{Start: 22 * time.Hour, End: 6*time.Hour + 30*time.Minute}, false},
+		{config.MaintenanceWindow{Days: []string{"Mon", "tuesday", "SAT"}}, Window{Days: map[time.Weekday]bool{time.Monday: true, time.Tuesday: true, time.Saturday: true}, End: 24 * time.Hour}, false},
+		{config.MaintenanceWindow{Days: []string{"someday"}}, Window{}, true},
+		{config.MaintenanceWindow{Start: "24:00"}, Window{}, true},
+		{config.MaintenanceWindow{End: "6pm"}, Window{}, true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseWindow(test.cfg)
+		if test.err {
+			if err == nil {
+				t.Errorf("%+v: want an error", test.cfg)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", test.cfg, err)
+			continue
+		}
+		if got.Start != test.want.Start || got.End != test.want.End || len(got.Days) != len(test.want.Days) {
+			t.Errorf("%+v: got %+v, want %+v", test.cfg, got, test.want)
+			continue
+		}
+		for day := range test.want.Days {
+			if !got.Days[day] {
+				t.Errorf("%+v: %s is missing", test.cfg, day)
+			}
+		}
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	// 2024-03-08 is a friday
+	at := func(day int, clock string) time.Time {
+		c, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return time.Date(2024, time.March, day, c.Hour(), c.Minute(), 59, 0, time.UTC)
+	}
+
+	daytime := Window{Start: 9 * time.Hour, End: 17 * time.Hour}
+	overnight := Window{Start: 22 * time.Hour, End: 6 * time.Hour}
+	fridayNight := Window{Days: map[time.Weekday]bool{time.Friday: true}, Start: 22 * time.Hour, End: 6 * time.Hour}
+	weekend := Window{Days: map[time.Weekday]bool{time.Saturday: true, time.Sunday: true}, End: 24 * time.Hour}
+	toMidnight := Window{Start: 20 * time.Hour, End: 24 * time.Hour}
+	fromMidnight := Window{Start: 0, End: 2 * time.Hour}
+
+	tests := []struct {
+		name   string
+		window Window
+		now    time.Time
+		want   bool
+	}{
+		{"daytime before", daytime, at(8, "08:59"), false},
+		{"daytime start", daytime, at(8, "09:00"), true},
+		{"daytime inside", daytime, at(8, "12:00"), true},
+		{"daytime end is exclusive", daytime, at(8, "17:00"), false},
+		{"overnight before start", overnight, at(8, "21:59"), false},
+		{"overnight start", overnight, at(8, "22:00"), true},
+		{"overnight before midnight", overnight, at(8, "23:59"), true},
+		{"overnight midnight", overnight, at(9, "00:00"), true},
+		{"overnight after midnight", overnight, at(9, "05:59"), true},
+		{"overnight end", overnight, at(9, "06:00"), false},
+		{"overnight noon", overnight, at(9, "12:00"), false},
+		{"friday night on friday", fridayNight, at(8, "23:00"), true},
+		{"friday night past midnight on saturday", fridayNight, at(9, "03:00"), true},
+		{"friday night past midnight on friday belongs to thursday", fridayNight, at(8, "03:00"), false},
+		{"friday night on saturday night", fridayNight, at(9, "23:00"), false},
+		{"friday night past midnight on sunday", fridayNight, at(10, "03:00"), false},
+		{"weekend on saturday", weekend, at(9, "00:00"), true},
+		{"weekend on sunday", weekend, at(10, "23:59"), true},
+		{"weekend on monday", weekend, at(11, "00:00"), false},
+		{"to midnight before", toMidnight, at(8, "19:59"), false},
+		{"to midnight last minute", toMidnight, at(8, "23:59"), true},
+		{"to midnight next day", toMidnight, at(9, "00:00"), false},
+		{"from midnight", fromMidnight, at(9, "00:00"), true},
+		{"from midnight end", fromMidnight, at(9, "02:00"), false},
+	}
+
+	for _, test := range tests {
+		if got := test.window.Contains(test.now); got != test.want {
+			t.Errorf("%s: Contains(%s) got %v, want %v", test.name, test.now.Format("Mon 15:04"), got, test.want)
+		}
+	}
+}
+
+func TestRenewsAt(t *testing.T) {
+	saturday := time.Date(2024, time.March, 9, 3, 0, 0, 0, time.UTC)
+	windows := []Window{{Days: map[time.Weekday]bool{time.Friday: true}, Start: 22 * time.Hour, End: 6 * time.Hour}}
+
+	tests := []struct {
+		policy Policy
+		want   bool
+	}{
+		{Policy{}, true},
+		{Policy{MaintenanceWindows: windows}, true},
+		{Policy{MaintenanceWindows: []Window{{Start: 9 * time.Hour, End: 17 * time.Hour}}}, false},
+		{Policy{MaintenanceWindows: []Window{{Start: 9 * time.Hour, End: 17 * time.Hour}}, Force: true}, true},
+	}
+	for i, test := range tests {
+		if got := test.policy.RenewsAt(saturday); got != test.want {
+			t.Errorf("%d: got %v, want %v", i, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/credentials"
+	"github.com/tarik02/jira-auto-trial/licenses"
+	"github.com/tarik02/jira-auto-trial/policy"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+)
+
+type ApplicationLicense struct {
+	ApplicationKey string
+	Details        ResolveLicenseDetailsResult
+}
+
+// RESTClient calls instance REST endpoints with basic auth of the instance account, or its personal access token.
+type RESTClient struct {
+	HTTP        *http.Client
+	BaseURL     string
+	Credentials *credentials.Credentials
+}
+
+func (c *RESTClient) GetJSON(ctx context.Context, path string, v any) error {
+	return c.Do(ctx, http.MethodGet, path, nil, v)
+}
+
+// Do sends body as json and decodes the response into v, both may be nil.
+func (c *RESTClient) Do(ctx context.Context, method, path string, body, v any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Atlassian-Token", "no-check")
+	}
+	if !c.Credentials.Token.Empty() {
+		req.Header.Set("Authorization", "Bearer "+c.Credentials.Token.Reveal())
+	} else {
+		req.SetBasicAuth(c.Credentials.Username, c.Credentials.Password.Reveal())
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// redirects usually lead to a login or websudo page
+	if res.StatusCode < 200 || res.StatusCode >= 300 || (v != nil && res.StatusCode == http.StatusNoContent) {
+		return fmt.Errorf("%s %s: %s", method, path, res.Status)
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+type PrecheckParams struct {
+	Instance      config.JiraInstance
+	Policy        *policy.Policy
+	LastRenewedAt *time.Time
+	HTTP          *http.Client
+}
+
+// PrecheckInstance reads the license over REST and returns the result of an instance that needs no browser,
+// nil when a renewal is due or the license could not be read this way.
+func PrecheckInstance(ctx context.Context, log *zap.Logger, params PrecheckParams) *InstanceResult {
+	instance := params.Instance
+	result := &InstanceResult{Instance: InstanceName(instance)}
+
+	if instance.Disabled {
+		result.Outcome = OutcomeSkippedDisabled
+		return result
+	}
+
+	product, err := InstanceProduct(instance)
+	if err != nil || product.ReadLicenses == nil {
+		return nil
+	}
+
+	creds, err := credentials.ResolveCredentials(ctx, instance.Account)
+	if err != nil {
+		log.Debug("precheck: could not resolve credentials", zap.Error(err))
+		return nil
+	}
+	defer creds.Wipe()
+
+	applications, err := product.ReadLicenses(ctx, &RESTClient{
+		HTTP:        params.HTTP,
+		BaseURL:     NavigationBaseURL(instance),
+		Credentials: creds,
+	})
+	if err != nil {
+		log.Debug("precheck: could not read licenses", zap.Error(err))
+		return nil
+	}
+	if len(applications) == 0 {
+		return nil
+	}
+
+	decisions := make([]string, 0, len(applications))
+	outcomes := make([]Outcome, 0, len(applications))
+	for _, application := range applications {
+		details := application.Details
+		decision := params.Policy.Decide(policy.Input{
+			Now:            time.Now(),
+			TrialExpiresAt: details.TrialExpiresAt,
+			LicenseClass:   licenses.Classify(details.LicenseType),
+			LastRenewedAt:  params.LastRenewedAt,
+		})
+
+		switch decision.Kind {
+		case policy.KindRenew, policy.KindExpired:
+			return nil
+		case policy.KindLicenseType:
+			outcomes = append(outcomes, OutcomeSkippedCommercial)
+		default:
+			outcomes = append(outcomes, OutcomeSkippedNotDue)
+		}
+
+		if len(applications) > 1 {
+			decisions = append(decisions, application.ApplicationKey+": "+decision.String())
+		} else {
+			decisions = append(decisions, decision.String())
+		}
+		if details.TrialExpiresAt != nil && (result.ExpiresAt == nil || details.TrialExpiresAt.Before(*result.ExpiresAt)) {
+			result.ExpiresAt = details.TrialExpiresAt
+		}
+		result.Licenses = append(result.Licenses, LicenseSummary{
+			Application:    application.ApplicationKey,
+			SEN:            details.SEN,
+			LicenseType:    details.LicenseType,
+			TrialExpiresAt: details.TrialExpiresAt,
+		})
+	}
+
+	result.Decision = strings.Join(decisions, "; ")
+	result.Outcome = OutcomeSkippedNotDue
+	if !slices.ContainsFunc(outcomes, func(outcome Outcome) bool { return outcome != OutcomeSkippedCommercial }) {
+		result.Outcome = OutcomeSkippedCommercial
+	}
+	return result
+}
+
+// Precheck reads the licenses of all instances concurrently, instances without a result go through the browser.
+func Precheck(ctx context.Context, log *zap.Logger, cfg *config.Config, lastRenewedAt func(instance config.JiraInstance) *time.Time) []*InstanceResult {
+	parallel := cfg.Precheck.Parallel
+	if parallel <= 0 {
+		parallel = 16
+	}
+	timeout := cfg.Precheck.Timeout
+	if timeout <= 0 {
+		timeout = 20 * time.Second
+	}
+
+	client := NewRESTHTTPClient(timeout)
+
+	results := make([]*InstanceResult, len(cfg.Instances))
+
+	var g errgroup.Group
+	g.SetLimit(parallel)
+	for i, instance := range cfg.Instances {
+		g.Go(func() error {
+			instancePolicy, err := policy.New(cfg.InstancePolicy(instance))
+			if err != nil {
+				return nil
+			}
+
+			results[i] = PrecheckInstance(ctx, log.With(zap.String("instance", InstanceName(instance))), PrecheckParams{
+				Instance:      instance,
+				Policy:        instancePolicy,
+				LastRenewedAt: lastRenewedAt(instance),
+				HTTP:          client,
+			})
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return results
+}
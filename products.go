@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+	"golang.org/x/sync/errgroup"
+)
+
+type Application struct {
+	Key string
+
+	// option of the product select and data attribute of the data center row on my.atlassian.com
+	EvaluationProduct string
+	EvaluationEdition string
+}
+
+type Product struct {
+	Name string
+
+	EvaluationProduct string
+	EvaluationEdition string
+
+	// nil for products licensed as a whole
+	ListApplications func(ctx context.Context, page playwright.Page, baseURL string) ([]Application, error)
+
+	StartHandlers         func(ctx context.Context, g *errgroup.Group, page playwright.Page, account config.Account)
+	ResolveServerID       func(ctx context.Context, page playwright.Page, params ResolveServerIDParams) (string, error)
+	ResolveLicenseDetails func(ctx context.Context, page playwright.Page, params ResolveLicenseDetailsParams) (*ResolveLicenseDetailsResult, error)
+	UpdateLicenseKey      func(ctx context.Context, page playwright.Page, params UpdateLicenseKeyParams) error
+
+	// nil when the license can only be read in the browser
+	ReadLicenses func(ctx context.Context, client *RESTClient) ([]ApplicationLicense, error)
+	// used instead of the browser with preferREST, nil when the product has no such endpoints
+	ListApplicationsREST func(ctx context.Context, client *RESTClient) ([]Application, error)
+	ResolveServerIDREST  func(ctx context.Context, client *RESTClient) (string, error)
+	// used by accounts with a personal access token, which cannot log in to the browser
+	UpdateLicenseKeyREST func(ctx context.Context, client *RESTClient, params UpdateLicenseKeyParams) error
+	// sends the request of the update form directly, nil when there is no such fallback
+	UpdateLicenseKeyRequest func(ctx context.Context, page playwright.Page, params UpdateLicenseKeyParams) error
+}
+
+var products = map[string]*Product{
+	"jira": {
+		Name:                  "jira",
+		EvaluationProduct:     "Jira",
+		EvaluationEdition:     "jira-software.data-center",
+		ListApplications:      ListJiraApplications,
+		StartHandlers:         StartJiraHandlers,
+		ResolveServerID:       ResolveServerID,
+		ResolveLicenseDetails: ResolveLicenseDetails,
+		UpdateLicenseKey:      UpdateJiraLicenseKey,
+		ReadLicenses:          ReadJiraLicenses,
+		ListApplicationsREST:  ListJiraApplicationsREST,
+		ResolveServerIDREST:   ResolveJiraServerIDREST,
+		UpdateLicenseKeyREST:  UpdateJiraLicenseKeyREST,
+
+		UpdateLicenseKeyRequest: UpdateJiraLicenseKeyRequest,
+	},
+	"confluence": {
+		Name:                  "confluence",
+		EvaluationProduct:     "Confluence",
+		EvaluationEdition:     "confluence.data-center",
+		StartHandlers:         StartConfluenceHandlers,
+		ResolveServerID:       ResolveConfluenceServerID,
+		ResolveLicenseDetails: ResolveConfluenceLicenseDetails,
+		UpdateLicenseKey:      UpdateConfluenceLicenseKey,
+	},
+	"bitbucket": {
+		Name:                  "bitbucket",
+		EvaluationProduct:     "Bitbucket",
+		EvaluationEdition:     "bitbucket.data-center",
+		StartHandlers:         StartBitbucketHandlers,
+		ResolveServerID:       ResolveBitbucketServerID,
+		ResolveLicenseDetails: ResolveBitbucketLicenseDetails,
+		UpdateLicenseKey:      UpdateBitbucketLicenseKey,
+
+		UpdateLicenseKeyRequest: UpdateBitbucketLicenseKeyRequest,
+	},
+}
+
+// MapApplications applies the evaluation product and edition configured for application keys of an instance,
+// for add-on applications the product does not know.
+func MapApplications(applications []Application, mappings map[string]config.ApplicationMapping) []Application {
+	for i, application := range applications {
+		mapping, ok := mappings[application.Key]
+		if !ok {
+			continue
+		}
+		if mapping.EvaluationProduct != "" {
+			applications[i].EvaluationProduct = mapping.EvaluationProduct
+		}
+		if mapping.EvaluationEdition != "" {
+			applications[i].EvaluationEdition = mapping.EvaluationEdition
+		}
+	}
+	return applications
+}
+
+// LicenseField finds the value next to a label in the table or definition list based license admin pages.
+func LicenseField(page playwright.Page, label string) playwright.Locator {
+	return page.Locator(fmt.Sprintf(
+		`//tr[normalize-space(th)="%[1]s" or normalize-space(td[1])="%[1]s"]/td[last()] | //dt[normalize-space()="%[1]s"]/following-sibling::dd[1]`,
+		label,
+	)).First()
+}
+
+// sendLicenseRequest sends a license update with the cookies of the logged in page.
+func sendLicenseRequest(page playwright.Page, method, url string, data any) error {
+	res, err := page.Request().Fetch(url, playwright.APIRequestContextFetchOptions{
+		Method: playwright.String(method),
+		Headers: map[string]string{
+			"Accept":            "application/json",
+			"X-Atlassian-Token": "no-check",
+		},
+		Data:             data,
+		MaxRedirects:     playwright.Int(0),
+		FailOnStatusCode: playwright.Bool(false),
+	})
+	if err != nil {
+		return err
+	}
+	defer res.Dispose()
+
+	if !res.Ok() {
+		body, _ := res.Text()
+		if len(body) > 200 {
+			body = body[:200]
+		}
+		return fmt.Errorf("%s %s: %d %s: %s", method, url, res.Status(), res.StatusText(), body)
+	}
+	return nil
+}
+
+func InstanceProduct(instance config.JiraInstance) (*Product, error) {
+	name := instance.Product
+	if name == "" {
+		name = "jira"
+	}
+
+	product, ok := products[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown product: %s", instance.Product)
+	}
+	return product, nil
+}
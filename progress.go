@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+func OutcomeIcon(outcome Outcome) string {
+	switch {
+	case outcome == OutcomeRenewed:
+		return "✅"
+	case outcome == OutcomeWouldRenew:
+		return "🔎"
+	case outcome.Skipped():
+		return "⏭️"
+	case outcome == OutcomeFailed:
+		return "❌"
+	case outcome == OutcomeBlockedByQuota:
+		return "⛔"
+	default:
+		return "❔"
+	}
+}
+
+func PrintProgress(w io.Writer, index, total int, result InstanceResult) {
+	detail := result.Decision
+	if result.Err != nil {
+		detail = result.Err.Error()
+	}
+
+	fmt.Fprintf(w, "%s [%d/%d] %s  %s", OutcomeIcon(result.Outcome), index, total, result.Instance, result.Status())
+	if detail != "" {
+		fmt.Fprintf(w, "  %s", detail)
+	}
+	fmt.Fprintln(w)
+}
+
+// PrintSummary prints the counts of a run and the reason of every instance, failed instances first.
+func PrintSummary(w io.Writer, summary RunSummary) error {
+	fmt.Fprintf(w, "\n%s: %d renewed, %d skipped, %d failed", summary.Title, summary.Count(OutcomeRenewed), summary.Skipped(), summary.Count(OutcomeFailed))
+	if blocked := summary.Count(OutcomeBlockedByQuota); blocked > 0 {
+		fmt.Fprintf(w, ", %d blocked by quota", blocked)
+	}
+	if wouldRenew := summary.Count(OutcomeWouldRenew); wouldRenew > 0 {
+		fmt.Fprintf(w, ", %d would renew", wouldRenew)
+	}
+	if summary.Err != nil {
+		fmt.Fprintf(w, ", run failed: %s", summary.Err)
+	}
+	fmt.Fprintln(w)
+	if summary.EvaluationLimit() != nil {
+		fmt.Fprintln(w, "the Atlassian account reached its evaluation limit, the remaining renewals were skipped")
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, failedFirst := range []bool{true, false} {
+		for _, result := range summary.Results {
+			if (result.Outcome == OutcomeFailed || result.Outcome == OutcomeBlockedByQuota) != failedFirst {
+				continue
+			}
+			reason := result.Decision
+			if result.Err != nil {
+				reason = result.Err.Error()
+			}
+			fmt.Fprintf(tw, "%s %s\t%s\t%s\n", OutcomeIcon(result.Outcome), result.Instance, result.Status(), reason)
+			for _, line := range ApplicationLines(result) {
+				fmt.Fprintf(tw, "    %s\n", line)
+			}
+		}
+	}
+	return tw.Flush()
+}
+
+// ApplicationLines describes each application of an instance that has several, with its expiry before and after.
+func ApplicationLines(result InstanceResult) []string {
+	if len(result.Applications) < 2 {
+		return nil
+	}
+
+	lines := make([]string, 0, len(result.Applications))
+	for _, application := range result.Applications {
+		line := fmt.Sprintf("%s %s: %s", OutcomeIcon(application.Outcome), application.Application, application.Status())
+		switch {
+		case application.PreviousExpiresAt != nil && application.ExpiresAt != nil && !application.PreviousExpiresAt.Equal(*application.ExpiresAt):
+			line += fmt.Sprintf(", expires %s -> %s", FormatDate(*application.PreviousExpiresAt), FormatDate(*application.ExpiresAt))
+		case application.ExpiresAt != nil:
+			line += fmt.Sprintf(", expires %s", FormatDate(*application.ExpiresAt))
+		}
+		if application.Err != nil {
+			line += " - " + application.Err.Error()
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
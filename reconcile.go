@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type ReconciledInstance struct {
+	BaseURL  string `json:"baseURL"`
+	ServerID string `json:"serverId,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type ReconciledMatch struct {
+	Instance ReconciledInstance `json:"instance"`
+	License  AtlassianLicense   `json:"license"`
+}
+
+type ReconciliationReport struct {
+	Matched []ReconciledMatch    `json:"matched"`
+	Orphans []AtlassianLicense   `json:"orphans"`
+	Gaps    []ReconciledInstance `json:"gaps"`
+}
+
+func Reconcile(instances []ReconciledInstance, licenses []AtlassianLicense) *ReconciliationReport {
+	report := &ReconciliationReport{
+		Matched: []ReconciledMatch{},
+		Orphans: []AtlassianLicense{},
+		Gaps:    []ReconciledInstance{},
+	}
+
+	// several instances may share a server id, e.g. a restored backup, each of them is reported
+	byServerID := make(map[string][]ReconciledInstance, len(instances))
+	matched := make(map[string]bool, len(instances))
+	for _, instance := range instances {
+		if instance.ServerID != "" {
+			serverID := normalizeServerID(instance.ServerID)
+			byServerID[serverID] = append(byServerID[serverID], instance)
+		}
+	}
+
+	for _, license := range licenses {
+		if !license.Evaluation {
+			continue
+		}
+
+		serverID := normalizeServerID(license.ServerID)
+		matches, ok := byServerID[serverID]
+		if !ok {
+			report.Orphans = append(report.Orphans, license)
+			continue
+		}
+		for _, instance := range matches {
+			report.Matched = append(report.Matched, ReconciledMatch{
+				Instance: instance,
+				License:  license,
+			})
+		}
+		matched[serverID] = true
+	}
+
+	for _, instance := range instances {
+		if instance.ServerID == "" || !matched[normalizeServerID(instance.ServerID)] {
+			report.Gaps = append(report.Gaps, instance)
+		}
+	}
+
+	return report
+}
+
+func normalizeServerID(serverID string) string {
+	return strings.ToUpper(strings.TrimSpace(serverID))
+}
+
+func WriteReconciliationText(w io.Writer, report *ReconciliationReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "STATUS\tINSTANCE\tSERVER ID\tPRODUCT\tSEN\tEXPIRES\n")
+
+	for _, match := range report.Matched {
+		fmt.Fprintf(tw, "matched\t%s\t%s\t%s\t%s\t%s\n", match.Instance.BaseURL, match.Instance.ServerID, match.License.Product, match.License.SEN, formatDate(match.License.ExpiresAt))
+	}
+
+	for _, license := range report.Orphans {
+		fmt.Fprintf(tw, "orphan\t-\t%s\t%s\t%s\t%s\n", license.ServerID, license.Product, license.SEN, formatDate(license.ExpiresAt))
+	}
+
+	for _, instance := range report.Gaps {
+		serverID := instance.ServerID
+		if instance.Error != "" {
+			serverID = "error: " + instance.Error
+		}
+		fmt.Fprintf(tw, "gap\t%s\t%s\t-\t-\t-\n", instance.BaseURL, serverID)
+	}
+
+	return tw.Flush()
+}
+
+func formatDate(date *time.Time) string {
+	if date == nil {
+		return "-"
+	}
+	return FormatDate(*date)
+}
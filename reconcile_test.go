@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReconcile(t *testing.T) {
+	expiresAt := time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+
+	jira := ReconciledInstance{BaseURL: "https://jira.example.com", ServerID: "ABCD-1234-EFGH-5678"}
+	// restored from a backup of jira, so it has the same server id
+	jiraCopy := ReconciledInstance{BaseURL: "https://jira-staging.example.com", ServerID: " abcd-1234-efgh-5678 "}
+	confluence := ReconciledInstance{BaseURL: "https://confluence.example.com", ServerID: "BCDE-2345-FGHI-6789"}
+	unreachable := ReconciledInstance{BaseURL: "https://down.example.com", Error: "could not connect"}
+
+	jiraLicense := AtlassianLicense{Product: "Jira Software", SEN: "SEN-1", ServerID: "ABCD-1234-EFGH-5678", ExpiresAt: &expiresAt, Evaluation: true}
+	orphanLicense := AtlassianLicense{Product: "Jira Software", SEN: "SEN-2", ServerID: "ZZZZ-0000-ZZZZ-0000", Evaluation: true}
+	commercialLicense := AtlassianLicense{Product: "Confluence", SEN: "SEN-3", ServerID: "BCDE-2345-FGHI-6789"}
+
+	report := Reconcile(
+		[]ReconciledInstance{jira, jiraCopy, confluence, unreachable},
+		[]AtlassianLicense{jiraLicense, orphanLicense, commercialLicense},
+	)
+
+	want := &ReconciliationReport{
+		Matched: []ReconciledMatch{
+			{Instance: jira, License: jiraLicense},
+			{Instance: jiraCopy, License: jiraLicense},
+		},
+		Orphans: []AtlassianLicense{orphanLicense},
+		Gaps:    []ReconciledInstance{confluence, unreachable},
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("got %+v, want %+v", report, want)
+	}
+
+	var b strings.Builder
+	if err := WriteReconciliationText(&b, report); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 6 {
+		t.Fatalf("got %d lines, want a header and 5 rows:\n%s", len(lines), b.String())
+	}
+	for i, status := range []string{"STATUS", "matched", "matched", "orphan", "gap", "gap"} {
+		if !strings.HasPrefix(lines[i], status+" ") {
+			t.Errorf("line %d: got %q, want %s", i, lines[i], status)
+		}
+	}
+	if !strings.Contains(lines[5], "error: could not connect") {
+		t.Errorf("got %q, want the error of the instance", lines[5])
+	}
+}
+
+func TestReconcileEmpty(t *testing.T) {
+	report := Reconcile(nil, nil)
+	if report.Matched == nil || report.Orphans == nil || report.Gaps == nil {
+		t.Errorf("got nil lists in %+v, they are encoded as null", report)
+	}
+}
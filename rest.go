@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"go.uber.org/zap"
+)
+
+// NewRESTHTTPClient does not follow redirects, they usually lead to a login or websudo page.
+func NewRESTHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// PreferREST returns a copy of the product that lists applications, reads license details and resolves the
+// server id over REST, falling back to the browser when a request fails. License updates still use the browser,
+// unless the client authenticates with a personal access token, which also has no browser fallback.
+func PreferREST(product *Product, log *zap.Logger, client *RESTClient) *Product {
+	if !client.Credentials.Token.Empty() {
+		return restOnly(product, client)
+	}
+
+	p := *product
+
+	if product.ListApplications != nil && product.ListApplicationsREST != nil {
+		p.ListApplications = func(ctx context.Context, page playwright.Page, baseURL string) ([]Application, error) {
+			applications, err := product.ListApplicationsREST(ctx, client)
+			if err == nil && len(applications) > 0 {
+				return applications, nil
+			}
+			log.Warn("could not list applications over rest, using the browser", zap.Error(err))
+			return product.ListApplications(ctx, page, baseURL)
+		}
+	}
+
+	if product.ReadLicenses != nil {
+		p.ResolveLicenseDetails = func(ctx context.Context, page playwright.Page, params ResolveLicenseDetailsParams) (*ResolveLicenseDetailsResult, error) {
+			details, err := readLicenseDetailsREST(ctx, product, client, params.ApplicationKey)
+			if err == nil {
+				return details, nil
+			}
+			log.Warn("could not read license details over rest, using the browser", zap.Error(err))
+			return product.ResolveLicenseDetails(ctx, page, params)
+		}
+	}
+
+	if product.ResolveServerIDREST != nil {
+		p.ResolveServerID = func(ctx context.Context, page playwright.Page, params ResolveServerIDParams) (string, error) {
+			serverID, err := product.ResolveServerIDREST(ctx, client)
+			if err == nil {
+				return serverID, nil
+			}
+			log.Warn("could not resolve server id over rest, using the browser", zap.Error(err))
+			return product.ResolveServerID(ctx, page, params)
+		}
+	}
+
+	return &p
+}
+
+func readLicenseDetailsREST(ctx context.Context, product *Product, client *RESTClient, applicationKey string) (*ResolveLicenseDetailsResult, error) {
+	applications, err := product.ReadLicenses(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, application := range applications {
+		if application.ApplicationKey == applicationKey || (applicationKey == "" && len(applications) == 1) {
+			details := application.Details
+			return &details, nil
+		}
+	}
+	return nil, fmt.Errorf("no license of application %q", applicationKey)
+}
+
+func restOnly(product *Product, client *RESTClient) *Product {
+	p := *product
+
+	unsupported := func(what string) error {
+		return fmt.Errorf("%s cannot %s with a personal access token", product.Name, what)
+	}
+
+	if product.ListApplications != nil {
+		p.ListApplications = func(ctx context.Context, page playwright.Page, baseURL string) ([]Application, error) {
+			if product.ListApplicationsREST == nil {
+				return nil, unsupported("list applications")
+			}
+			return product.ListApplicationsREST(ctx, client)
+		}
+	}
+	p.ResolveLicenseDetails = func(ctx context.Context, page playwright.Page, params ResolveLicenseDetailsParams) (*ResolveLicenseDetailsResult, error) {
+		if product.ReadLicenses == nil {
+			return nil, unsupported("read license details")
+		}
+		return readLicenseDetailsREST(ctx, product, client, params.ApplicationKey)
+	}
+	p.ResolveServerID = func(ctx context.Context, page playwright.Page, params ResolveServerIDParams) (string, error) {
+		if product.ResolveServerIDREST == nil {
+			return "", unsupported("resolve the server id")
+		}
+		return product.ResolveServerIDREST(ctx, client)
+	}
+	p.UpdateLicenseKey = func(ctx context.Context, page playwright.Page, params UpdateLicenseKeyParams) error {
+		if product.UpdateLicenseKeyREST == nil {
+			return unsupported("update the license key")
+		}
+		return product.UpdateLicenseKeyREST(ctx, client, params)
+	}
+	p.UpdateLicenseKeyRequest = nil
+
+	return &p
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// ErrLoginFailed is returned when an instance rejects the configured credentials.
+var ErrLoginFailed = errors.New("login error")
+
+const maxRetryDelay = 10 * time.Minute
+
+// IsTransient reports whether retrying may help: timeouts, failed navigations and atlassian being unavailable.
+// Rejected credentials and config errors are permanent.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, ErrLoginFailed) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var failure *FailureError
+	if errors.As(err, &failure) && failure.Category == FailureConfig {
+		return false
+	}
+
+	if errors.Is(err, playwright.ErrTimeout) || errors.Is(err, ErrAtlassianUnavailable) {
+		return true
+	}
+
+	message := err.Error()
+	return strings.Contains(message, "net::ERR_") || strings.Contains(message, "NS_ERROR_") || strings.Contains(message, "could not navigate")
+}
+
+// RetryDelay doubles base for every previous retry.
+func RetryDelay(base time.Duration, retry int) time.Duration {
+	delay := base
+	for i := 0; i < retry && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+)
+
+func NewRunID() string {
+	var buf [4]byte
+	_, _ = rand.Read(buf[:])
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(buf[:])
+}
+
+func InstanceName(instance config.JiraInstance) string {
+	if instance.Name != "" {
+		return instance.Name
+	}
+	return InstanceHost(instance)
+}
+
+func InstanceHost(instance config.JiraInstance) string {
+	if u, err := url.Parse(instance.BaseURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return instance.BaseURL
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/policy"
+	"go.uber.org/zap"
+)
+
+func runCommand() *Command {
+	cmd := &Command{
+		Name:  "run",
+		Usage: "jira-auto-trial run [-profile names] [-only names] [-skip names] [-tag tags] [-verbose] [-force] [-no-persist-keys] [-dry-run] [-refresh-server-ids] [-confirm] [-events ndjson] [-fail-on expiring:days]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		var options RunOptions
+
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		filter := RegisterFilterFlags(fs)
+		failOn := RegisterFailOnFlag(fs)
+		fs.BoolVar(&options.Force, "force", false, "renew all instances regardless of policy")
+		fs.BoolVar(&options.Verbose, "verbose", false, "show detailed logs instead of one progress line per instance")
+		fs.BoolVar(&options.InstanceLogs, "instance-logs", false, "also write each instance's logs to data/runs/<run id>/instances")
+		fs.BoolVar(&options.NoPersistKeys, "no-persist-keys", false, "never write license keys to logs or state, only their hashes")
+		fs.BoolVar(&options.DryRun, "dry-run", false, "resolve license details and server ids and report what would be renewed, without renewing")
+		fs.BoolVar(&options.RefreshServerIDs, "refresh-server-ids", false, "resolve the server ids again instead of using the ones cached in data/serverids.json")
+		eventsFormat := fs.String("events", "", "stream run events to stdout: ndjson")
+		confirm := fs.Bool("confirm", false, "print the decision and ask y/N before each renewal")
+		confirmTimeout := fs.Duration("confirm-timeout", time.Minute, "decline a renewal when -confirm gets no answer within this time")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if *confirm {
+			options.Confirm = &Confirmer{In: os.Stdin, Out: os.Stderr, Timeout: *confirmTimeout}
+		}
+		if fs.NArg() > 0 {
+			cmd.PrintUsage()
+			return fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+		}
+
+		annotations := io.Writer(os.Stdout)
+		switch *eventsFormat {
+		case "":
+		case "ndjson":
+			options.Events = NDJSONEventSink(os.Stdout)
+			annotations = os.Stderr
+		default:
+			return fmt.Errorf("unknown events format: %s", *eventsFormat)
+		}
+
+		cfgs, err := configFlags.LoadAll()
+		if err != nil {
+			return err
+		}
+		if cfgs, err = filter.Apply(cfgs); err != nil {
+			return err
+		}
+
+		results, err := runConfigs(ctx, log, cfgs, options, annotations)
+		if err == nil || errors.Is(err, ErrInstancesFailed) {
+			err = errors.Join(err, failOn.Check(results, time.Now()))
+		}
+		return err
+	}
+
+	return cmd
+}
+
+func checkCommand() *Command {
+	cmd := &Command{
+		Name:  "check",
+		Usage: "jira-auto-trial check [-profile names] [-only names] [-skip names] [-tag tags] [-verbose] [-format text|json] [-output file] [-fail-on expiring:days]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		options := RunOptions{CheckOnly: true}
+
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		filter := RegisterFilterFlags(fs)
+		failOn := RegisterFailOnFlag(fs)
+		fs.BoolVar(&options.Verbose, "verbose", false, "show detailed logs instead of one progress line per instance")
+		format := fs.String("format", "text", "output format: text or json")
+		output := fs.String("output", "-", "output file, - for stdout")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if *format != "text" && *format != "json" {
+			return fmt.Errorf("unknown format: %s", *format)
+		}
+
+		cfgs, err := configFlags.LoadAll()
+		if err != nil {
+			return err
+		}
+		if cfgs, err = filter.Apply(cfgs); err != nil {
+			return err
+		}
+
+		results, err := runConfigs(ctx, log, cfgs, options, os.Stderr)
+		if err == nil || errors.Is(err, ErrInstancesFailed) {
+			err = errors.Join(err, failOn.Check(results, time.Now()))
+		}
+		if reportErr := writeOutput(*output, func(w io.Writer) error {
+			if *format == "json" {
+				return WriteJSON(w, CheckReport(results))
+			}
+			return WriteCheckReport(w, results)
+		}); reportErr != nil {
+			return errors.Join(err, reportErr)
+		}
+		return err
+	}
+
+	return cmd
+}
+
+func renewCommand() *Command {
+	cmd := &Command{
+		Name:  "renew",
+		Usage: "jira-auto-trial renew -instance name [-verbose] [-no-persist-keys] [-refresh-server-ids] [-confirm]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		options := RunOptions{Force: true}
+
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		name := fs.String("instance", "", "instance name, base url or host")
+		fs.BoolVar(&options.Verbose, "verbose", false, "show detailed logs instead of one progress line")
+		fs.BoolVar(&options.NoPersistKeys, "no-persist-keys", false, "never write license keys to logs or state, only their hashes")
+		fs.BoolVar(&options.RefreshServerIDs, "refresh-server-ids", false, "resolve the server id again instead of using the cached one")
+		confirm := fs.Bool("confirm", false, "print the decision and ask y/N before renewing")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		if *name == "" {
+			fs.Usage()
+			return fmt.Errorf("-instance is required")
+		}
+		if *confirm {
+			options.Confirm = &Confirmer{In: os.Stdin, Out: os.Stderr, Timeout: time.Minute}
+		}
+
+		cfg, err := configFlags.Load()
+		if err != nil {
+			return err
+		}
+
+		instance, err := FindInstance(cfg, *name)
+		if err != nil {
+			return err
+		}
+
+		instanceCfg := *cfg
+		instanceCfg.Instances = []config.JiraInstance{instance}
+
+		_, err = runConfigs(ctx, log, []*config.Config{&instanceCfg}, options, os.Stdout)
+		return err
+	}
+
+	return cmd
+}
+
+func listCommand() *Command {
+	cmd := &Command{
+		Name:  "list",
+		Usage: "jira-auto-trial list [-profile names] [-only names] [-skip names] [-tag tags]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		filter := RegisterFilterFlags(fs)
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		cfgs, err := configFlags.LoadAll()
+		if err != nil {
+			return err
+		}
+		if cfgs, err = filter.Apply(cfgs); err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(tw, "PROFILE\tNAME\tPRODUCT\tBASE URL\tTAGS\tACCOUNT\n")
+		for _, cfg := range cfgs {
+			for _, instance := range cfg.Instances {
+				product := instance.Product
+				if product == "" {
+					product = "jira"
+				}
+				if instance.Disabled {
+					product += " (disabled)"
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", cmp.Or(cfg.Profile, "-"), InstanceName(instance), product, instance.BaseURL, cmp.Or(strings.Join(instance.Tags, ","), "-"), DescribeAccount(instance.Account))
+			}
+		}
+		return tw.Flush()
+	}
+
+	return cmd
+}
+
+// ErrInstancesFailed is returned when the runs completed but some instances failed.
+var ErrInstancesFailed = errors.New("instances failed")
+
+// runConfigs runs the profiles one after another, prints a summary of each to out and returns the results of all of them.
+func runConfigs(ctx context.Context, log *zap.Logger, cfgs []*config.Config, options RunOptions, out io.Writer) ([]InstanceResult, error) {
+	allResults := make([]InstanceResult, 0)
+	errs := make([]error, 0)
+	for _, cfg := range cfgs {
+		profileLog := log
+		if cfg.Profile != "" {
+			profileLog = log.With(zap.String("profile", cfg.Profile))
+		}
+
+		title := "jira-auto-trial"
+		if cfg.Profile != "" {
+			title += " (" + cfg.Profile + ")"
+		}
+
+		results, err := run(ctx, profileLog, cfg, options)
+		allResults = append(allResults, results...)
+		if GitHubActionsEnabled() {
+			if err := ReportGitHubActions(out, title, results); err != nil {
+				profileLog.Error("writing github actions report failed", zap.Error(err))
+			}
+		}
+		if len(results) > 0 || err != nil {
+			if err := PrintSummary(out, RunSummary{Title: title, Results: results, Err: err}); err != nil {
+				profileLog.Error("writing run summary failed", zap.Error(err))
+			}
+		}
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return allResults, err
+			}
+			profileLog.Error("run failed", zap.Error(err))
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return allResults, errors.Join(errs...)
+	}
+	failed := 0
+	for _, result := range allResults {
+		if result.Outcome == OutcomeFailed || result.Outcome == OutcomeBlockedByQuota {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return allResults, fmt.Errorf("%w: %d of %d", ErrInstancesFailed, failed, len(allResults))
+	}
+	return allResults, nil
+}
+
+const (
+	exitError = 1
+	// the runs completed, but some instances failed
+	exitInstancesFailed = 2
+	// the runs completed, but a trial expires within the days of -fail-on expiring
+	exitInstancesExpiring = 3
+)
+
+func exitCode(err error) int {
+	if errors.Is(err, ErrInstancesFailed) {
+		return exitInstancesFailed
+	}
+	if errors.Is(err, ErrInstancesExpiring) {
+		return exitInstancesExpiring
+	}
+	return exitError
+}
+
+type CheckEntry struct {
+	Instance       string           `json:"instance"`
+	Status         string           `json:"status"`
+	Decision       string           `json:"decision,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	TrialExpiresAt *time.Time       `json:"trialExpiresAt,omitempty"`
+	DaysLeft       *int             `json:"daysLeft,omitempty"`
+	Licenses       []LicenseSummary `json:"licenses"`
+	// websudo is disabled on the instance
+	WebSudoDisabled bool `json:"webSudoDisabled,omitempty"`
+}
+
+func CheckReport(results []InstanceResult) []CheckEntry {
+	entries := make([]CheckEntry, 0, len(results))
+	for _, result := range results {
+		entry := CheckEntry{
+			Instance:       result.Instance,
+			Status:         result.Status(),
+			Decision:       result.Decision,
+			TrialExpiresAt: result.ExpiresAt,
+			Licenses:       result.Licenses,
+
+			WebSudoDisabled: result.WebSudoDisabled,
+		}
+		if result.Err != nil {
+			entry.Error = result.Err.Error()
+		}
+		if result.ExpiresAt != nil {
+			daysLeft := policy.DaysLeft(time.Now(), *result.ExpiresAt)
+			entry.DaysLeft = &daysLeft
+		}
+		if entry.Licenses == nil {
+			entry.Licenses = []LicenseSummary{}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// WriteCheckReport prints the license of every instance as a table, one row per application.
+func WriteCheckReport(w io.Writer, results []InstanceResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "INSTANCE\tSTATUS\tTRIAL EXPIRES\tDAYS LEFT\tSEN\tLICENSE TYPE\tDETAIL\n")
+	for _, result := range results {
+		detail := result.Decision
+		if result.Err != nil {
+			detail = result.Err.Error()
+		}
+		if result.WebSudoDisabled {
+			detail = strings.TrimPrefix(detail+", websudo disabled", ", ")
+		}
+
+		licenses := result.Licenses
+		if len(licenses) == 0 {
+			licenses = []LicenseSummary{{TrialExpiresAt: result.ExpiresAt}}
+		}
+		for _, license := range licenses {
+			instance := result.Instance
+			if license.Application != "" && len(licenses) > 1 {
+				instance += " (" + license.Application + ")"
+			}
+			expires := "-"
+			if license.TrialExpiresAt != nil {
+				expires = FormatDate(*license.TrialExpiresAt)
+			}
+			fmt.Fprintf(
+				tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				instance, result.Status(), expires, formatDaysLeft(license.TrialExpiresAt),
+				cmp.Or(license.SEN, "-"), cmp.Or(license.LicenseType, "-"), detail,
+			)
+		}
+	}
+
+	return tw.Flush()
+}
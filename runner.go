@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrRunInProgress    = errors.New("a run is already in progress")
+	ErrRunNotFound      = errors.New("run not found")
+	ErrInstanceNotFound = errors.New("instance is not running")
+	ErrPaused           = errors.New("runs are paused")
+)
+
+const runnerHistory = 20
+
+type RunRequest struct {
+	Profile   string
+	Force     bool
+	Instances []string
+}
+
+type RunState string
+
+const (
+	RunStateRunning  RunState = "running"
+	RunStateFinished RunState = "finished"
+	RunStateFailed   RunState = "failed"
+)
+
+type InstanceState string
+
+const (
+	InstanceStatePending InstanceState = "pending"
+	InstanceStateRunning InstanceState = "running"
+	InstanceStateDone    InstanceState = "done"
+)
+
+type InstanceStatus struct {
+	Instance  string        `json:"instance"`
+	State     InstanceState `json:"state"`
+	Step      string        `json:"step,omitempty"`
+	Outcome   string        `json:"outcome,omitempty"`
+	Decision  string        `json:"decision,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	ExpiresAt *time.Time    `json:"expiresAt,omitempty"`
+}
+
+type RunStatus struct {
+	RunID      string           `json:"runId"`
+	Profile    string           `json:"profile,omitempty"`
+	State      RunState         `json:"state"`
+	StartedAt  time.Time        `json:"startedAt"`
+	FinishedAt *time.Time       `json:"finishedAt,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Instances  []InstanceStatus `json:"instances"`
+}
+
+type runnerRun struct {
+	status      RunStatus
+	cancel      context.CancelFunc
+	instances   map[string]context.CancelFunc
+	subscribers map[chan Event]struct{}
+}
+
+type Runner struct {
+	log        *zap.Logger
+	loadConfig func(profile string) (*config.Config, error)
+	options    RunOptions
+	metrics    *Metrics
+
+	mu     sync.Mutex
+	runs   map[string]*runnerRun
+	order  []string
+	active string
+}
+
+func NewRunner(log *zap.Logger, loadConfig func(profile string) (*config.Config, error), options RunOptions) *Runner {
+	return &Runner{
+		log:        log,
+		loadConfig: loadConfig,
+		options:    options,
+		metrics:    NewMetrics(),
+		runs:       make(map[string]*runnerRun),
+	}
+}
+
+func (r *Runner) Start(ctx context.Context, req RunRequest) (string, error) {
+	store, err := OpenState()
+	if err != nil {
+		return "", err
+	}
+	if pause := store.Paused(); pause != nil {
+		return "", fmt.Errorf("%w since %s: %s", ErrPaused, FormatDateTime(pause.At), pause.Reason)
+	}
+
+	cfg, err := r.loadConfig(req.Profile)
+	if err != nil {
+		return "", err
+	}
+
+	if len(req.Instances) > 0 {
+		instances := make([]config.JiraInstance, 0, len(req.Instances))
+		for _, name := range req.Instances {
+			instance, err := FindInstance(cfg, name)
+			if err != nil {
+				return "", err
+			}
+			instances = append(instances, instance)
+		}
+		runCfg := *cfg
+		runCfg.Instances = instances
+		cfg = &runCfg
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active != "" {
+		return "", ErrRunInProgress
+	}
+
+	runID := NewRunID()
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	current := &runnerRun{
+		status: RunStatus{
+			RunID:     runID,
+			Profile:   cfg.Profile,
+			State:     RunStateRunning,
+			StartedAt: time.Now().UTC(),
+			Instances: make([]InstanceStatus, 0, len(cfg.Instances)),
+		},
+		cancel:      cancel,
+		instances:   make(map[string]context.CancelFunc),
+		subscribers: make(map[chan Event]struct{}),
+	}
+	for _, instance := range cfg.Instances {
+		current.status.Instances = append(current.status.Instances, InstanceStatus{
+			Instance: InstanceName(instance),
+			State:    InstanceStatePending,
+		})
+	}
+
+	r.runs[runID] = current
+	r.order = append(r.order, runID)
+	if len(r.order) > runnerHistory {
+		delete(r.runs, r.order[0])
+		r.order = r.order[1:]
+	}
+	r.active = runID
+
+	options := r.options
+	options.Force = options.Force || req.Force
+	options.RunID = runID
+	options.Events = func(event Event) {
+		r.handleEvent(current, event)
+		r.metrics.ObserveEvent(event)
+		r.options.Events.Emit(event)
+	}
+	options.InstanceContext = func(ctx context.Context, instance string) (context.Context, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(ctx)
+		r.mu.Lock()
+		current.instances[instance] = cancel
+		r.mu.Unlock()
+		return ctx, func() {
+			cancel()
+			r.mu.Lock()
+			delete(current.instances, instance)
+			r.mu.Unlock()
+		}
+	}
+
+	go func() {
+		_, err := run(ctx, r.log.With(zap.String("run id", runID)), cfg, options)
+		cancel()
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		now := time.Now().UTC()
+		current.status.FinishedAt = &now
+		r.metrics.ObserveRun(now.Sub(current.status.StartedAt), err)
+		current.status.State = RunStateFinished
+		if err != nil {
+			current.status.State = RunStateFailed
+			current.status.Error = err.Error()
+			r.log.Error("run failed", zap.String("run id", runID), zap.Error(err))
+		}
+		for sub := range current.subscribers {
+			close(sub)
+		}
+		current.subscribers = nil
+		r.active = ""
+
+		if err := SaveRunStatus(current.status); err != nil {
+			r.log.Warn("could not save run status", zap.String("run id", runID), zap.Error(err))
+		}
+	}()
+
+	return runID, nil
+}
+
+func (r *Runner) Metrics() *Metrics {
+	return r.metrics
+}
+
+func (r *Runner) handleEvent(run *runnerRun, event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range run.status.Instances {
+		status := &run.status.Instances[i]
+		if status.Instance != event.Instance {
+			continue
+		}
+		switch event.Type {
+		case EventInstanceStarted:
+			status.State = InstanceStateRunning
+		case EventInstanceStep:
+			status.Step = event.Step
+		case EventInstanceFinished:
+			status.State = InstanceStateDone
+			status.Step = ""
+			status.Outcome = event.Outcome
+			status.Decision = event.Decision
+			status.Error = event.Error
+			status.ExpiresAt = event.ExpiresAt
+		}
+	}
+
+	for sub := range run.subscribers {
+		select {
+		case sub <- event:
+		default:
+		}
+	}
+}
+
+func (r *Runner) lookup(runID string) (*runnerRun, error) {
+	if runID == "" {
+		if len(r.order) == 0 {
+			return nil, ErrRunNotFound
+		}
+		runID = r.order[len(r.order)-1]
+	}
+
+	run, ok := r.runs[runID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, runID)
+	}
+	return run, nil
+}
+
+// Status returns the status of a run, finished runs the runner no longer holds are read from the storage backend.
+func (r *Runner) Status(runID string) (RunStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	run, err := r.lookup(runID)
+	if errors.Is(err, ErrRunNotFound) {
+		if status, loadErr := LoadRunStatus(runID); loadErr == nil {
+			return status, nil
+		} else if !errors.Is(loadErr, fs.ErrNotExist) {
+			return RunStatus{}, loadErr
+		}
+	}
+	if err != nil {
+		return RunStatus{}, err
+	}
+
+	status := run.status
+	status.Instances = append([]InstanceStatus(nil), run.status.Instances...)
+	return status, nil
+}
+
+func (r *Runner) Subscribe(runID string) (<-chan Event, func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	run, err := r.lookup(runID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ch := make(chan Event, 64)
+	if run.subscribers == nil {
+		close(ch)
+		return ch, func() {}, nil
+	}
+	run.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, ok := run.subscribers[ch]; ok {
+			delete(run.subscribers, ch)
+			close(ch)
+		}
+	}, nil
+}
+
+func (r *Runner) Cancel(runID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	run, err := r.lookup(runID)
+	if err != nil {
+		return err
+	}
+	run.cancel()
+	return nil
+}
+
+func (r *Runner) CancelInstance(runID, instance string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	run, err := r.lookup(runID)
+	if err != nil {
+		return err
+	}
+
+	cancel, ok := run.instances[instance]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrInstanceNotFound, instance)
+	}
+	cancel()
+	return nil
+}
+
+func runStatusKey(runID string) string {
+	return "runs/" + runID + "/status.json"
+}
+
+// SaveRunStatus keeps a finished run in the storage backend, next to the instance logs of the run by default.
+func SaveRunStatus(status RunStatus) error {
+	backend, err := DataStorage()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	return backend.Write(runStatusKey(status.RunID), data)
+}
+
+// LoadRunStatus reads a saved run, the latest when runID is empty; run ids start with their utc start time.
+func LoadRunStatus(runID string) (RunStatus, error) {
+	backend, err := DataStorage()
+	if err != nil {
+		return RunStatus{}, err
+	}
+
+	if runID == "" {
+		keys, err := backend.List("runs/")
+		if err != nil {
+			return RunStatus{}, err
+		}
+		for _, key := range keys {
+			if id, ok := strings.CutSuffix(strings.TrimPrefix(key, "runs/"), "/status.json"); ok && id > runID {
+				runID = id
+			}
+		}
+		if runID == "" {
+			return RunStatus{}, fmt.Errorf("no saved runs: %w", fs.ErrNotExist)
+		}
+	}
+
+	data, err := backend.Read(runStatusKey(runID))
+	if err != nil {
+		return RunStatus{}, err
+	}
+	var status RunStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return RunStatus{}, fmt.Errorf("error decoding run %s: %w", runID, err)
+	}
+	return status, nil
+}
@@ -0,0 +1,235 @@
+package schedule
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func bits(values ...int) uint64 {
+	var b uint64
+	for _, v := range values {
+		b |= 1 << v
+	}
+	return b
+}
+
+func rangeBits(from, to, step int) uint64 {
+	var b uint64
+	for v := from; v <= to; v += step {
+		b |= 1 << v
+	}
+	return b
+}
+
+func TestCronFieldParse(t *testing.T) {
+	tests := []struct {
+		field cronField
+		value string
+		want  uint64
+		err   bool
+	}{
+		{minuteField, "*", rangeBits(0, 59, 1), false},
+		{minuteField, "0", bits(0), false},
+		{minuteField, "59", bits(59), false},
+		{minuteField, "60", 0, true},
+		{minuteField, "-1", 0, true},
+		{minuteField, "*/15", bits(0, 15, 30, 45), false},
+		{minuteField, "5/20", bits(5, 25, 45), false},
+		{minuteField, "10-20/5", bits(10, 15, 20), false},
+		{minuteField, "1,2,40-42", bits(1, 2, 40, 41, 42), false},
+		{minuteField, "*/0", 0, true},
+		{minuteField, "*/x", 0, true},
+		{minuteField, "20-10", 0, true},
+		{minuteField, "1,", 0, true},
+		{minuteField, "a", 0, true},
+		{hourField, "0-23", rangeBits(0, 23, 1), false},
+		{hourField, "24", 0, true},
+		{hourField, "*/6", bits(0, 6, 12, 18), false},
+		{dayField, "*", rangeBits(1, 31, 1), false},
+		{dayField, "0", 0, true},
+		{dayField, "32", 0, true},
+		{dayField, "*/10", bits(1, 11, 21, 31), false},
+		{monthField, "jan", bits(1), false},
+		{monthField, "mar-may", bits(3, 4, 5), false},
+		{monthField, "*/3", bits(1, 4, 7, 10), false},
+		{monthField, "13", 0, true},
+		{monthField, "foo", 0, true},
+		{weekdayField, "mon-fri", bits(1, 2, 3, 4, 5), false},
+		{weekdayField, "sun,sat", bits(0, 6), false},
+		{weekdayField, "7", bits(7), false},
+		{weekdayField, "8", 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := test.field.parse(test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("parse(%q): got %b, want an error", test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parse(%q): %v", test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parse(%q): got %b, want %b", test.value, got, test.want)
+		}
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		value              string
+		anyDay, anyWeekday bool
+		err                bool
+	}{
+		{"* * * * *", true, true, false},
+		{"0 3 * * 1", true, false, false},
+		{"0 3 15 * *", false, true, false},
+		{"0 3 15 * 1", false, false, false},
+		{"0 3 */2 * 1", true, false, false},
+		{"0 3 1 * */2", false, true, false},
+		{"0 3 * *", false, false, true},
+		{"0 3 * * * *", false, false, true},
+		{"0 3 * * mon-foo", false, false, true},
+	}
+
+	for _, test := range tests {
+		c, err := parseCron(test.value, test.value)
+		if test.err {
+			if err == nil {
+				t.Errorf("parseCron(%q): want an error", test.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", test.value, err)
+			continue
+		}
+		if c.anyDay != test.anyDay || c.anyWeekday != test.anyWeekday {
+			t.Errorf("parseCron(%q): got anyDay %v anyWeekday %v, want %v %v", test.value, c.anyDay, c.anyWeekday, test.anyDay, test.anyWeekday)
+		}
+	}
+
+	c, err := parseCron("sunday", "0 0 * * 7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.weekday&1 == 0 {
+		t.Errorf("7 does not match sunday")
+	}
+}
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("no time zone data for %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestCronNext(t *testing.T) {
+	utc := func(value string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{"every minute", "* * * * *", utc("2024-03-10 15:04"), []time.Time{utc("2024-03-10 15:05"), utc("2024-03-10 15:06")}},
+		{"seconds are dropped", "* * * * *", utc("2024-03-10 15:04").Add(59 * time.Second), []time.Time{utc("2024-03-10 15:05")}},
+		{"later today", "30 16 * * *", utc("2024-03-10 15:04"), []time.Time{utc("2024-03-10 16:30"), utc("2024-03-11 16:30")}},
+		{"exact time is not repeated", "4 15 * * *", utc("2024-03-10 15:04"), []time.Time{utc("2024-03-11 15:04")}},
+		{"steps", "*/20 */12 * * *", utc("2024-03-10 11:50"), []time.Time{utc("2024-03-10 12:00"), utc("2024-03-10 12:20"), utc("2024-03-10 12:40"), utc("2024-03-11 00:00")}},
+		{"end of month", "0 0 * * *", utc("2024-01-31 12:00"), []time.Time{utc("2024-02-01 00:00")}},
+		{"end of year", "0 0 1 * *", utc("2024-12-15 00:00"), []time.Time{utc("2025-01-01 00:00"), utc("2025-02-01 00:00")}},
+		{"31st skips short months", "0 0 31 * *", utc("2024-01-31 00:00"), []time.Time{utc("2024-03-31 00:00"), utc("2024-05-31 00:00")}},
+		{"leap day", "0 0 29 2 *", utc("2024-03-01 00:00"), []time.Time{utc("2028-02-29 00:00")}},
+		{"month names", "0 0 1 jan,jul *", utc("2024-02-01 00:00"), []time.Time{utc("2024-07-01 00:00"), utc("2025-01-01 00:00")}},
+		{"weekdays", "0 9 * * mon-fri", utc("2024-03-08 10:00"), []time.Time{utc("2024-03-11 09:00"), utc("2024-03-12 09:00")}},
+		{"7 is sunday", "0 0 * * 7", utc("2024-03-06 00:00"), []time.Time{utc("2024-03-10 00:00"), utc("2024-03-17 00:00")}},
+		// 2024-03-15 is a friday, the 13th is a wednesday
+		{"day of month or day of week", "0 0 13 * fri", utc("2024-03-12 00:00"), []time.Time{utc("2024-03-13 00:00"), utc("2024-03-15 00:00"), utc("2024-03-22 00:00")}},
+		{"any day of month and day of week", "0 0 * * fri", utc("2024-03-12 00:00"), []time.Time{utc("2024-03-15 00:00"), utc("2024-03-22 00:00")}},
+		{"day of month and any day of week", "0 0 13 * *", utc("2024-03-12 00:00"), []time.Time{utc("2024-03-13 00:00"), utc("2024-04-13 00:00")}},
+		{"day of month step and day of week", "0 0 */2 * fri", utc("2024-03-12 00:00"), []time.Time{utc("2024-03-15 00:00"), utc("2024-03-29 00:00")}},
+		{"never", "0 0 30 2 *", utc("2024-01-01 00:00"), []time.Time{{}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := parseCron(test.expr, test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := test.from
+			for _, want := range test.want {
+				got := c.Next(from)
+				if !got.Equal(want) {
+					t.Fatalf("Next(%s): got %s, want %s", from, got, want)
+				}
+				from = got
+			}
+		})
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	// at reads a wall time with its utc offset in hours, which tells the two passes of a repeated hour apart
+	at := func(value string, offset int) time.Time {
+		v, err := time.Parse("2006-01-02 15:04 -0700", fmt.Sprintf("%s +%02d00", value, offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v.In(berlin)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		// 2024-03-31 02:00 cet jumps to 03:00 cest, 02:30 does not exist that day
+		{"nonexistent time is skipped", "30 2 * * *", at("2024-03-30 12:00", 1), []time.Time{at("2024-04-01 02:30", 2), at("2024-04-02 02:30", 2)}},
+		{"hourly over spring forward", "0 * * * *", at("2024-03-31 00:30", 1), []time.Time{at("2024-03-31 01:00", 1), at("2024-03-31 03:00", 2), at("2024-03-31 04:00", 2)}},
+		{"daily after spring forward", "0 3 * * *", at("2024-03-30 12:00", 1), []time.Time{at("2024-03-31 03:00", 2), at("2024-04-01 03:00", 2)}},
+		// 2024-10-27 03:00 cest falls back to 02:00 cet, 02:30 happens twice but runs once
+		{"repeated time runs once", "30 2 * * *", at("2024-10-26 12:00", 2), []time.Time{at("2024-10-27 02:30", 1), at("2024-10-28 02:30", 1)}},
+		{"repeated time from the first pass", "30 2 * * *", at("2024-10-27 02:10", 2), []time.Time{at("2024-10-27 02:30", 2), at("2024-10-28 02:30", 1)}},
+		{"repeated time from the second pass", "30 2 * * *", at("2024-10-27 02:10", 1), []time.Time{at("2024-10-27 02:30", 1), at("2024-10-28 02:30", 1)}},
+		{"hourly over fall back", "0 * * * *", at("2024-10-27 00:30", 2), []time.Time{at("2024-10-27 01:00", 2), at("2024-10-27 02:00", 2), at("2024-10-27 03:00", 1)}},
+		{"daily after fall back", "0 3 * * *", at("2024-10-26 12:00", 2), []time.Time{at("2024-10-27 03:00", 1), at("2024-10-28 03:00", 1)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := parseCron(test.expr, test.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := test.from
+			for _, want := range test.want {
+				got := c.Next(from)
+				if !got.Equal(want) {
+					t.Fatalf("Next(%s): got %s, want %s", from, got, want)
+				}
+				if got.Location() != berlin {
+					t.Fatalf("Next(%s): got location %s, want %s", from, got.Location(), berlin)
+				}
+				from = got
+			}
+		})
+	}
+}
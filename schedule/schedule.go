@@ -0,0 +1,115 @@
+// Package schedule parses cron expressions and human readable schedules such as "daily at 03:00".
+package schedule
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule yields the times runs are planned at.
+type Schedule interface {
+	// Next returns the first planned time after t, the zero time when there is none.
+	Next(t time.Time) time.Time
+	String() string
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+	"hourly":    "0 * * * *",
+	"daily":     "0 0 * * *",
+	"weekly":    "0 0 * * 0",
+	"monthly":   "0 0 1 * *",
+	"every day": "0 0 * * *",
+}
+
+var atPattern = regexp.MustCompile(`^(?:(?:every|on)\s+)?(.*?)\s*\bat\s+(\d{1,2}):(\d{2})$`)
+
+// Parse accepts a five field cron expression, a descriptor such as @daily or @every 6h, or a human readable
+// schedule: "every 6h", "daily at 03:00", "weekdays at 22:30", "mon,thu at 02:00", "every sunday at 04:00".
+func Parse(expr string) (Schedule, error) {
+	normalized := strings.Join(strings.Fields(strings.ToLower(expr)), " ")
+	if normalized == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+
+	if cron, ok := descriptors[normalized]; ok {
+		return parseCron(expr, cron)
+	}
+
+	for _, prefix := range []string{"@every ", "every "} {
+		if value, ok := strings.CutPrefix(normalized, prefix); ok {
+			if interval, err := time.ParseDuration(strings.ReplaceAll(value, " ", "")); err == nil {
+				if interval < time.Minute {
+					return nil, fmt.Errorf("invalid schedule %q: runs must be at least a minute apart", expr)
+				}
+				return every{expr: expr, interval: interval}, nil
+			}
+		}
+	}
+
+	if m := atPattern.FindStringSubmatch(normalized); m != nil {
+		hour, _ := strconv.Atoi(m[2])
+		minute, _ := strconv.Atoi(m[3])
+		if hour > 23 || minute > 59 {
+			return nil, fmt.Errorf("invalid schedule %q: invalid time %s:%s", expr, m[2], m[3])
+		}
+		days, err := humanDays(m[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", expr, err)
+		}
+		return parseCron(expr, fmt.Sprintf("%d %d * * %s", minute, hour, days))
+	}
+
+	return parseCron(expr, normalized)
+}
+
+// humanDays turns the days of a human readable schedule into a cron day of week field.
+func humanDays(value string) (string, error) {
+	switch value {
+	case "", "day", "daily", "every day":
+		return "*", nil
+	case "weekday", "weekdays":
+		return "1-5", nil
+	case "weekend", "weekends":
+		return "0,6", nil
+	}
+
+	names := strings.FieldsFunc(strings.ReplaceAll(value, " and ", ","), func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	days := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSuffix(name, "s")
+		if len(name) > 3 {
+			name = name[:3]
+		}
+		day, ok := weekdayNames[name]
+		if !ok {
+			return "", fmt.Errorf("unknown day %q", name)
+		}
+		days = append(days, strconv.Itoa(day))
+	}
+	return strings.Join(days, ","), nil
+}
+
+type every struct {
+	expr     string
+	interval time.Duration
+}
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(e.interval).Truncate(time.Second)
+}
+
+func (e every) String() string {
+	return e.expr
+}
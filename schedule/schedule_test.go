@@ -0,0 +1,72 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	from := time.Date(2024, time.March, 8, 10, 0, 0, 0, time.UTC) // a friday
+
+	tests := []struct {
+		expr string
+		want time.Time
+		err  bool
+	}{
+		{"0 3 * * *", time.Date(2024, time.March, 9, 3, 0, 0, 0, time.UTC), false},
+		{"@daily", time.Date(2024, time.March, 9, 0, 0, 0, 0, time.UTC), false},
+		{"@hourly", time.Date(2024, time.March, 8, 11, 0, 0, 0, time.UTC), false},
+		{"@weekly", time.Date(2024, time.March, 10, 0, 0, 0, 0, time.UTC), false},
+		{"@monthly", time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC), false},
+		{"@yearly", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), false},
+		{"  Every   Day  ", time.Date(2024, time.March, 9, 0, 0, 0, 0, time.UTC), false},
+		{"@every 6h", time.Date(2024, time.March, 8, 16, 0, 0, 0, time.UTC), false},
+		{"every 1h 30m", time.Date(2024, time.March, 8, 11, 30, 0, 0, time.UTC), false},
+		{"every 30s", time.Time{}, true},
+		{"daily at 03:00", time.Date(2024, time.March, 9, 3, 0, 0, 0, time.UTC), false},
+		{"at 10:30", time.Date(2024, time.March, 8, 10, 30, 0, 0, time.UTC), false},
+		{"every day at 9:05", time.Date(2024, time.March, 9, 9, 5, 0, 0, time.UTC), false},
+		{"weekdays at 22:30", time.Date(2024, time.March, 8, 22, 30, 0, 0, time.UTC), false},
+		{"weekends at 08:00", time.Date(2024, time.March, 9, 8, 0, 0, 0, time.UTC), false},
+		{"mon,thu at 02:00", time.Date(2024, time.March, 11, 2, 0, 0, 0, time.UTC), false},
+		{"on tuesday and wednesday at 02:00", time.Date(2024, time.March, 12, 2, 0, 0, 0, time.UTC), false},
+		{"every sunday at 04:00", time.Date(2024, time.March, 10, 4, 0, 0, 0, time.UTC), false},
+		{"Mondays at 04:00", time.Date(2024, time.March, 11, 4, 0, 0, 0, time.UTC), false},
+		{"daily at 24:00", time.Time{}, true},
+		{"daily at 03:60", time.Time{}, true},
+		{"someday at 03:00", time.Time{}, true},
+		{"", time.Time{}, true},
+		{"sometimes", time.Time{}, true},
+	}
+
+	for _, test := range tests {
+		s, err := Parse(test.expr)
+		if test.err {
+			if err == nil {
+				t.Errorf("Parse(%q): want an error", test.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q): %v", test.expr, err)
+			continue
+		}
+		if got := s.Next(from); !got.Equal(test.want) {
+			t.Errorf("Parse(%q).Next(%s): got %s, want %s", test.expr, from, got, test.want)
+		}
+		if s.String() != test.expr {
+			t.Errorf("Parse(%q).String(): got %q", test.expr, s.String())
+		}
+	}
+}
+
+func TestEveryNext(t *testing.T) {
+	s, err := Parse("every 90m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, time.March, 8, 10, 0, 30, 500, time.UTC)
+	if got, want := s.Next(from), time.Date(2024, time.March, 8, 11, 30, 30, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
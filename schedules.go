@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/policy"
+	"github.com/tarik02/jira-auto-trial/schedule"
+	"go.uber.org/zap"
+)
+
+// ScheduleEntry is one scheduled run: the instances of a profile that have no schedule of their own, or a single
+// instance with its own schedule.
+type ScheduleEntry struct {
+	Profile   string
+	Instances []config.JiraInstance
+	// the run covers the whole profile, no instance has a schedule of its own
+	All      bool
+	Schedule schedule.Schedule
+
+	policies []*policy.Policy
+}
+
+func (e ScheduleEntry) Target() string {
+	switch {
+	case e.All:
+		return "all instances"
+	case len(e.Instances) == 1 && e.Instances[0].Schedule != "":
+		return InstanceName(e.Instances[0])
+	default:
+		return fmt.Sprintf("instances without own schedule (%d)", len(e.Instances))
+	}
+}
+
+func (e ScheduleEntry) Request() RunRequest {
+	req := RunRequest{Profile: e.Profile}
+	if !e.All {
+		for _, instance := range e.Instances {
+			req.Instances = append(req.Instances, instance.BaseURL)
+		}
+	}
+	return req
+}
+
+// ScheduleEntries lists the scheduled runs of a config, nothing is scheduled without schedule settings.
+func ScheduleEntries(cfg *config.Config) ([]ScheduleEntry, error) {
+	entries := make([]ScheduleEntry, 0)
+
+	group := ScheduleEntry{Profile: cfg.Profile, All: true}
+	for _, instance := range cfg.Instances {
+		instancePolicy, err := policy.New(cfg.InstancePolicy(instance))
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: invalid policy: %w", InstanceName(instance), err)
+		}
+
+		if instance.Schedule == "" {
+			group.Instances = append(group.Instances, instance)
+			group.policies = append(group.policies, instancePolicy)
+			continue
+		}
+
+		group.All = false
+		instanceSchedule, err := schedule.Parse(instance.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: %w", InstanceName(instance), err)
+		}
+		entries = append(entries, ScheduleEntry{
+			Profile:   cfg.Profile,
+			Instances: []config.JiraInstance{instance},
+			Schedule:  instanceSchedule,
+			policies:  []*policy.Policy{instancePolicy},
+		})
+	}
+
+	if cfg.Schedule != "" && len(group.Instances) > 0 {
+		groupSchedule, err := schedule.Parse(cfg.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		group.Schedule = groupSchedule
+		entries = append([]ScheduleEntry{group}, entries...)
+	}
+
+	return entries, nil
+}
+
+type PlannedRun struct {
+	Profile  string    `json:"profile,omitempty"`
+	Target   string    `json:"target"`
+	Schedule string    `json:"schedule"`
+	At       time.Time `json:"at"`
+	// instances of the run whose maintenance windows allow renewing at this time
+	InWindows int `json:"inWindows"`
+	Instances int `json:"instances"`
+}
+
+// PreviewSchedule returns the next count runs of every entry after from.
+func PreviewSchedule(entries []ScheduleEntry, from time.Time, count int) []PlannedRun {
+	runs := make([]PlannedRun, 0, len(entries)*count)
+	for _, entry := range entries {
+		at := from.In(dateLocation)
+		for i := 0; i < count; i++ {
+			if at = entry.Schedule.Next(at); at.IsZero() {
+				break
+			}
+			run := PlannedRun{
+				Profile:   entry.Profile,
+				Target:    entry.Target(),
+				Schedule:  entry.Schedule.String(),
+				At:        at,
+				Instances: len(entry.Instances),
+			}
+			for _, p := range entry.policies {
+				if p.RenewsAt(at) {
+					run.InWindows++
+				}
+			}
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+func WritePlannedRunsText(w io.Writer, runs []PlannedRun) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "PROFILE\tRUN\tSCHEDULE\tAT\tMAINTENANCE WINDOWS\n")
+	for _, run := range runs {
+		windows := "renewals allowed"
+		switch {
+		case run.InWindows == 0:
+			windows = "outside, only expired trials are renewed"
+		case run.InWindows < run.Instances:
+			windows = fmt.Sprintf("%d of %d instances inside", run.InWindows, run.Instances)
+		}
+		profile := run.Profile
+		if profile == "" {
+			profile = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", profile, run.Target, run.Schedule, run.At.Format("Mon ")+FormatDateTime(run.At), windows)
+	}
+
+	return tw.Flush()
+}
+
+// RunSchedules starts runs at the times of the entries until ctx is done, a run that is due while another one is
+// in progress is skipped.
+func RunSchedules(ctx context.Context, log *zap.Logger, runner *Runner, entries []ScheduleEntry) error {
+	next := make([]time.Time, len(entries))
+	now := time.Now().In(dateLocation)
+	for i, entry := range entries {
+		next[i] = entry.Schedule.Next(now)
+		log.Info("scheduled", zap.String("profile", entry.Profile), zap.String("run", entry.Target()), zap.String("schedule", entry.Schedule.String()), zap.String("next run", FormatDateTime(next[i])))
+	}
+
+	for {
+		due := -1
+		for i := range entries {
+			if !next[i].IsZero() && (due == -1 || next[i].Before(next[due])) {
+				due = i
+			}
+		}
+		if due == -1 {
+			<-ctx.Done()
+			return nil
+		}
+
+		if err := sleepContext(ctx, time.Until(next[due])); err != nil {
+			return nil
+		}
+
+		entry := entries[due]
+		runLog := log.With(zap.String("profile", entry.Profile), zap.String("run", entry.Target()))
+		if runID, err := runner.Start(ctx, entry.Request()); err != nil {
+			runLog.Warn("scheduled run not started", zap.Error(err))
+		} else {
+			runLog.Info("scheduled run started", zap.String("run id", runID))
+		}
+		next[due] = entry.Schedule.Next(time.Now().In(dateLocation))
+	}
+}
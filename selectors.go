@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/state"
+)
+
+// ErrUnsupportedAdminUI is returned when an admin page matches none of the known layouts.
+var ErrUnsupportedAdminUI = errors.New("unsupported admin ui")
+
+// UnsupportedAdminUI saves a screenshot of the page so the new layout can be added.
+func UnsupportedAdminUI(page playwright.Page, name string) error {
+	path := DataPath("screenshots", fmt.Sprintf("unsupported-admin-ui-%s.png", time.Now().Format("20060102-150405.000")))
+	if _, err := page.Screenshot(playwright.PageScreenshotOptions{
+		Path:     playwright.String(path),
+		FullPage: playwright.Bool(true),
+	}); err != nil {
+		return fmt.Errorf("%w: %s matches no known layout (could not take screenshot: %v)", ErrUnsupportedAdminUI, name, err)
+	}
+	return fmt.Errorf("%w: %s matches no known layout, screenshot saved to %s", ErrUnsupportedAdminUI, name, path)
+}
+
+type selectorTrackerKey struct{}
+
+type SelectorTracker struct {
+	mu    sync.Mutex
+	stats map[string]*state.SelectorStats
+	// timeouts by signature for telemetry, nil unless collected
+	failures map[SelectorFailureSignature]int
+}
+
+func NewSelectorTracker() *SelectorTracker {
+	return &SelectorTracker{
+		stats: map[string]*state.SelectorStats{},
+	}
+}
+
+func WithSelectorTracker(ctx context.Context, tracker *SelectorTracker) context.Context {
+	return context.WithValue(ctx, selectorTrackerKey{}, tracker)
+}
+
+func TrackSelector(ctx context.Context, id string, err error) error {
+	tracker, ok := ctx.Value(selectorTrackerKey{}).(*SelectorTracker)
+	if !ok {
+		return err
+	}
+
+	// the version is read from the page before locking, other instances keep tracking meanwhile
+	var signature SelectorFailureSignature
+	collect := tracker.failures != nil && errors.Is(err, playwright.ErrTimeout)
+	if collect {
+		signature = selectorFailureSignature(ctx, id)
+	}
+
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	stats, ok := tracker.stats[id]
+	if !ok {
+		stats = &state.SelectorStats{}
+		tracker.stats[id] = stats
+	}
+
+	stats.Attempts++
+	if errors.Is(err, playwright.ErrTimeout) {
+		now := time.Now()
+		stats.Timeouts++
+		stats.LastTimeoutAt = &now
+
+		if collect {
+			tracker.failures[signature]++
+		}
+	}
+
+	return err
+}
+
+func (t *SelectorTracker) Save(store *state.Store) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return store.UpdateSelectors(func(selectors map[string]*state.SelectorStats) {
+		for id, stats := range t.stats {
+			total, ok := selectors[id]
+			if !ok {
+				total = &state.SelectorStats{}
+				selectors[id] = total
+			}
+			total.Attempts += stats.Attempts
+			total.Timeouts += stats.Timeouts
+			if stats.LastTimeoutAt != nil {
+				total.LastTimeoutAt = stats.LastTimeoutAt
+			}
+		}
+	})
+}
+
+type SelectorHealth struct {
+	ID            string     `json:"id"`
+	Attempts      int        `json:"attempts"`
+	Timeouts      int        `json:"timeouts"`
+	TimeoutRate   float64    `json:"timeoutRate"`
+	LastTimeoutAt *time.Time `json:"lastTimeoutAt,omitempty"`
+}
+
+func SelectorHealthReport(selectors map[string]*state.SelectorStats) []SelectorHealth {
+	report := make([]SelectorHealth, 0, len(selectors))
+	for id, stats := range selectors {
+		health := SelectorHealth{
+			ID:            id,
+			Attempts:      stats.Attempts,
+			Timeouts:      stats.Timeouts,
+			LastTimeoutAt: stats.LastTimeoutAt,
+		}
+		if stats.Attempts > 0 {
+			health.TimeoutRate = float64(stats.Timeouts) / float64(stats.Attempts)
+		}
+		report = append(report, health)
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].TimeoutRate != report[j].TimeoutRate {
+			return report[i].TimeoutRate > report[j].TimeoutRate
+		}
+		return report[i].ID < report[j].ID
+	})
+
+	return report
+}
+
+func WriteSelectorHealthText(w io.Writer, report []SelectorHealth) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "SELECTOR\tATTEMPTS\tTIMEOUTS\tRATE\tLAST TIMEOUT\n")
+	for _, health := range report {
+		lastTimeout := "-"
+		if health.LastTimeoutAt != nil {
+			lastTimeout = FormatDateTime(*health.LastTimeoutAt)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f%%\t%s\n", health.ID, health.Attempts, health.Timeouts, health.TimeoutRate*100, lastTimeout)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var ErrInvalidServerID = errors.New("invalid server id")
+
+var serverIDPattern = regexp.MustCompile(`^[A-Z0-9]{4}-[A-Z0-9]{4}-[A-Z0-9]{4}-[A-Z0-9]{4}$`)
+
+func ValidateServerID(serverID string) (string, error) {
+	serverID = strings.ToUpper(strings.TrimSpace(serverID))
+	if !serverIDPattern.MatchString(serverID) {
+		return "", fmt.Errorf("%w: %q does not match XXXX-XXXX-XXXX-XXXX", ErrInvalidServerID, serverID)
+	}
+	return serverID, nil
+}
+
+// ExtractServerID reads the server id until it is well-formed, the page sometimes yields whitespace or a partial value.
+func ExtractServerID(read func() (string, error)) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			time.Sleep(500 * time.Millisecond)
+		}
+
+		value, err := read()
+		if err != nil {
+			return "", err
+		}
+
+		serverID, err := ValidateServerID(value)
+		if err == nil {
+			return serverID, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
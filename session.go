@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+	"golang.org/x/net/publicsuffix"
+)
+
+func atlassianSessionFile() string {
+	return DataPath("atlassian-session.json")
+}
+
+var atlassianSessionDomains = []string{"atlassian.com"}
+
+// InstanceSessionKey identifies the browser session of an instance.
+func InstanceSessionKey(instance config.JiraInstance) string {
+	return "instance " + strings.TrimSuffix(instance.BaseURL, "/")
+}
+
+// AtlassianSessionKey identifies the browser session of an atlassian account without resolving its secrets.
+func AtlassianSessionKey(account config.Account) string {
+	return "atlassian " + accountID(account)
+}
+
+func accountID(account config.Account) string {
+	switch true {
+	case account.Plain != nil:
+		return "plain " + account.Plain.Username
+	case account.Env != nil:
+		return "env " + os.Getenv(account.Env.UsernameVar)
+	case account.Command != nil:
+		return "command " + strings.Join(account.Command.Command, " ") + " " + account.Command.Username
+	case account.Vault != nil:
+		return "vault " + account.Vault.Address + " " + account.Vault.Mount + "/" + account.Vault.Path
+	case account.Keyring != nil:
+		return "keyring " + account.Keyring.Service + " " + account.Keyring.Username
+	default:
+		return ""
+	}
+}
+
+// SessionCollision is a parent domain shared by instances that log in with different accounts, single sign-on
+// cookies set for it would log one instance in as the user of the other.
+type SessionCollision struct {
+	Domain    string
+	Instances []config.JiraInstance
+}
+
+// SessionCollisions finds instances whose sessions must not share a browser context.
+func SessionCollisions(instances []config.JiraInstance) []SessionCollision {
+	domains := make([]string, 0)
+	byDomain := map[string][]config.JiraInstance{}
+	for _, instance := range instances {
+		// personal access tokens never log in to the browser
+		if instance.Disabled || instance.Account.PAT != nil {
+			continue
+		}
+		u, err := url.Parse(NavigationBaseURL(instance))
+		if err != nil || net.ParseIP(u.Hostname()) != nil {
+			continue
+		}
+		domain, err := publicsuffix.EffectiveTLDPlusOne(u.Hostname())
+		if err != nil {
+			continue
+		}
+		if _, ok := byDomain[domain]; !ok {
+			domains = append(domains, domain)
+		}
+		byDomain[domain] = append(byDomain[domain], instance)
+	}
+
+	collisions := make([]SessionCollision, 0)
+	for _, domain := range domains {
+		group := byDomain[domain]
+		accounts := map[string]bool{}
+		for _, instance := range group {
+			accounts[accountID(instance.Account)] = true
+		}
+		if len(accounts) > 1 {
+			collisions = append(collisions, SessionCollision{Domain: domain, Instances: group})
+		}
+	}
+	return collisions
+}
+
+// SessionScope is a session key with the cookie domains that belong to it.
+type SessionScope struct {
+	Key     string
+	Domains []string
+}
+
+// SessionScopes lists the sessions of the instances and the atlassian account selected by scope.
+func SessionScopes(cfg *config.Config, scope string) ([]SessionScope, error) {
+	scopes := make([]SessionScope, 0, len(cfg.Instances)+1)
+	if scope == "all" || scope == "jira" {
+		for _, instance := range cfg.Instances {
+			u, err := url.Parse(NavigationBaseURL(instance))
+			if err != nil {
+				return nil, fmt.Errorf("invalid base url %q: %w", instance.BaseURL, err)
+			}
+			scopes = append(scopes, SessionScope{Key: InstanceSessionKey(instance), Domains: []string{u.Hostname()}})
+		}
+	}
+	if scope == "all" || scope == "atlassian" {
+		scopes = append(scopes, SessionScope{Key: AtlassianSessionKey(cfg.Atlassian.Account), Domains: atlassianSessionDomains})
+	}
+	return scopes, nil
+}
+
+func SessionDomains(cfg *config.Config, scope string) ([]string, error) {
+	jiraDomains := make([]string, 0, len(cfg.Instances))
+	for _, instance := range cfg.Instances {
+		u, err := url.Parse(NavigationBaseURL(instance))
+		if err != nil {
+			return nil, fmt.Errorf("invalid base url %q: %w", instance.BaseURL, err)
+		}
+		jiraDomains = append(jiraDomains, u.Hostname())
+	}
+
+	switch scope {
+	case "all":
+		return append(jiraDomains, atlassianSessionDomains...), nil
+	case "atlassian":
+		return atlassianSessionDomains, nil
+	case "jira":
+		return jiraDomains, nil
+	default:
+		return nil, fmt.Errorf("unknown session scope: %s", scope)
+	}
+}
+
+func matchSessionDomain(host string, domains []string) bool {
+	host = strings.TrimPrefix(host, ".")
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func ExportSession(browserContext playwright.BrowserContext, domains []string) (*playwright.StorageState, error) {
+	state, err := browserContext.StorageState()
+	if err != nil {
+		return nil, fmt.Errorf("could not read storage state: %w", err)
+	}
+
+	result := &playwright.StorageState{
+		Cookies: []playwright.Cookie{},
+		Origins: []playwright.Origin{},
+	}
+
+	for _, cookie := range state.Cookies {
+		if matchSessionDomain(cookie.Domain, domains) {
+			result.Cookies = append(result.Cookies, cookie)
+		}
+	}
+
+	for _, origin := range state.Origins {
+		if u, err := url.Parse(origin.Origin); err == nil && matchSessionDomain(u.Hostname(), domains) {
+			result.Origins = append(result.Origins, origin)
+		}
+	}
+
+	return result, nil
+}
+
+func ImportSession(browserContext playwright.BrowserContext, state *playwright.StorageState) error {
+	if len(state.Cookies) > 0 {
+		if err := browserContext.AddCookies(state.ToOptionalStorageState().Cookies); err != nil {
+			return fmt.Errorf("could not add cookies: %w", err)
+		}
+	}
+
+	if len(state.Origins) == 0 {
+		return nil
+	}
+
+	page, err := browserContext.NewPage()
+	if err != nil {
+		return fmt.Errorf("could not create page: %w", err)
+	}
+	defer page.Close()
+
+	for _, origin := range state.Origins {
+		if _, err := page.Goto(origin.Origin); err != nil {
+			return fmt.Errorf("could not navigate to %s: %w", origin.Origin, err)
+		}
+
+		if _, err := page.Evaluate(`items => {
+			for (const { name, value } of items) {
+				localStorage.setItem(name, value)
+			}
+		}`, origin.LocalStorage); err != nil {
+			return fmt.Errorf("could not restore local storage of %s: %w", origin.Origin, err)
+		}
+	}
+
+	return nil
+}
+
+// ExportSessions merges the sessions of all scopes, which are separate contexts when sessions are isolated.
+func ExportSessions(browser *Browser, scopes []SessionScope) (*playwright.StorageState, error) {
+	result := &playwright.StorageState{
+		Cookies: []playwright.Cookie{},
+		Origins: []playwright.Origin{},
+	}
+
+	for _, scope := range scopes {
+		session, err := browser.SessionContext(scope.Key)
+		if err != nil {
+			return nil, err
+		}
+		state, err := ExportSession(session.BrowserContext, scope.Domains)
+		_ = session.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		result.Cookies = append(result.Cookies, state.Cookies...)
+		result.Origins = append(result.Origins, state.Origins...)
+	}
+
+	return result, nil
+}
+
+// ImportSessions restores the cookies and storage of each scope into its context.
+func ImportSessions(browser *Browser, scopes []SessionScope, state *playwright.StorageState) error {
+	for _, scope := range scopes {
+		scoped := &playwright.StorageState{}
+		for _, cookie := range state.Cookies {
+			if matchSessionDomain(cookie.Domain, scope.Domains) {
+				scoped.Cookies = append(scoped.Cookies, cookie)
+			}
+		}
+		for _, origin := range state.Origins {
+			if u, err := url.Parse(origin.Origin); err == nil && matchSessionDomain(u.Hostname(), scope.Domains) {
+				scoped.Origins = append(scoped.Origins, origin)
+			}
+		}
+		if len(scoped.Cookies) == 0 && len(scoped.Origins) == 0 {
+			continue
+		}
+
+		session, err := browser.SessionContext(scope.Key)
+		if err != nil {
+			return err
+		}
+		if err := ImportSession(session.BrowserContext, scoped); err != nil {
+			_ = session.Close()
+			return err
+		}
+		if err := session.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func WriteSessionFile(path string, state *playwright.StorageState) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creating session file: %w", err)
+	}
+	defer file.Close()
+
+	if err := WriteJSON(file, state); err != nil {
+		return fmt.Errorf("error writing session file: %w", err)
+	}
+
+	return file.Close()
+}
+
+func ReadSessionFile(path string) (*playwright.StorageState, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading session file: %w", err)
+	}
+	defer file.Close()
+
+	var state playwright.StorageState
+	if err := json.NewDecoder(file).Decode(&state); err != nil {
+		return nil, fmt.Errorf("error decoding session file: %w", err)
+	}
+
+	return &state, nil
+}
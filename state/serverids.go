@@ -0,0 +1,90 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/storage"
+)
+
+type CachedServerID struct {
+	ServerID   string    `json:"serverId"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+}
+
+// ServerIDCache remembers the server id of each instance by base url, it does not change once an instance is
+// installed and resolving it needs the system info page, which asks for websudo.
+type ServerIDCache struct {
+	backend storage.Backend
+	key     string
+	mu      sync.Mutex
+	ids     map[string]CachedServerID
+}
+
+func OpenServerIDCache(backend storage.Backend, key string) (*ServerIDCache, error) {
+	c := &ServerIDCache{
+		backend: backend,
+		key:     key,
+		ids:     map[string]CachedServerID{},
+	}
+
+	data, err := backend.Read(key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading server ids: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &c.ids); err != nil {
+		return nil, fmt.Errorf("error decoding server ids: %w", err)
+	}
+	if c.ids == nil {
+		c.ids = map[string]CachedServerID{}
+	}
+
+	return c, nil
+}
+
+func (c *ServerIDCache) Get(baseURL string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, ok := c.ids[baseURL]
+	return cached.ServerID, ok && cached.ServerID != ""
+}
+
+func (c *ServerIDCache) Set(baseURL, serverID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, ok := c.ids[baseURL]; ok && cached.ServerID == serverID {
+		return nil
+	}
+	c.ids[baseURL] = CachedServerID{ServerID: serverID, ResolvedAt: time.Now()}
+
+	return writeJSON(c.backend, c.key, c.ids)
+}
+
+// Delete forgets the server ids of the base urls, they are resolved again on the next renewal.
+func (c *ServerIDCache) Delete(baseURLs ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	changed := false
+	for _, baseURL := range baseURLs {
+		if _, ok := c.ids[baseURL]; ok {
+			delete(c.ids, baseURL)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	return writeJSON(c.backend, c.key, c.ids)
+}
@@ -0,0 +1,161 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/storage"
+)
+
+type InstanceState struct {
+	LastRunAt     *time.Time `json:"lastRunAt,omitempty"`
+	LastOutcome   string     `json:"lastOutcome,omitempty"`
+	LastRenewedAt *time.Time `json:"lastRenewedAt,omitempty"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+
+	LicenseKey     string `json:"licenseKey,omitempty"`
+	LicenseKeyHash string `json:"licenseKeyHash,omitempty"`
+
+	// the failure last sent to each delta notification target, cleared once the instance recovers
+	NotifiedFailures map[string]NotifiedFailure `json:"notifiedFailures,omitempty"`
+}
+
+type NotifiedFailure struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+type SelectorStats struct {
+	Attempts      int        `json:"attempts"`
+	Timeouts      int        `json:"timeouts"`
+	LastTimeoutAt *time.Time `json:"lastTimeoutAt,omitempty"`
+}
+
+type Pause struct {
+	At     time.Time `json:"at"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+type State struct {
+	Instances map[string]*InstanceState `json:"instances"`
+	Selectors map[string]*SelectorStats `json:"selectors,omitempty"`
+	Paused    *Pause                    `json:"paused,omitempty"`
+}
+
+type Store struct {
+	backend storage.Backend
+	key     string
+	mu      sync.Mutex
+	state   State
+}
+
+func Open(backend storage.Backend, key string) (*Store, error) {
+	s := &Store{
+		backend: backend,
+		key:     key,
+		state: State{
+			Instances: map[string]*InstanceState{},
+		},
+	}
+
+	data, err := backend.Read(key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, fmt.Errorf("error decoding state: %w", err)
+	}
+	if s.state.Instances == nil {
+		s.state.Instances = map[string]*InstanceState{}
+	}
+
+	return s, nil
+}
+
+func (s *Store) Instance(key string) InstanceState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if instance, ok := s.state.Instances[key]; ok {
+		return *instance
+	}
+	return InstanceState{}
+}
+
+func (s *Store) UpdateInstance(key string, update func(instance *InstanceState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, ok := s.state.Instances[key]
+	if !ok {
+		instance = &InstanceState{}
+		s.state.Instances[key] = instance
+	}
+	update(instance)
+
+	return s.save()
+}
+
+func (s *Store) Selectors() map[string]*SelectorStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	selectors := make(map[string]*SelectorStats, len(s.state.Selectors))
+	for id, stats := range s.state.Selectors {
+		copied := *stats
+		selectors[id] = &copied
+	}
+	return selectors
+}
+
+func (s *Store) UpdateSelectors(update func(selectors map[string]*SelectorStats)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state.Selectors == nil {
+		s.state.Selectors = map[string]*SelectorStats{}
+	}
+	update(s.state.Selectors)
+
+	return s.save()
+}
+
+func (s *Store) Paused() *Pause {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state.Paused == nil {
+		return nil
+	}
+	pause := *s.state.Paused
+	return &pause
+}
+
+func (s *Store) SetPaused(pause *Pause) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Paused = pause
+
+	return s.save()
+}
+
+func (s *Store) save() error {
+	return writeJSON(s.backend, s.key, s.state)
+}
+
+func writeJSON(backend storage.Backend, key string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", key, err)
+	}
+	return backend.Write(key, data)
+}
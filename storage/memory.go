@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Memory keeps the keys in the process, for tests and runs that must not leave anything behind.
+type Memory struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func NewMemory() *Memory {
+	return &Memory{data: map[string][]byte{}}
+}
+
+func (b *Memory) Read(key string) ([]byte, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data, ok := b.data[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, fs.ErrNotExist)
+	}
+	return slices.Clone(data), nil
+}
+
+func (b *Memory) Write(key string, data []byte) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data[key] = slices.Clone(data)
+	return nil
+}
+
+func (b *Memory) Append(key string, data []byte) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data[key] = append(b.data[key], data...)
+	return nil
+}
+
+func (b *Memory) List(prefix string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	keys := make([]string, 0)
+	for key := range b.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (b *Memory) Delete(key string) error {
+	key, err := cleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.data, key)
+	return nil
+}
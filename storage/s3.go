@@ -0,0 +1,331 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// S3 keeps the keys as objects under a prefix of a bucket, requests are signed with aws signature version 4.
+// Objects have no append, Append reads and rewrites the object, so only one process should write the audit log.
+type S3 struct {
+	bucket   string
+	prefix   string
+	region   string
+	endpoint *url.URL
+	// buckets of other endpoints, e.g. minio, are addressed by path instead of by host
+	pathStyle bool
+
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+
+	http     *http.Client
+	appendMu sync.Mutex
+}
+
+// NewS3FromEnv reads the credentials from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN. The
+// region comes from ?region= or AWS_REGION, the endpoint from ?endpoint= or AWS_ENDPOINT_URL.
+func NewS3FromEnv(bucket, prefix string, query url.Values) (*S3, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 storage needs a bucket, e.g. s3://bucket/prefix")
+	}
+
+	b := &S3{
+		bucket:          bucket,
+		prefix:          prefix,
+		region:          firstNonEmpty(query.Get("region"), os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION"), "us-east-1"),
+		accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		http:            &http.Client{Timeout: 30 * time.Second},
+	}
+	if b.accessKeyID == "" || b.secretAccessKey == "" {
+		return nil, fmt.Errorf("s3 storage needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	endpoint := firstNonEmpty(query.Get("endpoint"), os.Getenv("AWS_ENDPOINT_URL_S3"), os.Getenv("AWS_ENDPOINT_URL"))
+	if endpoint == "" {
+		endpoint = "https://" + bucket + ".s3." + b.region + ".amazonaws.com"
+	} else {
+		b.pathStyle = true
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint %q", endpoint)
+	}
+	b.endpoint = u
+
+	return b, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (b *S3) objectKey(key string) (string, error) {
+	key, err := cleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	if b.prefix == "" {
+		return key, nil
+	}
+	return b.prefix + "/" + key, nil
+}
+
+func (b *S3) Read(key string) ([]byte, error) {
+	objectKey, err := b.objectKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.do(context.Background(), http.MethodGet, objectKey, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", key, fs.ErrNotExist)
+	}
+	if err := s3Error(resp); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", key, err)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Write puts the whole object, s3 never shows a partial one.
+func (b *S3) Write(key string, data []byte) error {
+	objectKey, err := b.objectKey(key)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.do(context.Background(), http.MethodPut, objectKey, nil, data)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if err := s3Error(resp); err != nil {
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	return nil
+}
+
+func (b *S3) Append(key string, data []byte) error {
+	b.appendMu.Lock()
+	defer b.appendMu.Unlock()
+
+	existing, err := b.Read(key)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return b.Write(key, append(existing, data...))
+}
+
+func (b *S3) List(prefix string) ([]string, error) {
+	objectPrefix := prefix
+	if b.prefix != "" {
+		objectPrefix = b.prefix + "/" + prefix
+	}
+
+	var result struct {
+		Contents []struct {
+			Key string `xml:"Key"`
+		} `xml:"Contents"`
+		IsTruncated           bool   `xml:"IsTruncated"`
+		NextContinuationToken string `xml:"NextContinuationToken"`
+	}
+	keys := make([]string, 0)
+	query := url.Values{"list-type": {"2"}, "prefix": {objectPrefix}}
+	for {
+		resp, err := b.do(context.Background(), http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", prefix, err)
+		}
+		err = s3Error(resp)
+		if err == nil {
+			result.Contents, result.IsTruncated, result.NextContinuationToken = nil, false, ""
+			err = xml.NewDecoder(resp.Body).Decode(&result)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error listing %s: %w", prefix, err)
+		}
+
+		for _, object := range result.Contents {
+			if b.prefix != "" {
+				object.Key = strings.TrimPrefix(object.Key, b.prefix+"/")
+			}
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (b *S3) Delete(key string) error {
+	objectKey, err := b.objectKey(key)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.do(context.Background(), http.MethodDelete, objectKey, nil, nil)
+	if err != nil {
+		return fmt.Errorf("error deleting %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err := s3Error(resp); err != nil {
+		return fmt.Errorf("error deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+func s3Error(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return fmt.Errorf("s3 returned %s: %s: %s", resp.Status, body.Code, body.Message)
+	}
+	return fmt.Errorf("s3 returned %s", resp.Status)
+}
+
+// do sends a signed request for an object, or for the bucket when objectKey is empty. Backend has no context, its
+// methods pass context.Background() and are bounded by the timeout of the client.
+func (b *S3) do(ctx context.Context, method, objectKey string, query url.Values, body []byte) (*http.Response, error) {
+	req, err := b.newRequest(ctx, method, objectKey, query, body, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	return b.http.Do(req)
+}
+
+func (b *S3) newRequest(ctx context.Context, method, objectKey string, query url.Values, body []byte, now time.Time) (*http.Request, error) {
+	u := *b.endpoint
+	segments := make([]string, 0)
+	if b.pathStyle {
+		segments = append(segments, b.bucket)
+	}
+	if objectKey != "" {
+		segments = append(segments, strings.Split(objectKey, "/")...)
+	}
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+	u.RawPath = strings.TrimSuffix(u.Path, "/") + "/" + strings.Join(segments, "/")
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	b.sign(req, u.RawPath, body, now)
+	return req, nil
+}
+
+func (b *S3) sign(req *http.Request, canonicalPath string, body []byte, now time.Time) {
+	payloadHash := sha256Hex(body)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	req.Header.Set("x-amz-date", amzDate)
+	if b.sessionToken != "" {
+		req.Header.Set("x-amz-security-token", b.sessionToken)
+	}
+
+	headers := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if b.sessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range headers {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + b.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+b.secretAccessKey), date)
+	for _, part := range []string{b.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", b.accessKeyID, scope, signedHeaders, signature))
+}
+
+// s3Escape encodes everything but the unreserved characters, as the canonical request of signature version 4 does.
+func s3Escape(segment string) string {
+	var b strings.Builder
+	for _, c := range []byte(segment) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Backend keeps the files of state, server ids, the audit log and run history. Keys are slash-separated paths
+// relative to the root of the backend, e.g. runs/<run id>/status.json. Reading a missing key returns an error
+// that matches fs.ErrNotExist.
+type Backend interface {
+	Read(key string) ([]byte, error)
+	// Write replaces the value at once, readers never see it half written
+	Write(key string, data []byte) error
+	Append(key string, data []byte) error
+	// List returns the keys under the prefix, sorted
+	List(prefix string) ([]string, error)
+	// Delete succeeds when the key does not exist
+	Delete(key string) error
+}
+
+// Open selects the backend by url: a directory path or file://, s3://bucket/prefix, or memory:// which forgets
+// everything when the process exits.
+func Open(rawURL string) (Backend, error) {
+	scheme, rest, ok := strings.Cut(rawURL, "://")
+	if !ok {
+		return NewFS(rawURL), nil
+	}
+
+	switch scheme {
+	case "file":
+		return NewFS(rest), nil
+	case "memory":
+		return NewMemory(), nil
+	case "s3":
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid storage url: %w", err)
+		}
+		return NewS3FromEnv(u.Host, strings.Trim(u.Path, "/"), u.Query())
+	default:
+		return nil, fmt.Errorf("unknown storage %q, use a directory, file://, s3:// or memory://", scheme+"://")
+	}
+}
+
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)[1:]
+	if cleaned == "" || cleaned != strings.TrimPrefix(key, "/") {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return cleaned, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+func FindStrayBrowserProcesses(userDataDir string) ([]int, error) {
+	return nil, nil
+}
+
+func KillProcesses(pids []int) error {
+	return nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/state"
+	"gopkg.in/yaml.v3"
+)
+
+type SupportBundleParams struct {
+	ConfigPath string
+	// failure captures and screenshots older than this are left out
+	Since time.Duration
+	// page html of failure captures contains license keys and instance data
+	IncludeHTML bool
+}
+
+// WriteSupportBundle zips version info, the redacted config and state, the latest run and recent failure captures.
+func WriteSupportBundle(w io.Writer, params SupportBundleParams) ([]string, error) {
+	bundle := &supportBundle{zip: zip.NewWriter(w)}
+
+	if err := bundle.addJSON("version.json", supportVersionInfo()); err != nil {
+		return nil, err
+	}
+
+	if data, err := redactedConfig(params.ConfigPath); err != nil {
+		bundle.addNote("config.error.txt", err)
+	} else if err := bundle.add("config.yml", data); err != nil {
+		return nil, err
+	}
+
+	if data, err := redactedState(); err != nil {
+		bundle.addNote("state.error.txt", err)
+	} else if data != nil {
+		if err := bundle.add("state.json", data); err != nil {
+			return nil, err
+		}
+	}
+
+	if runID, err := latestRunID(); err != nil {
+		bundle.addNote("runs.error.txt", err)
+	} else if runID != "" {
+		if err := bundle.addDir(RunDir(runID), filepath.Join("runs", runID), func(path string, info fs.FileInfo) bool {
+			return true
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	since := time.Now().Add(-params.Since)
+	recent := func(path string, info fs.FileInfo) bool {
+		if filepath.Base(path) == "page.html" && !params.IncludeHTML {
+			return false
+		}
+		return info.ModTime().After(since)
+	}
+	for _, dir := range []string{"failures", "screenshots"} {
+		if err := bundle.addDir(DataPath(dir), dir, recent); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := bundle.zip.Close(); err != nil {
+		return nil, err
+	}
+	return bundle.files, nil
+}
+
+type supportBundle struct {
+	zip   *zip.Writer
+	files []string
+}
+
+func (b *supportBundle) add(name string, data []byte) error {
+	f, err := b.zip.CreateHeader(&zip.FileHeader{
+		Name:     filepath.ToSlash(name),
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("could not write %s to bundle: %w", name, err)
+	}
+	b.files = append(b.files, name)
+	return nil
+}
+
+func (b *supportBundle) addJSON(name string, v any) error {
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, v); err != nil {
+		return err
+	}
+	return b.add(name, buf.Bytes())
+}
+
+// addNote records why a part of the bundle is missing instead of failing the whole bundle.
+func (b *supportBundle) addNote(name string, err error) {
+	_ = b.add(name, []byte(err.Error()+"\n"))
+}
+
+func (b *supportBundle) addDir(dir, prefix string, include func(path string, info fs.FileInfo) bool) error {
+	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !include(path, info) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(path, ".log") {
+			data = redactLog(data)
+		}
+		return b.add(filepath.Join(prefix, rel), data)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+type SupportVersionInfo struct {
+	Module          string `json:"module"`
+	Version         string `json:"version"`
+	Revision        string `json:"revision,omitempty"`
+	Modified        bool   `json:"modified,omitempty"`
+	GoVersion       string `json:"goVersion"`
+	Platform        string `json:"platform"`
+	SelectorProfile string `json:"selectorProfile"`
+	Playwright      string `json:"playwright,omitempty"`
+	Browsers        string `json:"browsers,omitempty"`
+}
+
+func supportVersionInfo() SupportVersionInfo {
+	info := SupportVersionInfo{
+		GoVersion:       runtime.Version(),
+		Platform:        runtime.GOOS + "/" + runtime.GOARCH,
+		SelectorProfile: SelectorProfileVersion,
+	}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		info.Module, info.Version = build.Main.Path, build.Main.Version
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Revision = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if stamp, err := readPlaywrightInstallStamp(); err == nil {
+		info.Playwright = stamp.Version
+		info.Browsers = strings.Join(stamp.Browsers, ", ")
+	}
+
+	return info
+}
+
+var redactedConfigKeys = []string{"password", "secret", "token", "roleid", "headers", "notifications"}
+
+// redactedConfig keeps the structure and comments of the config, replacing credentials.
+func redactedConfig(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("error decoding config: %w", err)
+	}
+	redactYAML(&root)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&root); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+func redactYAML(node *yaml.Node) {
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			name := strings.ToLower(key.Value)
+			if slices.ContainsFunc(redactedConfigKeys, func(redacted string) bool { return strings.Contains(name, redacted) }) {
+				redactYAMLValues(value)
+				continue
+			}
+			redactYAML(value)
+		}
+		return
+	}
+
+	for _, child := range node.Content {
+		redactYAML(child)
+	}
+}
+
+func redactYAMLValues(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode {
+		node.Value, node.Tag, node.Style = "[REDACTED]", "!!str", 0
+		return
+	}
+	if node.Kind == yaml.MappingNode {
+		for i := 1; i < len(node.Content); i += 2 {
+			redactYAMLValues(node.Content[i])
+		}
+		return
+	}
+	for _, child := range node.Content {
+		redactYAMLValues(child)
+	}
+}
+
+func redactedState() ([]byte, error) {
+	backend, err := DataStorage()
+	if err != nil {
+		return nil, err
+	}
+	data, err := backend.Read("state.json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state: %w", err)
+	}
+
+	var s state.State
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("error decoding state: %w", err)
+	}
+	for _, instance := range s.Instances {
+		instance.LicenseKey = ""
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, s); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// redactLog replaces license keys in json log lines with their hashes.
+func redactLog(data []byte) []byte {
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+
+		var entry map[string]any
+		if err := json.Unmarshal(line, &entry); err == nil {
+			changed := false
+			for key, value := range entry {
+				if s, ok := value.(string); ok && strings.Contains(strings.ToLower(key), "license key") && s != "" && !strings.HasPrefix(s, "sha256:") {
+					entry[key] = LicenseKeyHash(s)
+					changed = true
+				}
+			}
+			if changed {
+				if redacted, err := json.Marshal(entry); err == nil {
+					line = redacted
+				}
+			}
+		}
+
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// latestRunID returns the newest run directory, run ids start with their utc start time.
+func latestRunID() (string, error) {
+	entries, err := os.ReadDir(DataPath("runs"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	latest := ""
+	for _, entry := range entries {
+		if entry.IsDir() && entry.Name() > latest {
+			latest = entry.Name()
+		}
+	}
+	return latest, nil
+}
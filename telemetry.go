@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+)
+
+// SelectorFailureSignature identifies a selector timeout without anything about the instance it happened on.
+type SelectorFailureSignature struct {
+	Selector       string `json:"selector"`
+	Product        string `json:"product"`
+	ProductVersion string `json:"productVersion,omitempty"`
+}
+
+type TelemetryFailure struct {
+	SelectorFailureSignature
+	Count int `json:"count"`
+}
+
+type TelemetryReport struct {
+	SelectorProfile string             `json:"selectorProfile"`
+	Failures        []TelemetryFailure `json:"failures"`
+}
+
+type selectorPageKey struct{}
+
+// WithSelectorPage tells selector tracking which instance page the product version is read from.
+func WithSelectorPage(ctx context.Context, page playwright.Page) context.Context {
+	return context.WithValue(ctx, selectorPageKey{}, page)
+}
+
+// CollectFailures makes the tracker keep selector timeouts for telemetry, it must be called before tracking starts.
+func (t *SelectorTracker) CollectFailures() {
+	t.failures = map[SelectorFailureSignature]int{}
+}
+
+func (t *SelectorTracker) TelemetryReport() TelemetryReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	report := TelemetryReport{
+		SelectorProfile: SelectorProfileVersion,
+		Failures:        make([]TelemetryFailure, 0, len(t.failures)),
+	}
+	for signature, count := range t.failures {
+		report.Failures = append(report.Failures, TelemetryFailure{SelectorFailureSignature: signature, Count: count})
+	}
+	sort.Slice(report.Failures, func(i, j int) bool {
+		a, b := report.Failures[i], report.Failures[j]
+		if a.Selector != b.Selector {
+			return a.Selector < b.Selector
+		}
+		return a.ProductVersion < b.ProductVersion
+	})
+	return report
+}
+
+var productVersionPattern = regexp.MustCompile(`^\d+(\.\d+)*`)
+
+func selectorFailureSignature(ctx context.Context, id string) SelectorFailureSignature {
+	product, _, _ := strings.Cut(id, ".")
+	signature := SelectorFailureSignature{Selector: id, Product: product}
+
+	// my.atlassian.com has no version, the page in the context is the instance
+	page, ok := ctx.Value(selectorPageKey{}).(playwright.Page)
+	if !ok || product == "atlassian" || page.IsClosed() {
+		return signature
+	}
+	version, err := page.Evaluate(`() => document.querySelector('meta[name="ajs-version-number"]')?.content ?? ""`)
+	if err != nil {
+		return signature
+	}
+	// only the version number, whatever else the meta tag holds is not sent
+	if version, ok := version.(string); ok {
+		signature.ProductVersion = productVersionPattern.FindString(version)
+	}
+	return signature
+}
+
+// SendTelemetry posts the selector failures of a run, runs without failures send nothing.
+func SendTelemetry(ctx context.Context, cfg config.Telemetry, report TelemetryReport) error {
+	if len(report.Failures) == 0 {
+		return nil
+	}
+	if cfg.Endpoint == "" {
+		return errors.New("telemetry is enabled but has no endpoint")
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating telemetry request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("sending telemetry: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint responded with status %d", res.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/playwright-community/playwright-go"
+	"github.com/tarik02/jira-auto-trial/config"
+	"golang.org/x/sync/errgroup"
+)
+
+type URLRewriter []config.URLRewrite
+
+func (r URLRewriter) Rewrite(u string) string {
+	for _, rule := range r {
+		from, to := strings.TrimSuffix(rule.From, "/"), strings.TrimSuffix(rule.To, "/")
+		if from != "" && hasURLPrefix(u, from) {
+			return to + u[len(from):]
+		}
+	}
+	return u
+}
+
+func (r URLRewriter) Reverse(u string) string {
+	for _, rule := range r {
+		from, to := strings.TrimSuffix(rule.From, "/"), strings.TrimSuffix(rule.To, "/")
+		if to != "" && hasURLPrefix(u, to) {
+			return from + u[len(to):]
+		}
+	}
+	return u
+}
+
+func hasURLPrefix(u, prefix string) bool {
+	if !strings.HasPrefix(u, prefix) {
+		return false
+	}
+	rest := u[len(prefix):]
+	return rest == "" || strings.ContainsAny(rest[:1], "/?#")
+}
+
+func NavigationBaseURL(instance config.JiraInstance) string {
+	return URLRewriter(instance.URLRewrite).Rewrite(instance.BaseURL)
+}
+
+func StartURLRewrite(ctx context.Context, g *errgroup.Group, page playwright.Page, rules []config.URLRewrite) error {
+	rewriter := URLRewriter(rules)
+
+	patterns := make([]*regexp.Regexp, 0, len(rules))
+	for _, rule := range rules {
+		from := strings.TrimSuffix(rule.From, "/")
+		if from == "" || rule.To == "" {
+			return fmt.Errorf("invalid url rewrite rule: %q → %q", rule.From, rule.To)
+		}
+
+		pattern := regexp.MustCompile("^" + regexp.QuoteMeta(from) + "([/?#]|$)")
+		if err := page.Route(pattern, func(route playwright.Route) {
+			_ = route.Fulfill(playwright.RouteFulfillOptions{
+				Status: playwright.Int(307),
+				Headers: map[string]string{
+					"Location": rewriter.Rewrite(route.Request().URL()),
+				},
+			})
+		}); err != nil {
+			return fmt.Errorf("could not install url rewrite for %s: %w", rule.From, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	_ = g.TryGo(func() error {
+		<-ctx.Done()
+		for _, pattern := range patterns {
+			_ = page.Unroute(pattern)
+		}
+		return nil
+	})
+
+	return nil
+}
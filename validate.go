@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"github.com/tarik02/jira-auto-trial/credentials"
+	"github.com/tarik02/jira-auto-trial/policy"
+	"github.com/tarik02/jira-auto-trial/schedule"
+	"go.uber.org/zap"
+)
+
+// ConfigError points at the field of the config that is wrong.
+type ConfigError struct {
+	Path    string
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ConfigErrors lists every problem found in the config.
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return "invalid config: " + strings.Join(messages, "; ")
+}
+
+type configValidator struct {
+	errs ConfigErrors
+}
+
+func (v *configValidator) fail(path, format string, args ...any) {
+	v.errs = append(v.errs, ConfigError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// ValidateConfig checks the config and its profiles before anything is started, so mistakes are reported with the
+// path of the field instead of failing in the middle of a run.
+func ValidateConfig(cfg *config.Config) error {
+	v := &configValidator{}
+
+	if cfg.Schedule != "" {
+		if _, err := schedule.Parse(cfg.Schedule); err != nil {
+			v.fail("schedule", "%s", err)
+		}
+	}
+	if _, err := policy.New(cfg.Policy); err != nil {
+		v.fail("policy", "%s", err)
+	}
+	v.validateRun(cfg, "")
+
+	for _, name := range sortedKeys(cfg.Profiles) {
+		profile, prefix := cfg.Profiles[name], "profiles."+name+"."
+		if profile.Schedule != "" {
+			if _, err := schedule.Parse(profile.Schedule); err != nil {
+				v.fail(prefix+"schedule", "%s", err)
+			}
+		}
+		if profile.Policy != nil {
+			if _, err := policy.New(*profile.Policy); err != nil {
+				v.fail(prefix+"policy", "%s", err)
+			}
+		}
+
+		profileCfg, err := cfg.WithProfile(name)
+		if err != nil {
+			return err
+		}
+		v.validateRun(profileCfg, prefix)
+	}
+
+	switch cfg.Playwright.Browser {
+	case "", "chromium":
+	case "firefox", "webkit":
+		if cfg.Playwright.Channel != "" {
+			v.fail("playwright.channel", "only applies to chromium")
+		}
+	default:
+		v.fail("playwright.browser", "unknown browser %q, use chromium, firefox or webkit", cfg.Playwright.Browser)
+	}
+	if cfg.Playwright.Channel != "" && cfg.Playwright.ExecutablePath != "" {
+		v.fail("playwright.executablePath", "set either channel or executablePath")
+	}
+	if cfg.Playwright.NavigationTimeout < 0 {
+		v.fail("playwright.navigationTimeout", "must not be negative")
+	}
+	if cfg.Playwright.ActionTimeout < 0 {
+		v.fail("playwright.actionTimeout", "must not be negative")
+	}
+	for _, name := range sortedKeys(cfg.Playwright.HandlerTimeouts) {
+		if !slices.Contains(HandlerNames, name) {
+			v.fail("playwright.handlerTimeouts."+name, "unknown handler, use one of %s", strings.Join(HandlerNames, ", "))
+		} else if cfg.Playwright.HandlerTimeouts[name] < 0 {
+			v.fail("playwright.handlerTimeouts."+name, "must not be negative")
+		}
+	}
+
+	if cfg.Telemetry.Enabled && cfg.Telemetry.Endpoint == "" {
+		v.fail("telemetry.endpoint", "is required when telemetry is enabled")
+	}
+	for i, notification := range cfg.Notifications {
+		path := fmt.Sprintf("notifications[%d]", i)
+		targets := 0
+		for _, target := range []*config.NotificationWebhook{notification.Slack, notification.Discord, notification.Webhook} {
+			if target == nil {
+				continue
+			}
+			targets++
+			if target.URL == "" {
+				v.fail(path, "url is required")
+			}
+		}
+		if targets != 1 {
+			v.fail(path, "set exactly one of slack, discord or webhook")
+		}
+		if notification.RenotifyAfter < 0 {
+			v.fail(path+".renotifyAfter", "must not be negative")
+		} else if notification.RenotifyAfter > 0 && !notification.OnlyDeltas {
+			v.fail(path+".renotifyAfter", "only applies with onlyDeltas")
+		}
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+// validateRun checks the instances and the atlassian account one run of the config uses, prefix is the path of a profile.
+func (v *configValidator) validateRun(cfg *config.Config, prefix string) {
+	baseURLs := make(map[string]string)
+	renews := false
+	for i, instance := range cfg.Instances {
+		path := fmt.Sprintf("%sinstances[%d]", prefix, i)
+
+		if err := validateBaseURL(instance.BaseURL); err != nil {
+			v.fail(path+".baseURL", "%s", err)
+		} else {
+			key := normalizeBaseURL(instance.BaseURL)
+			if other, ok := baseURLs[key]; ok {
+				v.fail(path+".baseURL", "%s is also the base url of %s", instance.BaseURL, other)
+			} else {
+				baseURLs[key] = path
+			}
+		}
+
+		if _, err := InstanceProduct(instance); err != nil {
+			v.fail(path+".product", "%s, use jira, confluence or bitbucket", err)
+		}
+		if instance.Schedule != "" {
+			if _, err := schedule.Parse(instance.Schedule); err != nil {
+				v.fail(path+".schedule", "%s", err)
+			}
+		}
+		if _, err := policy.New(instance.Policy); err != nil {
+			v.fail(path+".policy", "%s", err)
+		}
+		if !instance.Disabled {
+			v.validateAccount(path+".account", instance.Account, true)
+			renews = true
+		}
+	}
+
+	if cfg.Atlassian.Timeouts.Step < 0 {
+		v.fail(prefix+"atlassian.timeouts.step", "must not be negative")
+	}
+	if cfg.Atlassian.Timeouts.Generate < 0 {
+		v.fail(prefix+"atlassian.timeouts.generate", "must not be negative")
+	}
+
+	// my.atlassian.com is only visited to generate a license
+	if renews && !cfg.DryRun {
+		if cfg.Atlassian.Account.PAT != nil {
+			v.fail(prefix+"atlassian.account", "my.atlassian.com needs a login, a personal access token cannot be used")
+		} else {
+			v.validateAccount(prefix+"atlassian.account", cfg.Atlassian.Account, false)
+		}
+	}
+}
+
+func (v *configValidator) validateAccount(path string, account config.Account, allowPAT bool) {
+	sources := make([]string, 0, 1)
+	if account.Plain != nil {
+		sources = append(sources, "plain")
+		if account.Plain.Username == "" {
+			v.fail(path+".plain.username", "is required")
+		}
+	}
+	if account.Env != nil {
+		sources = append(sources, "env")
+		if account.Env.UsernameVar == "" {
+			v.fail(path+".env.usernameVar", "is required")
+		}
+		if account.Env.PasswordVar == "" {
+			v.fail(path+".env.passwordVar", "is required")
+		}
+	}
+	if account.Command != nil {
+		sources = append(sources, "command")
+		if len(account.Command.Command) == 0 {
+			v.fail(path+".command.command", "is required")
+		}
+	}
+	if account.Vault != nil {
+		sources = append(sources, "vault")
+		if account.Vault.Path == "" {
+			v.fail(path+".vault.path", "is required")
+		}
+	}
+	if account.Keyring != nil {
+		sources = append(sources, "keyring")
+		if account.Keyring.Username == "" {
+			v.fail(path+".keyring.username", "is required")
+		}
+	}
+	if account.PAT != nil {
+		sources = append(sources, "pat")
+		if account.PAT.Token == "" && account.PAT.TokenVar == "" {
+			v.fail(path+".pat", "set token or tokenVar")
+		}
+	}
+
+	options := "plain, env, command, vault or keyring"
+	if allowPAT {
+		options = "plain, env, command, vault, keyring or pat"
+	}
+	switch len(sources) {
+	case 0:
+		v.fail(path, "no credentials, set one of %s", options)
+	case 1:
+	default:
+		v.fail(path, "only one of %s can be set, found %s", options, strings.Join(sources, " and "))
+	}
+}
+
+func validateBaseURL(baseURL string) error {
+	if baseURL == "" {
+		return fmt.Errorf("is required")
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("%q is not a url: %w", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q must be an absolute http(s) url, e.g. https://jira.example.com", baseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%q must not have a query or fragment", baseURL)
+	}
+	return nil
+}
+
+func normalizeBaseURL(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return baseURL
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + strings.TrimSuffix(u.Path, "/")
+}
+
+// ResolveAccounts resolves the credentials of every account the config uses, which validate -resolve checks.
+func ResolveAccounts(ctx context.Context, cfg *config.Config) error {
+	v := &configValidator{}
+	prefix := ""
+	if cfg.Profile != "" {
+		prefix = "profiles." + cfg.Profile + "."
+	}
+
+	resolve := func(path string, account config.Account) {
+		creds, err := credentials.ResolveCredentials(ctx, account)
+		if err != nil {
+			v.fail(path, "could not resolve credentials: %s", err)
+			return
+		}
+		creds.Wipe()
+	}
+
+	renews := false
+	for i, instance := range cfg.Instances {
+		if !instance.Disabled {
+			resolve(fmt.Sprintf("%sinstances[%d].account", prefix, i), instance.Account)
+			renews = true
+		}
+	}
+	if renews && !cfg.DryRun {
+		resolve(prefix+"atlassian.account", cfg.Atlassian.Account)
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+func validateCommand() *Command {
+	cmd := &Command{
+		Name:  "validate",
+		Usage: "jira-auto-trial validate [-profile names] [-resolve]",
+	}
+
+	cmd.Run = func(ctx context.Context, log *zap.Logger, args []string) error {
+		fs := cmd.FlagSet()
+		configFlags := RegisterConfigFlags(fs)
+		resolve := fs.Bool("resolve", false, "also resolve the credentials of every account")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+
+		// one problem per line, the log would put them all on one
+		report := func(err error) error {
+			var configErrs ConfigErrors
+			if !errors.As(err, &configErrs) {
+				return err
+			}
+			for _, configErr := range configErrs {
+				fmt.Fprintln(os.Stderr, configErr)
+			}
+			if len(configErrs) == 1 {
+				return fmt.Errorf("%s: 1 problem found", configFlags.Path)
+			}
+			return fmt.Errorf("%s: %d problems found", configFlags.Path, len(configErrs))
+		}
+
+		// loading validates the whole file, profiles included
+		cfgs, err := configFlags.LoadAll()
+		if err != nil {
+			return report(err)
+		}
+
+		instances := 0
+		var resolveErrs ConfigErrors
+		for _, cfg := range cfgs {
+			instances += len(cfg.Instances)
+			if *resolve {
+				var configErrs ConfigErrors
+				if err := ResolveAccounts(ctx, cfg); errors.As(err, &configErrs) {
+					resolveErrs = append(resolveErrs, configErrs...)
+				}
+			}
+		}
+		if len(resolveErrs) > 0 {
+			return report(resolveErrs)
+		}
+
+		fmt.Printf("%s is valid, %d instances\n", configFlags.Path, instances)
+		return nil
+	}
+
+	return cmd
+}
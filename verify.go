@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tarik02/jira-auto-trial/config"
+	"go.uber.org/zap"
+)
+
+var ErrUpdateNotVerified = errors.New("license update not verified")
+
+// updateApplied reports whether the details read after an update show the new license: the trial expiry moved
+// forward, or, when the page shows no expiry, the license key is the applied one.
+func updateApplied(before, after *ResolveLicenseDetailsResult, licenseKey string) bool {
+	if after.TrialExpiresAt != nil && (before.TrialExpiresAt == nil || after.TrialExpiresAt.After(*before.TrialExpiresAt)) {
+		return true
+	}
+	if after.TrialExpiresAt == nil && after.LicenseKey != "" {
+		return strings.Join(strings.Fields(after.LicenseKey), "") == strings.Join(strings.Fields(licenseKey), "")
+	}
+	return false
+}
+
+// VerifyLicenseUpdate reads the license details until they show the applied license, the licenses page
+// may still show the old details right after the update.
+func VerifyLicenseUpdate(
+	ctx context.Context,
+	log *zap.Logger,
+	cfg config.VerifyUpdate,
+	before *ResolveLicenseDetailsResult,
+	licenseKey string,
+	read func() (*ResolveLicenseDetailsResult, error),
+) (*ResolveLicenseDetailsResult, error) {
+	attempts := cfg.Attempts
+	if attempts <= 0 {
+		attempts = 3
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	var (
+		after *ResolveLicenseDetailsResult
+		err   error
+	)
+	for attempt := 1; ; attempt++ {
+		after, err = read()
+		if err == nil && updateApplied(before, after, licenseKey) {
+			log.Info(
+				"license update verified",
+				zap.String("old trial expiry", formatDate(before.TrialExpiresAt)),
+				zap.String("new trial expiry", formatDate(after.TrialExpiresAt)),
+			)
+			return after, nil
+		}
+		if attempt >= attempts {
+			break
+		}
+
+		if err != nil {
+			log.Warn("could not resolve license details after update, retrying", zap.Int("attempt", attempt), zap.Error(err))
+		} else {
+			log.Warn("license details not updated yet, retrying", zap.Int("attempt", attempt), zap.String("trial expiry", formatDate(after.TrialExpiresAt)))
+		}
+		if err := sleepContext(ctx, interval); err != nil {
+			return nil, err
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: could not resolve license details: %w", ErrUpdateNotVerified, err)
+	}
+	return after, fmt.Errorf("%w: trial expiry did not move forward (%s → %s)", ErrUpdateNotVerified, formatDate(before.TrialExpiresAt), formatDate(after.TrialExpiresAt))
+}
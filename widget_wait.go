@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/playwright-community/playwright-go"
+)
+
+// widgetSpinners match the loading indicators of aui and atlaskit widgets.
+const widgetSpinners = `.aui-spinner, aui-spinner, .spinner, [data-testid$="spinner"], [aria-busy="true"]`
+
+const widgetPollInterval = 200 * time.Millisecond
+
+type WaitForWidgetParams struct {
+	// present once the widget rendered, e.g. its detail fields
+	Ready string
+	// the widget is still rendering while any of these is empty
+	Values string
+	// attributes the ready elements carry once their data arrived
+	Attributes []string
+	// 10s by default
+	Timeout time.Duration
+}
+
+// WaitForWidget waits until a widget that renders over xhr has finished: its spinners are gone, the ready elements
+// exist with their attributes and none of the values is empty. Reading right after the section appears can yield
+// empty license keys and SENs on slow instances.
+func WaitForWidget(ctx context.Context, widget playwright.Locator, params WaitForWidgetParams) error {
+	timeout := params.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var pending string
+	for {
+		var err error
+		if pending, err = widgetPending(widget, params); err != nil {
+			return err
+		}
+		if pending == "" {
+			return nil
+		}
+		if err := sleepContext(ctx, widgetPollInterval); err != nil {
+			if ctx.Err() == context.DeadlineExceeded {
+				return fmt.Errorf("%w: widget did not finish rendering within %s, %s", playwright.ErrTimeout, timeout, pending)
+			}
+			return err
+		}
+	}
+}
+
+// widgetPending describes what the widget is still waiting for, or returns an empty string when it is rendered.
+func widgetPending(widget playwright.Locator, params WaitForWidgetParams) (string, error) {
+	spinners, err := widget.Locator(widgetSpinners).All()
+	if err != nil {
+		return "", err
+	}
+	for _, spinner := range spinners {
+		if visible, err := spinner.IsVisible(); err != nil {
+			return "", err
+		} else if visible {
+			return "a spinner is visible", nil
+		}
+	}
+
+	if params.Ready != "" {
+		ready, err := widget.Locator(params.Ready).All()
+		if err != nil {
+			return "", err
+		}
+		if len(ready) == 0 {
+			return "no " + params.Ready, nil
+		}
+		for _, element := range ready {
+			for _, attribute := range params.Attributes {
+				value, err := element.GetAttribute(attribute)
+				if err != nil {
+					return "", err
+				}
+				if value == "" {
+					return "empty " + attribute, nil
+				}
+			}
+		}
+	}
+
+	if params.Values != "" {
+		values, err := widget.Locator(params.Values).AllTextContents()
+		if err != nil {
+			return "", err
+		}
+		for _, value := range values {
+			if strings.TrimSpace(value) == "" {
+				return "empty " + params.Values, nil
+			}
+		}
+	}
+
+	return "", nil
+}